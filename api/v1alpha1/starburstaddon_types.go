@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -28,9 +30,785 @@ type StarburstAddonSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
+	// Metrics deploys the managed Prometheus, ServiceMonitors and PrometheusRules.
+	// It is not omitted when false so that disabling it survives defaulting.
 	// +optional
 	// +kubebuilder:default=true
-	Metrics bool `json:"metrics,omitempty"`
+	Metrics bool `json:"metrics"`
+
+	// ForceApply takes ownership of fields on generated resources that are
+	// currently owned by another field manager instead of reporting a conflict.
+	// +optional
+	ForceApply bool `json:"forceApply,omitempty"`
+
+	// AlertThresholds overrides the thresholds of the alerts installed with
+	// the managed Prometheus. Unset fields keep their defaults.
+	// +optional
+	AlertThresholds *AlertThresholds `json:"alertThresholds,omitempty"`
+
+	// RunbookBaseURL is the page the runbook_url annotation of the managed
+	// alerts links to, with the lowercased alert name as the fragment.
+	// Defaults to the runbooks of the operator repository.
+	// +kubebuilder:validation:Pattern=`^https?://[^#\s]+$`
+	// +optional
+	RunbookBaseURL string `json:"runbookBaseURL,omitempty"`
+
+	// RemoteWrite lists additional endpoints the managed Prometheus writes
+	// to, next to the one configured in the addon vault secret.
+	// +optional
+	RemoteWrite []RemoteWriteTarget `json:"remoteWrite,omitempty"`
+
+	// Paused stops the operator from changing any generated resource, for
+	// example while manual fixes are applied during an incident. Only the
+	// Paused condition keeps being updated. Deletion is still handled.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// MaintenanceWindows are recurring periods during which operand upgrades
+	// and other disruptive changes, such as worker rollouts, autoscaling and
+	// sleep schedule replica changes, are deferred until the window closes.
+	// +optional
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+
+	// Version of Starburst Enterprise to run, for example 402-e.1. When set,
+	// the operator owns the coordinator and worker image tags of the
+	// StarburstEnterprise and rolls out changes coordinator first. Only
+	// upgrades along the operator's supported upgrade paths are accepted.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+-e\.[0-9]+$`
+	Version string `json:"version,omitempty"`
+
+	// Upgrade tunes how spec.version changes are rolled out.
+	// +optional
+	Upgrade *UpgradeSettings `json:"upgrade,omitempty"`
+
+	// WorkerDrainDeadline is how long a terminating worker gets to finish its
+	// active tasks before it is killed. It sets the termination grace period
+	// of the workers, which shut down gracefully whenever their pod is
+	// deleted. Defaults to 5m.
+	// +optional
+	WorkerDrainDeadline *metav1.Duration `json:"workerDrainDeadline,omitempty"`
+
+	// MaxDrainingWorkers is how many workers a scale-down or an upgrade
+	// replaces at a time. The next batch starts once the pods of the
+	// previous one are gone. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxDrainingWorkers *int32 `json:"maxDrainingWorkers,omitempty"`
+
+	// Autoscaling lets the operator set the worker count of the
+	// StarburstEnterprise from the query load.
+	// +optional
+	Autoscaling *Autoscaling `json:"autoscaling,omitempty"`
+
+	// Schedule puts the cluster to sleep outside of the hours it is needed.
+	// +optional
+	Schedule *Schedule `json:"schedule,omitempty"`
+
+	// ResourceGroups configures the resource groups and session properties
+	// of the coordinator.
+	// +optional
+	ResourceGroups *ResourceGroups `json:"resourceGroups,omitempty"`
+
+	// AccessControl enables file-based access control on the coordinator.
+	// +optional
+	AccessControl *AccessControl `json:"accessControl,omitempty"`
+
+	// Expose makes the coordinator reachable from outside the cluster.
+	// +optional
+	Expose *Expose `json:"expose,omitempty"`
+
+	// NetworkPolicy restricts the traffic into the operand namespace.
+	// +optional
+	NetworkPolicy *NetworkPolicy `json:"networkPolicy,omitempty"`
+
+	// Authentication of the users of the coordinator. It needs spec.expose,
+	// which terminates TLS in front of the coordinator.
+	// +optional
+	Authentication *Authentication `json:"authentication,omitempty"`
+
+	// InternalTLS encrypts the traffic between the coordinator and the
+	// workers with certificates issued by the operator.
+	// +optional
+	InternalTLS *InternalTLS `json:"internalTLS,omitempty"`
+
+	// Images overrides the images of the pods the operator creates. Pinning
+	// them by digest, as in image@sha256:<digest>, is recommended.
+	// +optional
+	Images *Images `json:"images,omitempty"`
+
+	// Alerting deploys an Alertmanager next to the managed Prometheus and
+	// routes the firing alerts to its receivers. It needs spec.metrics.
+	// +optional
+	Alerting *Alerting `json:"alerting,omitempty"`
+}
+
+// Alerting configures the managed Alertmanager.
+type Alerting struct {
+	// Receivers the alerts can be sent to.
+	// +kubebuilder:validation:MinItems=1
+	Receivers []AlertReceiver `json:"receivers"`
+
+	// DefaultReceiver gets the alerts no route matches. Defaults to the
+	// first receiver.
+	// +optional
+	DefaultReceiver string `json:"defaultReceiver,omitempty"`
+
+	// Routes send the alerts they match to a receiver, the first matching
+	// route winning unless it sets continue.
+	// +optional
+	Routes []AlertRoute `json:"routes,omitempty"`
+
+	// GroupBy are the labels alerts are grouped into one notification by.
+	// Defaults to alertname.
+	// +optional
+	GroupBy []string `json:"groupBy,omitempty"`
+
+	// RepeatInterval is how long to wait before notifying again about an
+	// alert that is still firing, for example 4h.
+	// +kubebuilder:validation:Pattern=`^([0-9]+(ms|s|m|h|d|w|y))+$`
+	// +optional
+	RepeatInterval string `json:"repeatInterval,omitempty"`
+
+	// Heartbeat receives the always-firing Watchdog alert, so that a
+	// dead man's switch on the other end notices when alerts stop flowing.
+	// The Watchdog alert is never sent to the other receivers.
+	// +optional
+	Heartbeat *Heartbeat `json:"heartbeat,omitempty"`
+}
+
+// Heartbeat posts the Watchdog alert to a webhook, for example a Dead Man's
+// Snitch URL, at a fixed interval.
+type Heartbeat struct {
+	// URL selects the Secret key holding the webhook URL.
+	URL corev1.SecretKeySelector `json:"url"`
+
+	// Interval between two posts. The other end should alert after missing
+	// a few of them.
+	// +kubebuilder:validation:Pattern=`^([0-9]+(ms|s|m|h|d|w|y))+$`
+	// +kubebuilder:default="5m"
+	// +optional
+	Interval string `json:"interval,omitempty"`
+}
+
+// AlertReceiver is a named set of notification integrations. Credentials are
+// read from Secrets in the operand namespace by the Alertmanager.
+type AlertReceiver struct {
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9][-_a-zA-Z0-9]*$`
+	Name string `json:"name"`
+
+	// +optional
+	PagerDuty *PagerDutyReceiver `json:"pagerDuty,omitempty"`
+
+	// +optional
+	Slack *SlackReceiver `json:"slack,omitempty"`
+
+	// +optional
+	Email *EmailReceiver `json:"email,omitempty"`
+}
+
+// PagerDutyReceiver notifies a PagerDuty service through the Events API v2.
+type PagerDutyReceiver struct {
+	// RoutingKey selects the Secret key holding the integration key.
+	RoutingKey corev1.SecretKeySelector `json:"routingKey"`
+}
+
+// SlackReceiver posts to a Slack incoming webhook.
+type SlackReceiver struct {
+	// WebhookURL selects the Secret key holding the webhook URL.
+	WebhookURL corev1.SecretKeySelector `json:"webhookURL"`
+
+	// Channel overrides the channel of the webhook.
+	// +optional
+	Channel string `json:"channel,omitempty"`
+}
+
+// EmailReceiver sends mail through an SMTP server.
+type EmailReceiver struct {
+	To string `json:"to"`
+
+	From string `json:"from"`
+
+	// Smarthost is the SMTP server as host:port.
+	// +kubebuilder:validation:Pattern=`^[^:\s]+:[0-9]+$`
+	Smarthost string `json:"smarthost"`
+
+	// +optional
+	AuthUsername string `json:"authUsername,omitempty"`
+
+	// AuthPassword selects the Secret key holding the SMTP password.
+	// +optional
+	AuthPassword *corev1.SecretKeySelector `json:"authPassword,omitempty"`
+}
+
+// AlertRoute sends the alerts matching all of its matchers to a receiver.
+type AlertRoute struct {
+	Receiver string `json:"receiver"`
+
+	// +kubebuilder:validation:MinItems=1
+	Matchers []AlertMatcher `json:"matchers"`
+
+	// Continue also evaluates the following routes for the alerts it matched.
+	// +optional
+	Continue bool `json:"continue,omitempty"`
+}
+
+// AlertMatcher matches an alert label.
+type AlertMatcher struct {
+	// Name of the label, for example severity.
+	Name string `json:"name"`
+
+	// Value the label must equal, or match when Regex is set.
+	Value string `json:"value"`
+
+	// +optional
+	Regex bool `json:"regex,omitempty"`
+}
+
+// Images are the container images of the pods the operator creates.
+type Images struct {
+	// Apply is the image with kubectl the operand is applied with.
+	// +kubebuilder:validation:Pattern=`^[^@\s]+(@sha256:[a-f0-9]{64})?$`
+	// +optional
+	Apply string `json:"apply,omitempty"`
+
+	// Prometheus is the image of the managed Prometheus.
+	// +kubebuilder:validation:Pattern=`^[^@\s]+(@sha256:[a-f0-9]{64})?$`
+	// +optional
+	Prometheus string `json:"prometheus,omitempty"`
+}
+
+// InternalTLS configures the certificates of the Trino nodes. They are signed
+// by a CA the operator keeps in a Secret of the operand namespace and are
+// renewed ahead of expiry, restarting the nodes.
+type InternalTLS struct {
+	// CertificateDuration is the validity of the node certificates.
+	// Defaults to 2160h (90 days).
+	// +optional
+	CertificateDuration *metav1.Duration `json:"certificateDuration,omitempty"`
+
+	// RenewBefore is how long before expiry the node certificates are
+	// renewed. Defaults to a third of CertificateDuration.
+	// +optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+}
+
+// Authentication selects how the coordinator authenticates users. Only the
+// section of Type is used.
+type Authentication struct {
+	// Type of authentication.
+	// +kubebuilder:validation:Enum=OAuth2;LDAP;PasswordFile
+	Type string `json:"type"`
+
+	// OAuth2 authenticates users with an OpenID Connect provider, such as
+	// the identity provider of the OpenShift cluster.
+	// +optional
+	OAuth2 *OAuth2Authentication `json:"oauth2,omitempty"`
+
+	// LDAP checks user passwords against an LDAP server.
+	// +optional
+	LDAP *LDAPAuthentication `json:"ldap,omitempty"`
+
+	// PasswordFile checks user passwords against a bcrypt password file.
+	// +optional
+	PasswordFile *PasswordFileAuthentication `json:"passwordFile,omitempty"`
+}
+
+// OAuth2Authentication configures the OAuth 2.0 authentication of the
+// coordinator.
+type OAuth2Authentication struct {
+	// Issuer is the URL of the OpenID Connect provider. Its endpoints are
+	// discovered unless AuthURL, TokenURL and JWKSURL are set.
+	// +kubebuilder:validation:Pattern=`^https://`
+	Issuer string `json:"issuer"`
+
+	// ClientID registered with the provider.
+	ClientID string `json:"clientID"`
+
+	// ClientSecret selects the key of a Secret in the operand namespace
+	// holding the client secret.
+	ClientSecret corev1.SecretKeySelector `json:"clientSecret"`
+
+	// Scopes requested from the provider. Defaults to openid.
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+
+	// PrincipalField is the claim used as user name. Defaults to sub.
+	// +optional
+	PrincipalField string `json:"principalField,omitempty"`
+
+	// AuthURL, TokenURL and JWKSURL replace discovery for providers without it.
+	// +optional
+	AuthURL string `json:"authURL,omitempty"`
+	// +optional
+	TokenURL string `json:"tokenURL,omitempty"`
+	// +optional
+	JWKSURL string `json:"jwksURL,omitempty"`
+}
+
+// LDAPAuthentication configures the LDAP password authenticator.
+type LDAPAuthentication struct {
+	// URL of the LDAP server. Only ldaps is accepted.
+	// +kubebuilder:validation:Pattern=`^ldaps://`
+	URL string `json:"url"`
+
+	// UserBindPattern is the DN bound as the user, with ${USER} replaced by
+	// the user name, for example uid=${USER},ou=people,dc=example,dc=com.
+	// +optional
+	UserBindPattern string `json:"userBindPattern,omitempty"`
+
+	// UserBaseDN is searched for the user when BindDN is set.
+	// +optional
+	UserBaseDN string `json:"userBaseDN,omitempty"`
+
+	// GroupAuthorizationSearchPattern restricts the users that may log in,
+	// for example (&(objectClass=person)(uid=${USER})(memberof=cn=starburst,ou=groups,dc=example,dc=com)).
+	// +optional
+	GroupAuthorizationSearchPattern string `json:"groupAuthorizationSearchPattern,omitempty"`
+
+	// BindDN of the service user searching the directory.
+	// +optional
+	BindDN string `json:"bindDN,omitempty"`
+
+	// BindPassword selects the key of a Secret in the operand namespace
+	// holding the password of BindDN.
+	// +optional
+	BindPassword *corev1.SecretKeySelector `json:"bindPassword,omitempty"`
+}
+
+// PasswordFileAuthentication configures the file password authenticator.
+type PasswordFileAuthentication struct {
+	// SecretName is the Secret in the operand namespace holding the password
+	// file, in the user:bcrypt-hash format of htpasswd -B.
+	SecretName string `json:"secretName"`
+
+	// Key of the password file in the Secret. Defaults to password.db.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// NetworkPolicy denies all traffic into the operand namespace except between
+// the Starburst pods, from the operator, from the managed Prometheus and
+// openshift-monitoring, and to the coordinator from the allowlists and the
+// ingress controller.
+type NetworkPolicy struct {
+	// AllowedNamespaces may reach the coordinator.
+	// +optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// AllowedCIDRs may reach the coordinator.
+	// +optional
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty"`
+
+	// MonitoringNamespaces may scrape the Starburst pods in addition to
+	// openshift-monitoring.
+	// +optional
+	MonitoringNamespaces []string `json:"monitoringNamespaces,omitempty"`
+
+	// IngressNamespaceSelector selects the namespaces of the ingress
+	// controller serving spec.expose, which may reach the coordinator.
+	// Defaults to the namespaces of the OpenShift router for Routes, and is
+	// required for Ingresses.
+	// +optional
+	IngressNamespaceSelector *metav1.LabelSelector `json:"ingressNamespaceSelector,omitempty"`
+}
+
+// Expose creates a Route, or an Ingress, in front of the coordinator service.
+type Expose struct {
+	// Type of the resource created. Defaults to Route on OpenShift and
+	// Ingress elsewhere.
+	// +optional
+	// +kubebuilder:validation:Enum=Route;Ingress
+	Type string `json:"type,omitempty"`
+
+	// Host name clients connect to. Routes get one generated by the router
+	// when it is empty; Ingresses require it.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// IngressClassName selects the ingress controller of an Ingress.
+	// +optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+
+	// CertificateSecret is a kubernetes.io/tls Secret in the operand namespace
+	// with the certificate served to clients. Routes use the certificate of
+	// the router when it is empty; Ingresses require it.
+	// +optional
+	CertificateSecret string `json:"certificateSecret,omitempty"`
+
+	// ServiceCA re-encrypts the Route to the coordinator, which then serves
+	// HTTPS with a certificate the OpenShift service CA issues for the
+	// Service in front of it, or with its node certificate when
+	// spec.internalTLS is set. Only supported by Routes.
+	// +optional
+	ServiceCA bool `json:"serviceCA,omitempty"`
+}
+
+// AccessControl is rendered into the rules.json of the file-based system
+// access control. Rules are matched in order and the first match applies.
+// Patterns are regular expressions; fields left empty match everything.
+type AccessControl struct {
+	// Catalogs control which catalogs users can access.
+	// +optional
+	Catalogs []CatalogAccessRule `json:"catalogs,omitempty"`
+
+	// Schemas control who owns schemas.
+	// +optional
+	Schemas []SchemaAccessRule `json:"schemas,omitempty"`
+
+	// Tables control the privileges on tables.
+	// +optional
+	Tables []TableAccessRule `json:"tables,omitempty"`
+
+	// RefreshPeriod is how often the coordinator re-reads rules.json. Defaults to one minute.
+	// +optional
+	RefreshPeriod *metav1.Duration `json:"refreshPeriod,omitempty"`
+}
+
+// AccessRuleSubject selects who a rule applies to.
+type AccessRuleSubject struct {
+	// User is a pattern matched against the user.
+	// +optional
+	User string `json:"user,omitempty"`
+
+	// Role is a pattern matched against the roles of the user.
+	// +optional
+	Role string `json:"role,omitempty"`
+
+	// Group is a pattern matched against the groups of the user.
+	// +optional
+	Group string `json:"group,omitempty"`
+}
+
+// CatalogAccessRule sets the access to the catalogs it matches.
+type CatalogAccessRule struct {
+	AccessRuleSubject `json:",inline"`
+
+	// Catalog is a pattern matched against the catalog name.
+	// +optional
+	Catalog string `json:"catalog,omitempty"`
+
+	// Allow is the access granted.
+	// +kubebuilder:validation:Enum=all;read-only;none
+	Allow string `json:"allow"`
+}
+
+// SchemaAccessRule sets the ownership of the schemas it matches.
+type SchemaAccessRule struct {
+	AccessRuleSubject `json:",inline"`
+
+	// Catalog is a pattern matched against the catalog name.
+	// +optional
+	Catalog string `json:"catalog,omitempty"`
+
+	// Schema is a pattern matched against the schema name.
+	// +optional
+	Schema string `json:"schema,omitempty"`
+
+	// Owner grants ownership of the matched schemas.
+	Owner bool `json:"owner"`
+}
+
+// TableAccessRule sets the privileges on the tables it matches.
+type TableAccessRule struct {
+	AccessRuleSubject `json:",inline"`
+
+	// Catalog is a pattern matched against the catalog name.
+	// +optional
+	Catalog string `json:"catalog,omitempty"`
+
+	// Schema is a pattern matched against the schema name.
+	// +optional
+	Schema string `json:"schema,omitempty"`
+
+	// Table is a pattern matched against the table name.
+	// +optional
+	Table string `json:"table,omitempty"`
+
+	// Privileges granted on the matched tables. An empty list denies access.
+	Privileges []TablePrivilege `json:"privileges"`
+
+	// Filter is a row filter expression applied to queries on the matched tables.
+	// +optional
+	Filter string `json:"filter,omitempty"`
+}
+
+// TablePrivilege is a privilege on a table.
+// +kubebuilder:validation:Enum=SELECT;INSERT;DELETE;UPDATE;OWNERSHIP;GRANT_SELECT
+type TablePrivilege string
+
+// ResourceGroups is rendered into the resource-groups.json and
+// session-property-config.json files of the coordinator.
+type ResourceGroups struct {
+	// Groups are the resource groups. Sub-groups name their parent, so the
+	// groups without a parent are the root groups.
+	// +kubebuilder:validation:MinItems=1
+	Groups []ResourceGroup `json:"groups"`
+
+	// Selectors assign queries to leaf groups. The first matching selector wins.
+	// +optional
+	Selectors []ResourceGroupSelector `json:"selectors,omitempty"`
+
+	// SessionProperties set session property defaults for matching queries.
+	// Every matching rule applies, later rules overriding earlier ones.
+	// +optional
+	SessionProperties []SessionPropertyRule `json:"sessionProperties,omitempty"`
+}
+
+// ResourceGroup is a resource group of the coordinator.
+type ResourceGroup struct {
+	// Name of the group. It may contain the ${USER} and ${SOURCE} templates.
+	// +kubebuilder:validation:Pattern=`^([a-zA-Z0-9_-]|\$\{(USER|SOURCE)\})+$`
+	Name string `json:"name"`
+
+	// Parent is the dotted path of the parent group, for example global.adhoc.
+	// +optional
+	Parent string `json:"parent,omitempty"`
+
+	// SoftMemoryLimit is the memory the group may use before new queries
+	// queue, as a data size such as 10GB or as a percentage of the cluster memory.
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?(%|B|kB|MB|GB|TB|PB)$`
+	SoftMemoryLimit string `json:"softMemoryLimit"`
+
+	// HardConcurrencyLimit is the number of queries the group runs at once.
+	// +kubebuilder:validation:Minimum=0
+	HardConcurrencyLimit int32 `json:"hardConcurrencyLimit"`
+
+	// SoftConcurrencyLimit is the number of running queries above which the
+	// group is deprioritized among its siblings.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	SoftConcurrencyLimit *int32 `json:"softConcurrencyLimit,omitempty"`
+
+	// MaxQueued is the number of queries the group queues before rejecting new ones.
+	// +kubebuilder:validation:Minimum=0
+	MaxQueued int32 `json:"maxQueued"`
+
+	// SchedulingPolicy decides which sub-group runs the next query.
+	// +optional
+	// +kubebuilder:validation:Enum=fair;weighted;weighted_fair;query_priority
+	SchedulingPolicy string `json:"schedulingPolicy,omitempty"`
+
+	// SchedulingWeight of the group under a weighted parent.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	SchedulingWeight *int32 `json:"schedulingWeight,omitempty"`
+}
+
+// ResourceGroupSelector assigns the queries it matches to a group. Fields
+// left empty match every query.
+type ResourceGroupSelector struct {
+	// Group is the dotted path of a leaf group, for example global.adhoc.${USER}.
+	Group string `json:"group"`
+
+	// User is a regular expression matched against the user.
+	// +optional
+	User string `json:"user,omitempty"`
+
+	// UserGroup is a regular expression matched against the groups of the user.
+	// +optional
+	UserGroup string `json:"userGroup,omitempty"`
+
+	// Source is a regular expression matched against the query source.
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// QueryType matches the type of the query.
+	// +optional
+	// +kubebuilder:validation:Enum=SELECT;EXPLAIN;DESCRIBE;INSERT;UPDATE;DELETE;MERGE;ANALYZE;DATA_DEFINITION
+	QueryType string `json:"queryType,omitempty"`
+
+	// ClientTags must all be set on the query.
+	// +optional
+	ClientTags []string `json:"clientTags,omitempty"`
+}
+
+// SessionPropertyRule sets session properties on the queries it matches.
+// Fields left empty match every query.
+type SessionPropertyRule struct {
+	// Group is a regular expression matched against the dotted path of the
+	// group the query runs in.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// User is a regular expression matched against the user.
+	// +optional
+	User string `json:"user,omitempty"`
+
+	// Source is a regular expression matched against the query source.
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// QueryType matches the type of the query.
+	// +optional
+	// +kubebuilder:validation:Enum=SELECT;EXPLAIN;DESCRIBE;INSERT;UPDATE;DELETE;MERGE;ANALYZE;DATA_DEFINITION
+	QueryType string `json:"queryType,omitempty"`
+
+	// ClientTags must all be set on the query.
+	// +optional
+	ClientTags []string `json:"clientTags,omitempty"`
+
+	// SessionProperties are the properties to set, for example query_max_execution_time.
+	// +kubebuilder:validation:MinProperties=1
+	SessionProperties map[string]string `json:"sessionProperties"`
+}
+
+// Schedule scales the workers, and optionally the coordinator, to zero and
+// back on cron schedules. The managed alerts are suppressed while asleep.
+type Schedule struct {
+	// Sleep is the cron expression at which the cluster is scaled to zero,
+	// for example "0 19 * * 1-5".
+	Sleep string `json:"sleep"`
+
+	// Wake is the cron expression at which the cluster is scaled back up,
+	// for example "0 7 * * 1-5".
+	Wake string `json:"wake"`
+
+	// TimeZone is the IANA name of the time zone of Sleep and Wake. Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Workers is the worker count while awake. Required unless
+	// spec.autoscaling is set, which then decides the count while awake.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Workers *int32 `json:"workers,omitempty"`
+
+	// Coordinator also scales the coordinator to zero once the workers are gone.
+	// +optional
+	Coordinator bool `json:"coordinator,omitempty"`
+}
+
+// Autoscaling scales the workers between MinWorkers and MaxWorkers. When
+// several targets are set, the largest worker count any of them asks for wins.
+type Autoscaling struct {
+	// MinWorkers is the lowest worker count.
+	// +kubebuilder:validation:Minimum=0
+	MinWorkers int32 `json:"minWorkers"`
+
+	// MaxWorkers is the highest worker count. It is further capped by the
+	// number of nodes the Starburst license allows.
+	// +kubebuilder:validation:Minimum=1
+	MaxWorkers int32 `json:"maxWorkers"`
+
+	// TargetQueuedQueries adds a worker while more queries than this are
+	// queued on the coordinator, and removes one while none are queued.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	TargetQueuedQueries *int32 `json:"targetQueuedQueries,omitempty"`
+
+	// TargetCPUUtilization is the average worker CPU usage, in percent of the
+	// worker CPU request, to scale to. It is read from the managed
+	// Prometheus, so spec.metrics must be enabled.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	TargetCPUUtilization *int32 `json:"targetCPUUtilization,omitempty"`
+
+	// ScaleUpCooldown is the minimum time between a scaling change and a
+	// following scale-up. Defaults to 1m.
+	// +optional
+	ScaleUpCooldown *metav1.Duration `json:"scaleUpCooldown,omitempty"`
+
+	// ScaleDownCooldown is the minimum time between a scaling change and a
+	// following scale-down. Defaults to 10m.
+	// +optional
+	ScaleDownCooldown *metav1.Duration `json:"scaleDownCooldown,omitempty"`
+}
+
+// UpgradeSettings tune the staged rollout of a new Starburst Enterprise version.
+type UpgradeSettings struct {
+	// MaxRunningQueries is the highest number of running queries at which an
+	// upgrade may start. Defaults to 0.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxRunningQueries *int32 `json:"maxRunningQueries,omitempty"`
+
+	// CoordinatorReadyTimeout is how long the upgraded coordinator has to
+	// become ready before the previous version is restored. Defaults to 10m.
+	// +optional
+	CoordinatorReadyTimeout *metav1.Duration `json:"coordinatorReadyTimeout,omitempty"`
+}
+
+// MaintenanceWindow is a weekly recurring period.
+type MaintenanceWindow struct {
+	// Days the window opens on. Every day if empty.
+	// +optional
+	Days []Weekday `json:"days,omitempty"`
+
+	// Start is the time of day the window opens, as HH:MM.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+
+	// Duration of the window, at most a week.
+	Duration metav1.Duration `json:"duration"`
+
+	// TimeZone is the IANA name of the time zone Start is in. Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Weekday is a day of the week.
+// +kubebuilder:validation:Enum=Monday;Tuesday;Wednesday;Thursday;Friday;Saturday;Sunday
+type Weekday string
+
+// AlertThresholds are the values at which the managed alerts fire.
+type AlertThresholds struct {
+	// QueryMemory is the average query memory that triggers high_starburst_query_mem.
+	// +optional
+	QueryMemory *resource.Quantity `json:"queryMemory,omitempty"`
+
+	// HeapMemory is the used heap memory that triggers high_starburst_heap_mem.
+	// +optional
+	HeapMemory *resource.Quantity `json:"heapMemory,omitempty"`
+
+	// MaxQueryMemory is the max query memory that triggers high_starburst_max_query_mem.
+	// +optional
+	MaxQueryMemory *resource.Quantity `json:"maxQueryMemory,omitempty"`
+
+	// MaxHeapMemory is the max heap memory that triggers high_starburst_max_heap_mem.
+	// +optional
+	MaxHeapMemory *resource.Quantity `json:"maxHeapMemory,omitempty"`
+
+	// ActiveNodes fires trino_node_failure when the active node count drops to it.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	ActiveNodes *int32 `json:"activeNodes,omitempty"`
+
+	// ExpectedInstances is the number of metrics endpoints starburst_instance_down expects.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	ExpectedInstances *int32 `json:"expectedInstances,omitempty"`
+
+	// ThreadCount is the cluster wide thread count that triggers high_thread_count.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	ThreadCount *int32 `json:"threadCount,omitempty"`
+
+	// JVMMemoryPercent is the heap usage percentage that triggers JvmMemoryFillingUp.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	JVMMemoryPercent *int32 `json:"jvmMemoryPercent,omitempty"`
+
+	// FailedQueries is the failed query count that triggers starburst_failed_queries.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	FailedQueries *int32 `json:"failedQueries,omitempty"`
+}
+
+// RemoteWriteTarget is a remote write endpoint authenticated with OAuth2
+// client credentials.
+type RemoteWriteTarget struct {
+	// URL of the remote write endpoint.
+	URL string `json:"url"`
+
+	// TokenURL of the OAuth2 token endpoint.
+	TokenURL string `json:"tokenURL"`
+
+	// CredentialsSecret is the name of a Secret in the addon namespace with
+	// the client-id and client-secret keys.
+	CredentialsSecret string `json:"credentialsSecret"`
 }
 
 // StarburstAddonStatus defines the observed state of StarburstAddon
@@ -38,8 +816,187 @@ type StarburstAddonStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+
+	// Plan lists the changes the operator would make to the generated
+	// resources. It is only populated when the operator runs in plan mode.
+	// +optional
+	Plan []PlannedChange `json:"plan,omitempty"`
+
+	// Version reports the Starburst Enterprise version rollout.
+	// +optional
+	Version *VersionStatus `json:"version,omitempty"`
+
+	// Drain reports the workers a scale-down is removing.
+	// +optional
+	Drain *DrainStatus `json:"drain,omitempty"`
+
+	// Autoscaling reports the worker autoscaler.
+	// +optional
+	Autoscaling *AutoscalingStatus `json:"autoscaling,omitempty"`
+
+	// Schedule reports whether the cluster is asleep.
+	// +optional
+	Schedule *ScheduleStatus `json:"schedule,omitempty"`
+
+	// AccessControl reports the access control rules in use.
+	// +optional
+	AccessControl *AccessControlStatus `json:"accessControl,omitempty"`
+
+	// Endpoint is the URL clients reach the coordinator at when spec.expose is set.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// InternalTLS reports the node certificate when spec.internalTLS is set.
+	// +optional
+	InternalTLS *InternalTLSStatus `json:"internalTLS,omitempty"`
+
+	// PodSecurityViolations lists the workloads of the operand namespace whose
+	// pods do not meet the restricted pod security profile.
+	// +optional
+	PodSecurityViolations []PodSecurityViolation `json:"podSecurityViolations,omitempty"`
+}
+
+// PodSecurityViolation describes how the pods of a workload fall short of
+// the restricted pod security profile.
+type PodSecurityViolation struct {
+	// Workload owning the pods, as Kind/name.
+	Workload string `json:"workload"`
+
+	// Violations found, for example "container worker: runAsNonRoot is not true".
+	Violations []string `json:"violations"`
 }
 
+// InternalTLSStatus is the observed state of the node certificates.
+type InternalTLSStatus struct {
+	// Revision identifies the node certificate in use.
+	Revision string `json:"revision"`
+
+	// NotAfter is when the node certificate expires.
+	NotAfter metav1.Time `json:"notAfter"`
+
+	// RenewTime is when the node certificate will be renewed.
+	RenewTime metav1.Time `json:"renewTime"`
+}
+
+// AccessControlStatus is the observed state of the access control rules.
+type AccessControlStatus struct {
+	// Revision identifies the rules applied to the coordinator. It is a hash
+	// of the rendered rules.json.
+	Revision string `json:"revision"`
+
+	// LastUpdateTime is when Revision last changed.
+	// +optional
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// ScheduleStatus is the observed state of the sleep schedule.
+type ScheduleStatus struct {
+	// Asleep is true between a sleep and the following wake.
+	Asleep bool `json:"asleep"`
+
+	// LastTransitionTime is when the cluster last went to sleep or woke up.
+	// +optional
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// NextTransitionTime is when the cluster goes to sleep or wakes up next.
+	// +optional
+	NextTransitionTime *metav1.Time `json:"nextTransitionTime,omitempty"`
+}
+
+// AutoscalingStatus is the observed state of the worker autoscaler.
+type AutoscalingStatus struct {
+	// Workers is the worker count last set by the autoscaler.
+	// +optional
+	Workers int32 `json:"workers,omitempty"`
+
+	// QueuedQueries observed on the coordinator.
+	// +optional
+	QueuedQueries *int32 `json:"queuedQueries,omitempty"`
+
+	// CPUUtilization observed on the workers, in percent of their CPU request.
+	// +optional
+	CPUUtilization *int32 `json:"cpuUtilization,omitempty"`
+
+	// LastScaleTime is when the worker count was last changed.
+	// +optional
+	LastScaleTime *metav1.Time `json:"lastScaleTime,omitempty"`
+}
+
+// DrainStatus is the observed state of a scale-down removing workers in
+// batches.
+type DrainStatus struct {
+	// Pods of the current batch, shutting down.
+	// +optional
+	Pods []string `json:"pods,omitempty"`
+
+	// Replicas is the worker count of the current batch.
+	Replicas int32 `json:"replicas"`
+
+	// StartTime is when the current batch started.
+	StartTime metav1.Time `json:"startTime"`
+}
+
+// Phases of a version rollout.
+const (
+	VersionPhaseCoordinator = "UpgradingCoordinator"
+	VersionPhaseWorkers     = "UpgradingWorkers"
+	VersionPhaseRollback    = "RollingBack"
+)
+
+// VersionStatus is the observed state of a version rollout.
+type VersionStatus struct {
+	// Current is the version last rolled out to the coordinator and workers.
+	// +optional
+	Current string `json:"current,omitempty"`
+
+	// Target is the version being rolled out.
+	// +optional
+	Target string `json:"target,omitempty"`
+
+	// Phase of the rollout in progress, empty when idle.
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// PhaseStartTime is when the current phase started.
+	// +optional
+	PhaseStartTime *metav1.Time `json:"phaseStartTime,omitempty"`
+
+	// FailedVersion is the last version that was rolled back. It is not
+	// retried until spec.version changes.
+	// +optional
+	FailedVersion string `json:"failedVersion,omitempty"`
+}
+
+// PlannedChange is a change the operator would make to a generated resource.
+type PlannedChange struct {
+	// Action is one of Create, Patch or Delete.
+	// +kubebuilder:validation:Enum=Create;Patch;Delete
+	Action string `json:"action"`
+
+	// Kind of the generated resource.
+	Kind string `json:"kind"`
+
+	// Namespace of the generated resource, empty for cluster-scoped resources.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name of the generated resource.
+	Name string `json:"name"`
+}
+
+const (
+	// ConditionPaused is True while spec.paused stops reconciliation.
+	ConditionPaused = "Paused"
+
+	// ConditionMaintenanceWindow is True while a maintenance window is open
+	// and disruptive changes are deferred.
+	ConditionMaintenanceWindow = "MaintenanceWindow"
+
+	// ConditionFieldConflict is True when a generated resource could not be
+	// applied because another field manager owns some of its fields.
+	ConditionFieldConflict = "FieldConflict"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 
@@ -0,0 +1,87 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StarburstCatalogSpec defines the desired state of StarburstCatalog
+type StarburstCatalogSpec struct {
+	// Connector is the Trino connector of the catalog, for example hive,
+	// iceberg or postgresql. It is written as connector.name.
+	// +kubebuilder:validation:Pattern=`^[a-z][a-z0-9_-]*$`
+	Connector string `json:"connector"`
+
+	// Properties of the catalog, other than connector.name.
+	// +optional
+	Properties map[string]string `json:"properties,omitempty"`
+
+	// SecretProperties are properties whose values are read from Secrets in
+	// the namespace of the StarburstCatalog.
+	// +optional
+	SecretProperties []SecretProperty `json:"secretProperties,omitempty"`
+}
+
+// SecretProperty is a catalog property read from a Secret.
+type SecretProperty struct {
+	// Name of the catalog property, for example connection-password.
+	Name string `json:"name"`
+
+	// SecretKeyRef selects the key of the Secret holding the value.
+	SecretKeyRef corev1.SecretKeySelector `json:"secretKeyRef"`
+}
+
+// StarburstCatalogStatus defines the observed state of StarburstCatalog
+type StarburstCatalogStatus struct {
+	// Conditions of the catalog. Loaded is True once the coordinator serves it.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
+// ConditionLoaded is True when the coordinator lists the catalog.
+const ConditionLoaded = "Loaded"
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Connector",type=string,JSONPath=`.spec.connector`
+//+kubebuilder:printcolumn:name="Loaded",type=string,JSONPath=`.status.conditions[?(@.type=="Loaded")].status`
+
+// StarburstCatalog is the Schema for the starburstcatalogs API. Each catalog
+// in the operand namespace is added to the catalogs of the StarburstEnterprise,
+// named after the StarburstCatalog with dashes replaced by underscores.
+type StarburstCatalog struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   StarburstCatalogSpec   `json:"spec,omitempty"`
+	Status StarburstCatalogStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// StarburstCatalogList contains a list of StarburstCatalog
+type StarburstCatalogList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []StarburstCatalog `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&StarburstCatalog{}, &StarburstCatalogList{})
+}
@@ -22,16 +22,873 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessControl) DeepCopyInto(out *AccessControl) {
+	*out = *in
+	if in.Catalogs != nil {
+		in, out := &in.Catalogs, &out.Catalogs
+		*out = make([]CatalogAccessRule, len(*in))
+		copy(*out, *in)
+	}
+	if in.Schemas != nil {
+		in, out := &in.Schemas, &out.Schemas
+		*out = make([]SchemaAccessRule, len(*in))
+		copy(*out, *in)
+	}
+	if in.Tables != nil {
+		in, out := &in.Tables, &out.Tables
+		*out = make([]TableAccessRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RefreshPeriod != nil {
+		in, out := &in.RefreshPeriod, &out.RefreshPeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessControl.
+func (in *AccessControl) DeepCopy() *AccessControl {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessControl)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessControlStatus) DeepCopyInto(out *AccessControlStatus) {
+	*out = *in
+	if in.LastUpdateTime != nil {
+		in, out := &in.LastUpdateTime, &out.LastUpdateTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessControlStatus.
+func (in *AccessControlStatus) DeepCopy() *AccessControlStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessControlStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessRuleSubject) DeepCopyInto(out *AccessRuleSubject) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessRuleSubject.
+func (in *AccessRuleSubject) DeepCopy() *AccessRuleSubject {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessRuleSubject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AlertMatcher) DeepCopyInto(out *AlertMatcher) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AlertMatcher.
+func (in *AlertMatcher) DeepCopy() *AlertMatcher {
+	if in == nil {
+		return nil
+	}
+	out := new(AlertMatcher)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AlertReceiver) DeepCopyInto(out *AlertReceiver) {
+	*out = *in
+	if in.PagerDuty != nil {
+		in, out := &in.PagerDuty, &out.PagerDuty
+		*out = new(PagerDutyReceiver)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Slack != nil {
+		in, out := &in.Slack, &out.Slack
+		*out = new(SlackReceiver)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Email != nil {
+		in, out := &in.Email, &out.Email
+		*out = new(EmailReceiver)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AlertReceiver.
+func (in *AlertReceiver) DeepCopy() *AlertReceiver {
+	if in == nil {
+		return nil
+	}
+	out := new(AlertReceiver)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AlertRoute) DeepCopyInto(out *AlertRoute) {
+	*out = *in
+	if in.Matchers != nil {
+		in, out := &in.Matchers, &out.Matchers
+		*out = make([]AlertMatcher, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AlertRoute.
+func (in *AlertRoute) DeepCopy() *AlertRoute {
+	if in == nil {
+		return nil
+	}
+	out := new(AlertRoute)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AlertThresholds) DeepCopyInto(out *AlertThresholds) {
+	*out = *in
+	if in.QueryMemory != nil {
+		in, out := &in.QueryMemory, &out.QueryMemory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.HeapMemory != nil {
+		in, out := &in.HeapMemory, &out.HeapMemory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MaxQueryMemory != nil {
+		in, out := &in.MaxQueryMemory, &out.MaxQueryMemory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MaxHeapMemory != nil {
+		in, out := &in.MaxHeapMemory, &out.MaxHeapMemory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.ActiveNodes != nil {
+		in, out := &in.ActiveNodes, &out.ActiveNodes
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ExpectedInstances != nil {
+		in, out := &in.ExpectedInstances, &out.ExpectedInstances
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ThreadCount != nil {
+		in, out := &in.ThreadCount, &out.ThreadCount
+		*out = new(int32)
+		**out = **in
+	}
+	if in.JVMMemoryPercent != nil {
+		in, out := &in.JVMMemoryPercent, &out.JVMMemoryPercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedQueries != nil {
+		in, out := &in.FailedQueries, &out.FailedQueries
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AlertThresholds.
+func (in *AlertThresholds) DeepCopy() *AlertThresholds {
+	if in == nil {
+		return nil
+	}
+	out := new(AlertThresholds)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Alerting) DeepCopyInto(out *Alerting) {
+	*out = *in
+	if in.Receivers != nil {
+		in, out := &in.Receivers, &out.Receivers
+		*out = make([]AlertReceiver, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]AlertRoute, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.GroupBy != nil {
+		in, out := &in.GroupBy, &out.GroupBy
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Heartbeat != nil {
+		in, out := &in.Heartbeat, &out.Heartbeat
+		*out = new(Heartbeat)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Alerting.
+func (in *Alerting) DeepCopy() *Alerting {
+	if in == nil {
+		return nil
+	}
+	out := new(Alerting)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Authentication) DeepCopyInto(out *Authentication) {
+	*out = *in
+	if in.OAuth2 != nil {
+		in, out := &in.OAuth2, &out.OAuth2
+		*out = new(OAuth2Authentication)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LDAP != nil {
+		in, out := &in.LDAP, &out.LDAP
+		*out = new(LDAPAuthentication)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PasswordFile != nil {
+		in, out := &in.PasswordFile, &out.PasswordFile
+		*out = new(PasswordFileAuthentication)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Authentication.
+func (in *Authentication) DeepCopy() *Authentication {
+	if in == nil {
+		return nil
+	}
+	out := new(Authentication)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Autoscaling) DeepCopyInto(out *Autoscaling) {
+	*out = *in
+	if in.TargetQueuedQueries != nil {
+		in, out := &in.TargetQueuedQueries, &out.TargetQueuedQueries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetCPUUtilization != nil {
+		in, out := &in.TargetCPUUtilization, &out.TargetCPUUtilization
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ScaleUpCooldown != nil {
+		in, out := &in.ScaleUpCooldown, &out.ScaleUpCooldown
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ScaleDownCooldown != nil {
+		in, out := &in.ScaleDownCooldown, &out.ScaleDownCooldown
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Autoscaling.
+func (in *Autoscaling) DeepCopy() *Autoscaling {
+	if in == nil {
+		return nil
+	}
+	out := new(Autoscaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoscalingStatus) DeepCopyInto(out *AutoscalingStatus) {
+	*out = *in
+	if in.QueuedQueries != nil {
+		in, out := &in.QueuedQueries, &out.QueuedQueries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CPUUtilization != nil {
+		in, out := &in.CPUUtilization, &out.CPUUtilization
+		*out = new(int32)
+		**out = **in
+	}
+	if in.LastScaleTime != nil {
+		in, out := &in.LastScaleTime, &out.LastScaleTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalingStatus.
+func (in *AutoscalingStatus) DeepCopy() *AutoscalingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CatalogAccessRule) DeepCopyInto(out *CatalogAccessRule) {
+	*out = *in
+	out.AccessRuleSubject = in.AccessRuleSubject
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CatalogAccessRule.
+func (in *CatalogAccessRule) DeepCopy() *CatalogAccessRule {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogAccessRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DrainStatus) DeepCopyInto(out *DrainStatus) {
+	*out = *in
+	if in.Pods != nil {
+		in, out := &in.Pods, &out.Pods
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.StartTime.DeepCopyInto(&out.StartTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DrainStatus.
+func (in *DrainStatus) DeepCopy() *DrainStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DrainStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EmailReceiver) DeepCopyInto(out *EmailReceiver) {
+	*out = *in
+	if in.AuthPassword != nil {
+		in, out := &in.AuthPassword, &out.AuthPassword
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmailReceiver.
+func (in *EmailReceiver) DeepCopy() *EmailReceiver {
+	if in == nil {
+		return nil
+	}
+	out := new(EmailReceiver)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Expose) DeepCopyInto(out *Expose) {
+	*out = *in
+	if in.IngressClassName != nil {
+		in, out := &in.IngressClassName, &out.IngressClassName
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Expose.
+func (in *Expose) DeepCopy() *Expose {
+	if in == nil {
+		return nil
+	}
+	out := new(Expose)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Heartbeat) DeepCopyInto(out *Heartbeat) {
+	*out = *in
+	in.URL.DeepCopyInto(&out.URL)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Heartbeat.
+func (in *Heartbeat) DeepCopy() *Heartbeat {
+	if in == nil {
+		return nil
+	}
+	out := new(Heartbeat)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Images) DeepCopyInto(out *Images) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Images.
+func (in *Images) DeepCopy() *Images {
+	if in == nil {
+		return nil
+	}
+	out := new(Images)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InternalTLS) DeepCopyInto(out *InternalTLS) {
+	*out = *in
+	if in.CertificateDuration != nil {
+		in, out := &in.CertificateDuration, &out.CertificateDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InternalTLS.
+func (in *InternalTLS) DeepCopy() *InternalTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(InternalTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InternalTLSStatus) DeepCopyInto(out *InternalTLSStatus) {
+	*out = *in
+	in.NotAfter.DeepCopyInto(&out.NotAfter)
+	in.RenewTime.DeepCopyInto(&out.RenewTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InternalTLSStatus.
+func (in *InternalTLSStatus) DeepCopy() *InternalTLSStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(InternalTLSStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPAuthentication) DeepCopyInto(out *LDAPAuthentication) {
+	*out = *in
+	if in.BindPassword != nil {
+		in, out := &in.BindPassword, &out.BindPassword
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPAuthentication.
+func (in *LDAPAuthentication) DeepCopy() *LDAPAuthentication {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPAuthentication)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]Weekday, len(*in))
+		copy(*out, *in)
+	}
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicy) DeepCopyInto(out *NetworkPolicy) {
+	*out = *in
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedCIDRs != nil {
+		in, out := &in.AllowedCIDRs, &out.AllowedCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MonitoringNamespaces != nil {
+		in, out := &in.MonitoringNamespaces, &out.MonitoringNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.IngressNamespaceSelector != nil {
+		in, out := &in.IngressNamespaceSelector, &out.IngressNamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicy.
+func (in *NetworkPolicy) DeepCopy() *NetworkPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OAuth2Authentication) DeepCopyInto(out *OAuth2Authentication) {
+	*out = *in
+	in.ClientSecret.DeepCopyInto(&out.ClientSecret)
+	if in.Scopes != nil {
+		in, out := &in.Scopes, &out.Scopes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OAuth2Authentication.
+func (in *OAuth2Authentication) DeepCopy() *OAuth2Authentication {
+	if in == nil {
+		return nil
+	}
+	out := new(OAuth2Authentication)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PagerDutyReceiver) DeepCopyInto(out *PagerDutyReceiver) {
+	*out = *in
+	in.RoutingKey.DeepCopyInto(&out.RoutingKey)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PagerDutyReceiver.
+func (in *PagerDutyReceiver) DeepCopy() *PagerDutyReceiver {
+	if in == nil {
+		return nil
+	}
+	out := new(PagerDutyReceiver)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PasswordFileAuthentication) DeepCopyInto(out *PasswordFileAuthentication) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PasswordFileAuthentication.
+func (in *PasswordFileAuthentication) DeepCopy() *PasswordFileAuthentication {
+	if in == nil {
+		return nil
+	}
+	out := new(PasswordFileAuthentication)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlannedChange) DeepCopyInto(out *PlannedChange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlannedChange.
+func (in *PlannedChange) DeepCopy() *PlannedChange {
+	if in == nil {
+		return nil
+	}
+	out := new(PlannedChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSecurityViolation) DeepCopyInto(out *PodSecurityViolation) {
+	*out = *in
+	if in.Violations != nil {
+		in, out := &in.Violations, &out.Violations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSecurityViolation.
+func (in *PodSecurityViolation) DeepCopy() *PodSecurityViolation {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSecurityViolation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RemoteWriteTarget) DeepCopyInto(out *RemoteWriteTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RemoteWriteTarget.
+func (in *RemoteWriteTarget) DeepCopy() *RemoteWriteTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(RemoteWriteTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceGroup) DeepCopyInto(out *ResourceGroup) {
+	*out = *in
+	if in.SoftConcurrencyLimit != nil {
+		in, out := &in.SoftConcurrencyLimit, &out.SoftConcurrencyLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SchedulingWeight != nil {
+		in, out := &in.SchedulingWeight, &out.SchedulingWeight
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceGroup.
+func (in *ResourceGroup) DeepCopy() *ResourceGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceGroupSelector) DeepCopyInto(out *ResourceGroupSelector) {
+	*out = *in
+	if in.ClientTags != nil {
+		in, out := &in.ClientTags, &out.ClientTags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceGroupSelector.
+func (in *ResourceGroupSelector) DeepCopy() *ResourceGroupSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceGroupSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceGroups) DeepCopyInto(out *ResourceGroups) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]ResourceGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Selectors != nil {
+		in, out := &in.Selectors, &out.Selectors
+		*out = make([]ResourceGroupSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SessionProperties != nil {
+		in, out := &in.SessionProperties, &out.SessionProperties
+		*out = make([]SessionPropertyRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceGroups.
+func (in *ResourceGroups) DeepCopy() *ResourceGroups {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceGroups)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Schedule) DeepCopyInto(out *Schedule) {
+	*out = *in
+	if in.Workers != nil {
+		in, out := &in.Workers, &out.Workers
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Schedule.
+func (in *Schedule) DeepCopy() *Schedule {
+	if in == nil {
+		return nil
+	}
+	out := new(Schedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScheduleStatus) DeepCopyInto(out *ScheduleStatus) {
+	*out = *in
+	if in.LastTransitionTime != nil {
+		in, out := &in.LastTransitionTime, &out.LastTransitionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextTransitionTime != nil {
+		in, out := &in.NextTransitionTime, &out.NextTransitionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScheduleStatus.
+func (in *ScheduleStatus) DeepCopy() *ScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchemaAccessRule) DeepCopyInto(out *SchemaAccessRule) {
+	*out = *in
+	out.AccessRuleSubject = in.AccessRuleSubject
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchemaAccessRule.
+func (in *SchemaAccessRule) DeepCopy() *SchemaAccessRule {
+	if in == nil {
+		return nil
+	}
+	out := new(SchemaAccessRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretProperty) DeepCopyInto(out *SecretProperty) {
+	*out = *in
+	in.SecretKeyRef.DeepCopyInto(&out.SecretKeyRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretProperty.
+func (in *SecretProperty) DeepCopy() *SecretProperty {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretProperty)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SessionPropertyRule) DeepCopyInto(out *SessionPropertyRule) {
+	*out = *in
+	if in.ClientTags != nil {
+		in, out := &in.ClientTags, &out.ClientTags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SessionProperties != nil {
+		in, out := &in.SessionProperties, &out.SessionProperties
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SessionPropertyRule.
+func (in *SessionPropertyRule) DeepCopy() *SessionPropertyRule {
+	if in == nil {
+		return nil
+	}
+	out := new(SessionPropertyRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SlackReceiver) DeepCopyInto(out *SlackReceiver) {
+	*out = *in
+	in.WebhookURL.DeepCopyInto(&out.WebhookURL)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SlackReceiver.
+func (in *SlackReceiver) DeepCopy() *SlackReceiver {
+	if in == nil {
+		return nil
+	}
+	out := new(SlackReceiver)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StarburstAddon) DeepCopyInto(out *StarburstAddon) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -88,6 +945,88 @@ func (in *StarburstAddonList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StarburstAddonSpec) DeepCopyInto(out *StarburstAddonSpec) {
 	*out = *in
+	if in.AlertThresholds != nil {
+		in, out := &in.AlertThresholds, &out.AlertThresholds
+		*out = new(AlertThresholds)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RemoteWrite != nil {
+		in, out := &in.RemoteWrite, &out.RemoteWrite
+		*out = make([]RemoteWriteTarget, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = make([]MaintenanceWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(UpgradeSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.WorkerDrainDeadline != nil {
+		in, out := &in.WorkerDrainDeadline, &out.WorkerDrainDeadline
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxDrainingWorkers != nil {
+		in, out := &in.MaxDrainingWorkers, &out.MaxDrainingWorkers
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(Autoscaling)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(Schedule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResourceGroups != nil {
+		in, out := &in.ResourceGroups, &out.ResourceGroups
+		*out = new(ResourceGroups)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AccessControl != nil {
+		in, out := &in.AccessControl, &out.AccessControl
+		*out = new(AccessControl)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Expose != nil {
+		in, out := &in.Expose, &out.Expose
+		*out = new(Expose)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NetworkPolicy != nil {
+		in, out := &in.NetworkPolicy, &out.NetworkPolicy
+		*out = new(NetworkPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Authentication != nil {
+		in, out := &in.Authentication, &out.Authentication
+		*out = new(Authentication)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InternalTLS != nil {
+		in, out := &in.InternalTLS, &out.InternalTLS
+		*out = new(InternalTLS)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = new(Images)
+		**out = **in
+	}
+	if in.Alerting != nil {
+		in, out := &in.Alerting, &out.Alerting
+		*out = new(Alerting)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StarburstAddonSpec.
@@ -110,6 +1049,48 @@ func (in *StarburstAddonStatus) DeepCopyInto(out *StarburstAddonStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Plan != nil {
+		in, out := &in.Plan, &out.Plan
+		*out = make([]PlannedChange, len(*in))
+		copy(*out, *in)
+	}
+	if in.Version != nil {
+		in, out := &in.Version, &out.Version
+		*out = new(VersionStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Drain != nil {
+		in, out := &in.Drain, &out.Drain
+		*out = new(DrainStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(AutoscalingStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(ScheduleStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AccessControl != nil {
+		in, out := &in.AccessControl, &out.AccessControl
+		*out = new(AccessControlStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InternalTLS != nil {
+		in, out := &in.InternalTLS, &out.InternalTLS
+		*out = new(InternalTLSStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodSecurityViolations != nil {
+		in, out := &in.PodSecurityViolations, &out.PodSecurityViolations
+		*out = make([]PodSecurityViolation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StarburstAddonStatus.
@@ -121,3 +1102,178 @@ func (in *StarburstAddonStatus) DeepCopy() *StarburstAddonStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StarburstCatalog) DeepCopyInto(out *StarburstCatalog) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StarburstCatalog.
+func (in *StarburstCatalog) DeepCopy() *StarburstCatalog {
+	if in == nil {
+		return nil
+	}
+	out := new(StarburstCatalog)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *StarburstCatalog) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StarburstCatalogList) DeepCopyInto(out *StarburstCatalogList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]StarburstCatalog, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StarburstCatalogList.
+func (in *StarburstCatalogList) DeepCopy() *StarburstCatalogList {
+	if in == nil {
+		return nil
+	}
+	out := new(StarburstCatalogList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *StarburstCatalogList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StarburstCatalogSpec) DeepCopyInto(out *StarburstCatalogSpec) {
+	*out = *in
+	if in.Properties != nil {
+		in, out := &in.Properties, &out.Properties
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.SecretProperties != nil {
+		in, out := &in.SecretProperties, &out.SecretProperties
+		*out = make([]SecretProperty, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StarburstCatalogSpec.
+func (in *StarburstCatalogSpec) DeepCopy() *StarburstCatalogSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(StarburstCatalogSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StarburstCatalogStatus) DeepCopyInto(out *StarburstCatalogStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StarburstCatalogStatus.
+func (in *StarburstCatalogStatus) DeepCopy() *StarburstCatalogStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StarburstCatalogStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TableAccessRule) DeepCopyInto(out *TableAccessRule) {
+	*out = *in
+	out.AccessRuleSubject = in.AccessRuleSubject
+	if in.Privileges != nil {
+		in, out := &in.Privileges, &out.Privileges
+		*out = make([]TablePrivilege, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TableAccessRule.
+func (in *TableAccessRule) DeepCopy() *TableAccessRule {
+	if in == nil {
+		return nil
+	}
+	out := new(TableAccessRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpgradeSettings) DeepCopyInto(out *UpgradeSettings) {
+	*out = *in
+	if in.MaxRunningQueries != nil {
+		in, out := &in.MaxRunningQueries, &out.MaxRunningQueries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CoordinatorReadyTimeout != nil {
+		in, out := &in.CoordinatorReadyTimeout, &out.CoordinatorReadyTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpgradeSettings.
+func (in *UpgradeSettings) DeepCopy() *UpgradeSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(UpgradeSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VersionStatus) DeepCopyInto(out *VersionStatus) {
+	*out = *in
+	if in.PhaseStartTime != nil {
+		in, out := &in.PhaseStartTime, &out.PhaseStartTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VersionStatus.
+func (in *VersionStatus) DeepCopy() *VersionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VersionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
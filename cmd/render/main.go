@@ -0,0 +1,114 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// render prints every manifest the operator would create for a StarburstAddon,
+// without contacting a cluster. It is meant for reviewing operator upgrades in
+// CI and for reproducing customer configurations locally:
+//
+//	go run ./cmd/render --addon addon.yaml --parameters params.yaml --vault vault.yaml
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	configv1 "github.com/openshift/api/config/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+	"github.com/RHEcosystemAppEng/starburstaddon-operator/controllers"
+)
+
+func main() {
+	var addonFile, paramsFile, vaultFile, clusterID string
+	flag.StringVar(&addonFile, "addon", "", "StarburstAddon manifest to render.")
+	flag.StringVar(&paramsFile, "parameters", "", "addon-managed-starburst-parameters Secret manifest.")
+	flag.StringVar(&vaultFile, "vault", "", "addon vault Secret manifest.")
+	flag.StringVar(&clusterID, "cluster-id", "", "Cluster ID added as an external label by Prometheus.")
+	flag.Parse()
+
+	if err := run(addonFile, paramsFile, vaultFile, clusterID); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(addonFile, paramsFile, vaultFile, clusterID string) error {
+	if addonFile == "" {
+		return fmt.Errorf("--addon is required")
+	}
+
+	// Start from the CRD defaults, the API server is not there to apply them.
+	addon := &addonv1alpha1.StarburstAddon{
+		Spec: addonv1alpha1.StarburstAddonSpec{Metrics: true},
+	}
+	if err := readManifest(addonFile, addon); err != nil {
+		return err
+	}
+
+	in := controllers.RenderInputs{
+		ClusterVersion: &configv1.ClusterVersion{
+			Spec: configv1.ClusterVersionSpec{ClusterID: configv1.ClusterID(clusterID)},
+		},
+	}
+	var err error
+	if in.UserParams, err = readSecret(paramsFile); err != nil {
+		return err
+	}
+	if in.Vault, err = readSecret(vaultFile); err != nil {
+		return err
+	}
+
+	out, err := controllers.MarshalYAML(controllers.DeployAll(controllers.ResolveConfig(addon, in)))
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// readSecret reads a Secret manifest, folding stringData into data the way
+// the API server would. An empty path yields no secret.
+func readSecret(path string) (*corev1.Secret, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := readManifest(path, secret); err != nil {
+		return nil, err
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	for k, v := range secret.StringData {
+		secret.Data[k] = []byte(v)
+	}
+	return secret, nil
+}
+
+func readManifest(path string, obj interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %v", path, err)
+	}
+	if err := yaml.Unmarshal(data, obj); err != nil {
+		return fmt.Errorf("could not parse %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+const defaultAccessControlRefreshPeriod = time.Minute
+
+// renderAccessControl validates the patterns of spec and renders rules.json.
+func renderAccessControl(spec addonv1alpha1.AccessControl) (string, error) {
+	subject := func(s addonv1alpha1.AccessRuleSubject) []string {
+		return []string{s.User, s.Role, s.Group}
+	}
+	for i, rule := range spec.Catalogs {
+		if err := compilePatterns(fmt.Sprintf("catalog rule %d", i), append(subject(rule.AccessRuleSubject), rule.Catalog)...); err != nil {
+			return "", err
+		}
+	}
+	for i, rule := range spec.Schemas {
+		if err := compilePatterns(fmt.Sprintf("schema rule %d", i), append(subject(rule.AccessRuleSubject), rule.Catalog, rule.Schema)...); err != nil {
+			return "", err
+		}
+	}
+	for i, rule := range spec.Tables {
+		if err := compilePatterns(fmt.Sprintf("table rule %d", i), append(subject(rule.AccessRuleSubject), rule.Catalog, rule.Schema, rule.Table)...); err != nil {
+			return "", err
+		}
+		seen := map[addonv1alpha1.TablePrivilege]bool{}
+		for _, p := range rule.Privileges {
+			if seen[p] {
+				return "", fmt.Errorf("table rule %d lists privilege %s more than once", i, p)
+			}
+			seen[p] = true
+		}
+	}
+
+	rules, err := json.MarshalIndent(struct {
+		Catalogs []addonv1alpha1.CatalogAccessRule `json:"catalogs,omitempty"`
+		Schemas  []addonv1alpha1.SchemaAccessRule  `json:"schemas,omitempty"`
+		Tables   []addonv1alpha1.TableAccessRule   `json:"tables,omitempty"`
+	}{spec.Catalogs, spec.Schemas, spec.Tables}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("could not render access control rules: %v", err)
+	}
+	return string(rules), nil
+}
+
+// ruleRevision identifies a rendering of rules.json.
+func ruleRevision(rules string) string {
+	sum := sha256.Sum256([]byte(rules))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// accessControlComponent renders spec.accessControl into the rules.json of the
+// coordinator and reports its revision in status.accessControl. The
+// coordinator re-reads the file every refresh period.
+type accessControlComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *accessControlComponent) Name() string { return "AccessControl" }
+
+func (c *accessControlComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	spec := addon.Spec.AccessControl
+
+	var rules string
+	if spec != nil {
+		var err error
+		if rules, err = renderAccessControl(*spec); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	se, err := c.r.getStarburstEnterprise(ctx, Namespace)
+	if k8serrors.IsNotFound(err) && spec == nil {
+		addon.Status.AccessControl = nil
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Applying without the files drops them once spec.accessControl is removed.
+	patch := starburstEnterprisePatch(se)
+	if spec != nil {
+		refresh := defaultAccessControlRefreshPeriod
+		if spec.RefreshPeriod != nil {
+			refresh = spec.RefreshPeriod.Duration
+		}
+		setCoordinatorEtcFile(patch, "access-control", "rules.json", rules,
+			"access-control.name=file",
+			"security.config-file="+starburstEtc+"/rules.json",
+			fmt.Sprintf("security.refresh-period=%ds", int64(refresh.Seconds())))
+	}
+	if err := c.r.applyOperandPatch(ctx, addon, c.Name(), patch); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if c.r.Plan {
+		return ctrl.Result{}, nil
+	}
+	if spec == nil {
+		addon.Status.AccessControl = nil
+		return ctrl.Result{}, nil
+	}
+	revision := ruleRevision(rules)
+	if addon.Status.AccessControl == nil || addon.Status.AccessControl.Revision != revision {
+		log.FromContext(ctx).Info("Applied access control rules", "revision", revision)
+		now := metav1.Now()
+		addon.Status.AccessControl = &addonv1alpha1.AccessControlStatus{Revision: revision, LastUpdateTime: &now}
+	}
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+func TestRenderAccessControl(t *testing.T) {
+	spec := addonv1alpha1.AccessControl{
+		Catalogs: []addonv1alpha1.CatalogAccessRule{
+			{AccessRuleSubject: addonv1alpha1.AccessRuleSubject{Group: "admins"}, Allow: "all"},
+			{Catalog: "sales_db", Allow: "read-only"},
+		},
+		Tables: []addonv1alpha1.TableAccessRule{
+			{Catalog: "sales_db", Table: "orders", Privileges: []addonv1alpha1.TablePrivilege{"SELECT"}, Filter: "region = 'EU'"},
+			{Privileges: []addonv1alpha1.TablePrivilege{}},
+		},
+	}
+	rules, err := renderAccessControl(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{
+  "catalogs": [
+    {
+      "group": "admins",
+      "allow": "all"
+    },
+    {
+      "catalog": "sales_db",
+      "allow": "read-only"
+    }
+  ],
+  "tables": [
+    {
+      "catalog": "sales_db",
+      "table": "orders",
+      "privileges": [
+        "SELECT"
+      ],
+      "filter": "region = 'EU'"
+    },
+    {
+      "privileges": []
+    }
+  ]
+}`
+	if rules != want {
+		t.Errorf("rules =\n%s\nwant\n%s", rules, want)
+	}
+	if len(ruleRevision(rules)) != 12 || ruleRevision(rules) != ruleRevision(want) {
+		t.Errorf("ruleRevision is not a stable 12 character hash: %s", ruleRevision(rules))
+	}
+}
+
+func TestRenderAccessControlInvalid(t *testing.T) {
+	cases := map[string]addonv1alpha1.AccessControl{
+		"invalid user pattern": {Catalogs: []addonv1alpha1.CatalogAccessRule{
+			{AccessRuleSubject: addonv1alpha1.AccessRuleSubject{User: "[a-"}, Allow: "all"},
+		}},
+		"invalid schema pattern": {Schemas: []addonv1alpha1.SchemaAccessRule{{Schema: "(", Owner: true}}},
+		"duplicate privilege": {Tables: []addonv1alpha1.TableAccessRule{
+			{Privileges: []addonv1alpha1.TablePrivilege{"SELECT", "SELECT"}},
+		}},
+	}
+
+	for name, spec := range cases {
+		if _, err := renderAccessControl(spec); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
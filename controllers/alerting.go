@@ -0,0 +1,82 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// validateAlerting checks the references between the receivers and routes of
+// spec, which the schema cannot express.
+func validateAlerting(spec addonv1alpha1.Alerting) error {
+	receivers := map[string]bool{}
+	for _, r := range spec.Receivers {
+		if r.Name == heartbeatReceiver {
+			return fmt.Errorf("receiver name %s is reserved for spec.alerting.heartbeat", r.Name)
+		}
+		if receivers[r.Name] {
+			return fmt.Errorf("receiver %s is defined more than once", r.Name)
+		}
+		receivers[r.Name] = true
+		if r.PagerDuty == nil && r.Slack == nil && r.Email == nil {
+			return fmt.Errorf("receiver %s sets none of pagerDuty, slack or email", r.Name)
+		}
+	}
+	if spec.DefaultReceiver != "" && !receivers[spec.DefaultReceiver] {
+		return fmt.Errorf("default receiver %s is not defined", spec.DefaultReceiver)
+	}
+	for i, route := range spec.Routes {
+		if !receivers[route.Receiver] {
+			return fmt.Errorf("route %d: receiver %s is not defined", i, route.Receiver)
+		}
+		for _, m := range route.Matchers {
+			if m.Regex {
+				if err := compilePatterns(fmt.Sprintf("route %d", i), m.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// alertingComponent deploys the Alertmanager of spec.alerting that the
+// managed Prometheus sends its alerts to.
+type alertingComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *alertingComponent) Name() string { return "Alerting" }
+
+func (c *alertingComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	cfg := ResolveConfig(addon, RenderInputs{})
+	if addon.Spec.Alerting != nil && !addon.Spec.Metrics {
+		return ctrl.Result{}, fmt.Errorf("spec.alerting needs spec.metrics")
+	}
+	if cfg.Alerting == nil {
+		return ctrl.Result{}, c.r.deleteAll(ctx, addon, DeployAlertmanagerObjects(cfg)...)
+	}
+	if err := validateAlerting(*cfg.Alerting); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, c.r.applyAll(ctx, addon, DeployAlertmanagerObjects(cfg)...)
+}
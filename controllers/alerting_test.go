@@ -0,0 +1,106 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"testing"
+
+	promv1alpha1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+func TestValidateAlerting(t *testing.T) {
+	slack := &addonv1alpha1.SlackReceiver{WebhookURL: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "slack"}, Key: "url"}}
+	receivers := []addonv1alpha1.AlertReceiver{{Name: "team", Slack: slack}}
+
+	cases := []struct {
+		name  string
+		spec  addonv1alpha1.Alerting
+		valid bool
+	}{
+		{"receiver only", addonv1alpha1.Alerting{Receivers: receivers}, true},
+		{"reserved receiver name", addonv1alpha1.Alerting{Receivers: []addonv1alpha1.AlertReceiver{{Name: heartbeatReceiver, Slack: slack}}}, false},
+		{"duplicate receiver", addonv1alpha1.Alerting{Receivers: append(receivers, receivers...)}, false},
+		{"receiver without integration", addonv1alpha1.Alerting{Receivers: []addonv1alpha1.AlertReceiver{{Name: "team"}}}, false},
+		{"unknown default receiver", addonv1alpha1.Alerting{Receivers: receivers, DefaultReceiver: "other"}, false},
+		{"unknown route receiver", addonv1alpha1.Alerting{Receivers: receivers, Routes: []addonv1alpha1.AlertRoute{
+			{Receiver: "other", Matchers: []addonv1alpha1.AlertMatcher{{Name: "severity", Value: "critical"}}}}}, false},
+		{"invalid regex matcher", addonv1alpha1.Alerting{Receivers: receivers, Routes: []addonv1alpha1.AlertRoute{
+			{Receiver: "team", Matchers: []addonv1alpha1.AlertMatcher{{Name: "alertname", Value: "(", Regex: true}}}}}, false},
+	}
+	for _, tc := range cases {
+		if err := validateAlerting(tc.spec); (err == nil) != tc.valid {
+			t.Errorf("%s: validateAlerting() = %v, want valid %v", tc.name, err, tc.valid)
+		}
+	}
+}
+
+func TestDeployAlertmanagerConfigHeartbeat(t *testing.T) {
+	url := corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "snitch"}, Key: "url"}
+	cfg := RenderConfig{Name: "starburst", Namespace: Namespace, Alerting: &addonv1alpha1.Alerting{
+		Receivers: []addonv1alpha1.AlertReceiver{{Name: "team", Slack: &addonv1alpha1.SlackReceiver{WebhookURL: url}}},
+		Heartbeat: &addonv1alpha1.Heartbeat{URL: url, Interval: "1m"},
+	}}
+
+	spec := DeployAlertmanagerConfig(cfg).Spec
+	heartbeat := spec.Receivers[len(spec.Receivers)-1]
+	if heartbeat.Name != heartbeatReceiver || len(heartbeat.WebhookConfigs) != 1 || *heartbeat.WebhookConfigs[0].URLSecret != url {
+		t.Errorf("heartbeat receiver = %+v, want a webhook to %+v", heartbeat, url)
+	}
+	var watchdog promv1alpha1.Route
+	if err := json.Unmarshal(spec.Route.Routes[0].Raw, &watchdog); err != nil {
+		t.Fatal(err)
+	}
+	if watchdog.RepeatInterval != "1m" {
+		t.Errorf("Watchdog repeat interval = %s, want 1m", watchdog.RepeatInterval)
+	}
+}
+
+func TestDeployAlertmanagerConfigRoutes(t *testing.T) {
+	slack := &addonv1alpha1.SlackReceiver{WebhookURL: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "slack"}, Key: "url"}}
+	cfg := RenderConfig{Name: "starburst", Namespace: Namespace, Alerting: &addonv1alpha1.Alerting{
+		Receivers: []addonv1alpha1.AlertReceiver{{Name: "first", Slack: slack}, {Name: "second", Slack: slack}},
+		Routes: []addonv1alpha1.AlertRoute{
+			{Receiver: "second", Matchers: []addonv1alpha1.AlertMatcher{{Name: "alertname", Value: "Trino.*", Regex: true}}},
+		},
+	}}
+
+	route := DeployAlertmanagerConfig(cfg).Spec.Route
+	if route.Receiver != "first" {
+		t.Errorf("default receiver = %s, want the first receiver", route.Receiver)
+	}
+	if len(route.Routes) != 2 {
+		t.Fatalf("got %d child routes, want the Watchdog route and 1", len(route.Routes))
+	}
+	var watchdog, child promv1alpha1.Route
+	if err := json.Unmarshal(route.Routes[0].Raw, &watchdog); err != nil {
+		t.Fatal(err)
+	}
+	if watchdog.Receiver != heartbeatReceiver || watchdog.Continue || watchdog.RepeatInterval != defaultHeartbeatInterval {
+		t.Errorf("first route = %+v, want the Watchdog sent only to %s every %s", watchdog, heartbeatReceiver, defaultHeartbeatInterval)
+	}
+	if err := json.Unmarshal(route.Routes[1].Raw, &child); err != nil {
+		t.Fatal(err)
+	}
+	want := promv1alpha1.Matcher{Name: "alertname", Value: "Trino.*", MatchType: promv1alpha1.MatchRegexp}
+	if child.Receiver != "second" || len(child.Matchers) != 1 || child.Matchers[0] != want {
+		t.Errorf("child route = %+v, want receiver second matching %+v", child, want)
+	}
+}
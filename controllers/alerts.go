@@ -0,0 +1,217 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Severities of the managed alerts, set in their severity label so that
+// Alertmanager routes can match on them.
+const (
+	// severityCritical needs someone to act now.
+	severityCritical = "critical"
+	// severityWarning needs attention within working hours.
+	severityWarning = "warning"
+	// severityInfo is informational only.
+	severityInfo = "info"
+	// severityNone is for the Watchdog, which is not a problem.
+	severityNone = "none"
+)
+
+// defaultRunbookBaseURL holds a section per managed alert.
+const defaultRunbookBaseURL = "https://github.com/RHEcosystemAppEng/starburstaddon-operator/blob/main/RUNBOOKS.md"
+
+// Rule groups of the managed alerts.
+const (
+	// operandAlertGroup alerts on the operand and is dropped while the
+	// cluster is asleep.
+	operandAlertGroup = "starburst_alert_rules"
+	// monitoringAlertGroup alerts on the monitoring pipeline itself.
+	monitoringAlertGroup = "starburst_monitoring_rules"
+)
+
+// alertDefinition is an entry of the alert catalog.
+type alertDefinition struct {
+	name        string
+	group       string
+	expr        string
+	forDuration string
+	severity    string
+	summary     string
+	description string
+}
+
+// alertCatalog lists the managed alerts with the thresholds of cfg.
+func alertCatalog(cfg RenderConfig) []alertDefinition {
+	t := cfg.Thresholds
+	return []alertDefinition{
+		{
+			name:        "high_starburst_query_mem",
+			group:       operandAlertGroup,
+			expr:        fmt.Sprintf("starburst_query_mem >= %d", t.QueryMemoryBytes),
+			forDuration: "5m",
+			severity:    severityCritical,
+			summary:     "High Query Memory",
+			description: "High average memory used by all queries over a given time period",
+		},
+		{
+			name:        "high_starburst_heap_mem",
+			group:       operandAlertGroup,
+			expr:        fmt.Sprintf("starburst_heap_mem >= %d", t.HeapMemoryBytes),
+			forDuration: "5m",
+			severity:    severityWarning,
+			summary:     "High Heap Memory",
+			description: "High amount of heap memory used by the JVMs across all cluster nodes",
+		},
+		{
+			name:        "high_starburst_max_query_mem",
+			group:       operandAlertGroup,
+			expr:        fmt.Sprintf("starburst_max_query_mem >= %d", t.MaxQueryMemoryBytes),
+			forDuration: "5m",
+			severity:    severityWarning,
+			summary:     "High Max Query Memory",
+			description: "The max amount of memory queries can use, bounded by the JVM heap, is above the threshold",
+		},
+		{
+			name:        "trino_node_failure",
+			group:       operandAlertGroup,
+			expr:        fmt.Sprintf("trino_active_nodes <= %d", t.ActiveNodes),
+			forDuration: "5m",
+			severity:    severityCritical,
+			summary:     "Trino node failure",
+			description: "An active trino node went down",
+		},
+		{
+			name:        "high_starburst_max_heap_mem",
+			group:       operandAlertGroup,
+			expr:        fmt.Sprintf("starburst_max_heap_mem >= %d", t.MaxHeapMemoryBytes),
+			forDuration: "5m",
+			severity:    severityInfo,
+			summary:     "High Max Heap Memory",
+			description: "The max amount of heap memory configured in the JVM aggregated across the entire cluster",
+		},
+		{
+			name:        "starburst_instance_down",
+			group:       operandAlertGroup,
+			expr:        fmt.Sprintf("count(up{endpoint=\"metrics\"}) != %d", t.ExpectedInstances),
+			forDuration: "5m",
+			severity:    severityCritical,
+			summary:     "Starburst instance down",
+			description: "The pods churned",
+		},
+		{
+			name:        "high_thread_count",
+			group:       operandAlertGroup,
+			expr:        fmt.Sprintf("sum(thread_count) > %d", t.ThreadCount),
+			forDuration: "5m",
+			severity:    severityCritical,
+			summary:     "High Thread Count",
+			description: "High Thread Count",
+		},
+		{
+			name:        "JvmMemoryFillingUp",
+			group:       operandAlertGroup,
+			expr:        fmt.Sprintf("(sum by (instance)(jvm_memory_bytes_used{area=\"heap\"}) / sum by (instance)(jvm_memory_bytes_max{area=\"heap\"})) * 100 > %d", t.JVMMemoryPercent),
+			forDuration: "2m",
+			severity:    severityCritical,
+			summary:     "JVM memory filling up (instance {{ $labels.instance }})",
+			description: fmt.Sprintf("JVM memory is filling up (> %d%%)\n  VALUE = {{ $value }}\n  LABELS = {{ $labels }}", t.JVMMemoryPercent),
+		},
+		{
+			name:        "starburst_failed_queries",
+			group:       operandAlertGroup,
+			expr:        fmt.Sprintf("failed_queries >= %d", t.FailedQueries),
+			forDuration: "5m",
+			severity:    severityCritical,
+			summary:     "Queries are failing",
+			description: "In the last 5 mins the failed queries have risen",
+		},
+		{
+			name:        "Watchdog",
+			group:       monitoringAlertGroup,
+			expr:        "vector(1)",
+			severity:    severityNone,
+			summary:     "Alerting pipeline heartbeat",
+			description: "Always firing, so that its absence at the heartbeat receiver or in the remote-written ALERTS series shows the monitoring pipeline is broken",
+		},
+		{
+			name:        "PrometheusRemoteWriteFailing",
+			group:       monitoringAlertGroup,
+			expr:        "(rate(prometheus_remote_storage_samples_failed_total{job=\"prometheus-operated\"}[5m]) / (rate(prometheus_remote_storage_samples_failed_total{job=\"prometheus-operated\"}[5m]) + rate(prometheus_remote_storage_samples_total{job=\"prometheus-operated\"}[5m]))) * 100 > 1",
+			forDuration: "15m",
+			severity:    severityCritical,
+			summary:     "Remote write is failing (remote {{ $labels.remote_name }})",
+			description: "{{ printf \"%.1f\" $value }}% of the samples could not be sent to {{ $labels.url }}",
+		},
+		{
+			name:        "PrometheusRuleEvaluationFailures",
+			group:       monitoringAlertGroup,
+			expr:        "increase(prometheus_rule_evaluation_failures_total{job=\"prometheus-operated\"}[5m]) > 0",
+			forDuration: "15m",
+			severity:    severityWarning,
+			summary:     "Rules fail to evaluate (group {{ $labels.rule_group }})",
+			description: "{{ printf \"%.0f\" $value }} rule evaluations failed in the last 5 minutes, their alerts may not fire",
+		},
+	}
+}
+
+// runbookURL links the section of the alert in the runbooks at base.
+func runbookURL(base, alert string) string {
+	return base + "#" + strings.ToLower(alert)
+}
+
+// alertRules renders the alerts of group. Every alert is labelled with the
+// operand namespace, which Alertmanager routes on and which expressions such
+// as vector(1) or count() do not carry, and with the cluster_id also added
+// by the external labels of Prometheus, so that the ALERTS series carry it.
+func alertRules(cfg RenderConfig, group string) []promv1.Rule {
+	base := cfg.RunbookBaseURL
+	if base == "" {
+		base = defaultRunbookBaseURL
+	}
+
+	var rules []promv1.Rule
+	for _, a := range alertCatalog(cfg) {
+		if a.group != group {
+			continue
+		}
+		labels := map[string]string{
+			"severity":  a.severity,
+			"namespace": cfg.Namespace,
+		}
+		if cfg.ClusterID != "" {
+			labels["cluster_id"] = cfg.ClusterID
+		}
+		rules = append(rules, promv1.Rule{
+			Alert:  a.name,
+			Expr:   intstr.FromString(a.expr),
+			For:    a.forDuration,
+			Labels: labels,
+			Annotations: map[string]string{
+				"summary":     a.summary,
+				"description": a.description,
+				"runbook_url": runbookURL(base, a.name),
+			},
+		})
+	}
+	return rules
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+func alertsOf(rules *promv1.PrometheusRule) []promv1.Rule {
+	var alerts []promv1.Rule
+	for _, g := range rules.Spec.Groups {
+		for _, r := range g.Rules {
+			if r.Alert != "" {
+				alerts = append(alerts, r)
+			}
+		}
+	}
+	return alerts
+}
+
+func TestAlertCatalogMetadata(t *testing.T) {
+	cfg := ResolveConfig(testAddon(addonv1alpha1.StarburstAddonSpec{Metrics: true}), testRenderInputs())
+	runbooks, err := os.ReadFile("../RUNBOOKS.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	severities := map[string]bool{severityCritical: true, severityWarning: true, severityInfo: true, severityNone: true}
+
+	alerts := alertsOf(DeployPrometheusRules(cfg))
+	if len(alerts) != len(alertCatalog(cfg)) {
+		t.Errorf("rendered %d alerts, want the %d of the catalog", len(alerts), len(alertCatalog(cfg)))
+	}
+	seen := map[string]bool{}
+	for _, a := range alerts {
+		if seen[a.Alert] {
+			t.Errorf("%s: defined more than once", a.Alert)
+		}
+		seen[a.Alert] = true
+
+		if !severities[a.Labels["severity"]] {
+			t.Errorf("%s: severity label %q, want one of critical, warning, info or none", a.Alert, a.Labels["severity"])
+		}
+		if a.Labels["namespace"] != Namespace {
+			t.Errorf("%s: namespace label %q, want %s", a.Alert, a.Labels["namespace"], Namespace)
+		}
+		if a.Labels["cluster_id"] != cfg.ClusterID || cfg.ClusterID == "" {
+			t.Errorf("%s: cluster_id label %q, want %q", a.Alert, a.Labels["cluster_id"], cfg.ClusterID)
+		}
+		if _, ok := a.Annotations["severity"]; ok {
+			t.Errorf("%s: severity is an annotation, want only the label", a.Alert)
+		}
+		for _, key := range []string{"summary", "description"} {
+			if a.Annotations[key] == "" {
+				t.Errorf("%s: no %s annotation", a.Alert, key)
+			}
+		}
+		if want := defaultRunbookBaseURL + "#" + strings.ToLower(a.Alert); a.Annotations["runbook_url"] != want {
+			t.Errorf("%s: runbook_url %q, want %q", a.Alert, a.Annotations["runbook_url"], want)
+		}
+		if !strings.Contains(string(runbooks), "\n## "+a.Alert+"\n") {
+			t.Errorf("%s: RUNBOOKS.md has no section for the alert", a.Alert)
+		}
+	}
+
+	for _, a := range alerts {
+		if a.Alert == "high_starburst_max_query_mem" && !strings.Contains(a.Annotations["summary"], "Max Query Memory") {
+			t.Errorf("high_starburst_max_query_mem: summary %q does not describe the max query memory", a.Annotations["summary"])
+		}
+	}
+}
+
+func TestAlertCatalogRunbookBaseURL(t *testing.T) {
+	cfg := ResolveConfig(testAddon(addonv1alpha1.StarburstAddonSpec{
+		Metrics:        true,
+		RunbookBaseURL: "https://wiki.example.com/starburst/alerts",
+	}), RenderInputs{})
+
+	for _, a := range alertsOf(DeployPrometheusRules(cfg)) {
+		if want := "https://wiki.example.com/starburst/alerts#" + strings.ToLower(a.Alert); a.Annotations["runbook_url"] != want {
+			t.Errorf("%s: runbook_url %q, want %q", a.Alert, a.Annotations["runbook_url"], want)
+		}
+		if _, ok := a.Labels["cluster_id"]; ok {
+			t.Errorf("%s: cluster_id label set without a ClusterVersion", a.Alert)
+		}
+	}
+}
+
+func TestAsleepRuleGroups(t *testing.T) {
+	cfg := ResolveConfig(testAddon(addonv1alpha1.StarburstAddonSpec{Metrics: true}), testRenderInputs())
+	cfg.Asleep = true
+
+	var names []string
+	for _, g := range DeployPrometheusRules(cfg).Spec.Groups {
+		names = append(names, g.Name)
+	}
+	if got, want := strings.Join(names, ","), "starburst_custom_rules,"+monitoringAlertGroup; got != want {
+		t.Errorf("rule groups while asleep are %s, want %s", got, want)
+	}
+}
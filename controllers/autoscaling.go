@@ -0,0 +1,294 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+const (
+	defaultScaleUpCooldown   = time.Minute
+	defaultScaleDownCooldown = 10 * time.Minute
+	autoscalingInterval      = 30 * time.Second
+
+	// cpuTolerance is the relative deviation from the CPU target that is
+	// ignored, so small fluctuations do not resize the cluster.
+	cpuTolerance = 0.1
+)
+
+// workerLoad is the load the autoscaler observed. Unset fields were not measured.
+type workerLoad struct {
+	QueuedQueries  *int32
+	CPUUtilization *int32
+}
+
+// desiredWorkers computes the worker count for the observed load: the largest
+// count any configured target asks for, within MinWorkers and maxWorkers.
+func desiredWorkers(spec addonv1alpha1.Autoscaling, current int32, load workerLoad, maxWorkers int32) int32 {
+	desired := spec.MinWorkers
+
+	if spec.TargetQueuedQueries != nil && load.QueuedQueries != nil {
+		queued := current
+		switch {
+		case *load.QueuedQueries > *spec.TargetQueuedQueries:
+			queued = current + 1
+		case current == 0 && *load.QueuedQueries > 0:
+			// Without workers nothing runs, so any queued query needs one.
+			queued = 1
+		case *load.QueuedQueries == 0:
+			queued = current - 1
+		}
+		if queued > desired {
+			desired = queued
+		}
+	}
+
+	if spec.TargetCPUUtilization != nil && load.CPUUtilization != nil && current > 0 {
+		cpu := current
+		ratio := float64(*load.CPUUtilization) / float64(*spec.TargetCPUUtilization)
+		if math.Abs(ratio-1) > cpuTolerance {
+			cpu = int32(math.Ceil(float64(current) * ratio))
+		}
+		if cpu > desired {
+			desired = cpu
+		}
+	}
+
+	if desired > maxWorkers {
+		desired = maxWorkers
+	}
+	if desired < 0 {
+		desired = 0
+	}
+	return desired
+}
+
+// workerReplicasPatch sets the worker count of se, along with the graceful
+// shutdown of the workers it removes.
+func workerReplicasPatch(se *unstructured.Unstructured, replicas int32, spec addonv1alpha1.StarburstAddonSpec) *unstructured.Unstructured {
+	patch := starburstEnterprisePatch(se)
+	_ = unstructured.SetNestedField(patch.Object, int64(replicas), "spec", "worker", "replicas")
+	setWorkerShutdown(patch, spec)
+	return patch
+}
+
+// scaleWorkers moves the worker count towards desired under the field manager
+// of component. Until a scale-down has removed its last batch of workers a
+// *pendingError is returned.
+func (r *StarburstAddonReconciler) scaleWorkers(ctx context.Context, addon *addonv1alpha1.StarburstAddon, component string, se *unstructured.Unstructured, desired int32) error {
+	replicas, done, err := r.workerReplicas(ctx, addon, desired)
+	if err != nil {
+		return err
+	}
+	if err := r.applyOperandPatch(ctx, addon, component, workerReplicasPatch(se, replicas, addon.Spec)); err != nil {
+		return err
+	}
+	if !done {
+		return &pendingError{
+			reason:  "DrainingWorkers",
+			message: fmt.Sprintf("Waiting for workers to finish their tasks before scaling down to %d", desired),
+		}
+	}
+	return nil
+}
+
+// autoscalingComponent sets the worker count of the StarburstEnterprise from
+// the queued queries on the coordinator and the worker CPU usage reported by
+// the managed Prometheus. Workers are removed in batches by a scale-down.
+type autoscalingComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *autoscalingComponent) Name() string { return "Autoscaling" }
+
+func (c *autoscalingComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	spec := addon.Spec.Autoscaling
+	if spec == nil {
+		addon.Status.Autoscaling = nil
+		return ctrl.Result{}, nil
+	}
+	switch {
+	case spec.MinWorkers > spec.MaxWorkers:
+		return ctrl.Result{}, fmt.Errorf("minWorkers %d is above maxWorkers %d", spec.MinWorkers, spec.MaxWorkers)
+	case spec.TargetQueuedQueries == nil && spec.TargetCPUUtilization == nil:
+		return ctrl.Result{}, fmt.Errorf("autoscaling needs targetQueuedQueries or targetCPUUtilization")
+	case spec.TargetCPUUtilization != nil && !addon.Spec.Metrics:
+		return ctrl.Result{}, fmt.Errorf("targetCPUUtilization needs spec.metrics to be enabled")
+	}
+
+	se, err := c.r.getStarburstEnterprise(ctx, Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	workers := &appsv1.Deployment{}
+	if err := c.r.Client.Get(ctx, types.NamespacedName{Name: workerDeployment, Namespace: Namespace}, workers); err != nil {
+		return ctrl.Result{}, fmt.Errorf("could not get Deployment %s: %w", workerDeployment, err)
+	}
+
+	// Plan mode reports the next step without recording it.
+	if c.r.Plan {
+		autoscaling, drain := addon.Status.Autoscaling.DeepCopy(), addon.Status.Drain.DeepCopy()
+		defer func() { addon.Status.Autoscaling, addon.Status.Drain = autoscaling, drain }()
+	}
+
+	status := addon.Status.Autoscaling
+	if status == nil {
+		status = &addonv1alpha1.AutoscalingStatus{Workers: 1}
+		if workers.Spec.Replicas != nil {
+			status.Workers = *workers.Spec.Replicas
+		}
+		addon.Status.Autoscaling = status
+	}
+
+	// The worker count is held while a maintenance window is open.
+	if result, err := deferDuringMaintenance(addon, "Autoscaling"); err != nil {
+		return result, err
+	}
+
+	// The schedule decides while the cluster is asleep.
+	if addon.Status.Schedule != nil && addon.Status.Schedule.Asleep {
+		return c.scaleTo(ctx, addon, se, 0)
+	}
+
+	load, err := c.observe(ctx, spec, workers)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	status.QueuedQueries, status.CPUUtilization = load.QueuedQueries, load.CPUUtilization
+
+	maxWorkers, err := c.licensedMaxWorkers(ctx, addon)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	desired := desiredWorkers(*spec, status.Workers, load, maxWorkers)
+	if desired != status.Workers && c.coolingDown(spec, status, desired) {
+		desired = status.Workers
+	}
+
+	return c.scaleTo(ctx, addon, se, desired)
+}
+
+// scaleTo moves the workers to desired and records the change.
+func (c *autoscalingComponent) scaleTo(ctx context.Context, addon *addonv1alpha1.StarburstAddon, se *unstructured.Unstructured, desired int32) (ctrl.Result, error) {
+	status := addon.Status.Autoscaling
+	if err := c.r.scaleWorkers(ctx, addon, c.Name(), se, desired); err != nil {
+		return ctrl.Result{RequeueAfter: rolloutPollInterval}, err
+	}
+	if desired != status.Workers {
+		log.FromContext(ctx).Info("Scaling workers", "from", status.Workers, "to", desired)
+		now := metav1.Now()
+		status.Workers = desired
+		status.LastScaleTime = &now
+	}
+	return ctrl.Result{RequeueAfter: autoscalingInterval}, nil
+}
+
+// observe measures the load every configured target depends on.
+func (c *autoscalingComponent) observe(ctx context.Context, spec *addonv1alpha1.Autoscaling, workers *appsv1.Deployment) (workerLoad, error) {
+	var load workerLoad
+
+	if spec.TargetQueuedQueries != nil {
+		states, err := c.r.trino(ctx).queryStates(ctx, coordinatorURL(Namespace))
+		if err != nil {
+			return load, err
+		}
+		queued := int32(states["QUEUED"])
+		load.QueuedQueries = &queued
+	}
+
+	// Without running workers there is no CPU usage to measure, and the queue
+	// alone decides whether to start one.
+	if spec.TargetCPUUtilization != nil && workers.Status.Replicas > 0 {
+		containers := workers.Spec.Template.Spec.Containers
+		if len(containers) == 0 || containers[0].Resources.Requests.Cpu().IsZero() {
+			return load, fmt.Errorf("targetCPUUtilization needs a CPU request on the workers")
+		}
+		cores, err := queryPrometheus(ctx, prometheusURL(Namespace), fmt.Sprintf(
+			`avg(rate(process_cpu_seconds_total{namespace=%q,pod=~"%s-.*"}[2m]))`, Namespace, workerDeployment))
+		if errors.Is(err, errNoSamples) {
+			// Workers that just started have not been scraped yet.
+			return load, nil
+		}
+		if err != nil {
+			return load, err
+		}
+		utilization := int32(math.Round(cores / containers[0].Resources.Requests.Cpu().AsApproximateFloat64() * 100))
+		load.CPUUtilization = &utilization
+	}
+
+	return load, nil
+}
+
+// licensedMaxWorkers caps MaxWorkers by the node count of the license, read
+// from the starburst-licensed-nodes key of the parameters secret. The
+// coordinator takes one licensed node.
+func (c *autoscalingComponent) licensedMaxWorkers(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (int32, error) {
+	maxWorkers := addon.Spec.Autoscaling.MaxWorkers
+
+	userParams, err := c.r.getSecret(ctx, "addon-managed-starburst-parameters", addon.Namespace)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := userParams.Data["starburst-licensed-nodes"]
+	if !ok {
+		return maxWorkers, nil
+	}
+	nodes, err := strconv.ParseInt(strings.TrimSpace(string(value)), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid starburst-licensed-nodes: %v", err)
+	}
+	if licensed := int32(nodes) - 1; licensed < maxWorkers {
+		maxWorkers = licensed
+	}
+	return maxWorkers, nil
+}
+
+// coolingDown reports whether the last scaling change is too recent to move
+// to desired.
+func (c *autoscalingComponent) coolingDown(spec *addonv1alpha1.Autoscaling, status *addonv1alpha1.AutoscalingStatus, desired int32) bool {
+	if status.LastScaleTime == nil {
+		return false
+	}
+
+	cooldown := defaultScaleUpCooldown
+	if spec.ScaleUpCooldown != nil {
+		cooldown = spec.ScaleUpCooldown.Duration
+	}
+	if desired < status.Workers {
+		cooldown = defaultScaleDownCooldown
+		if spec.ScaleDownCooldown != nil {
+			cooldown = spec.ScaleDownCooldown.Duration
+		}
+	}
+	return time.Since(status.LastScaleTime.Time) < cooldown
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+func TestDesiredWorkers(t *testing.T) {
+	queued := addonv1alpha1.Autoscaling{MinWorkers: 1, MaxWorkers: 10, TargetQueuedQueries: int32Ptr(5)}
+	cpu := addonv1alpha1.Autoscaling{MinWorkers: 1, MaxWorkers: 10, TargetCPUUtilization: int32Ptr(60)}
+	fromZero := addonv1alpha1.Autoscaling{MinWorkers: 0, MaxWorkers: 10, TargetQueuedQueries: int32Ptr(5)}
+	both := addonv1alpha1.Autoscaling{MinWorkers: 1, MaxWorkers: 10, TargetQueuedQueries: int32Ptr(5), TargetCPUUtilization: int32Ptr(60)}
+	bothFromZero := addonv1alpha1.Autoscaling{MinWorkers: 0, MaxWorkers: 10, TargetQueuedQueries: int32Ptr(5), TargetCPUUtilization: int32Ptr(60)}
+
+	cases := []struct {
+		name       string
+		spec       addonv1alpha1.Autoscaling
+		current    int32
+		load       workerLoad
+		maxWorkers int32
+		want       int32
+	}{
+		{"queue above target", queued, 3, workerLoad{QueuedQueries: int32Ptr(8)}, 10, 4},
+		{"queue within target", queued, 3, workerLoad{QueuedQueries: int32Ptr(2)}, 10, 3},
+		{"queue empty", queued, 3, workerLoad{QueuedQueries: int32Ptr(0)}, 10, 2},
+		{"queue empty at min", queued, 1, workerLoad{QueuedQueries: int32Ptr(0)}, 10, 1},
+		{"queue within target from zero", fromZero, 0, workerLoad{QueuedQueries: int32Ptr(2)}, 10, 1},
+		{"queue empty at zero", fromZero, 0, workerLoad{QueuedQueries: int32Ptr(0)}, 10, 0},
+		{"cpu above target", cpu, 4, workerLoad{CPUUtilization: int32Ptr(90)}, 10, 6},
+		{"cpu within tolerance", cpu, 4, workerLoad{CPUUtilization: int32Ptr(63)}, 10, 4},
+		{"cpu below target", cpu, 4, workerLoad{CPUUtilization: int32Ptr(15)}, 10, 1},
+		{"queue from zero without cpu", bothFromZero, 0, workerLoad{QueuedQueries: int32Ptr(2)}, 10, 1},
+		{"largest target wins", both, 4, workerLoad{QueuedQueries: int32Ptr(0), CPUUtilization: int32Ptr(90)}, 10, 6},
+		{"capped by max", cpu, 8, workerLoad{CPUUtilization: int32Ptr(100)}, 10, 10},
+		{"capped by license", cpu, 4, workerLoad{CPUUtilization: int32Ptr(90)}, 5, 5},
+	}
+
+	for _, tc := range cases {
+		if got := desiredWorkers(tc.spec, tc.current, tc.load, tc.maxWorkers); got != tc.want {
+			t.Errorf("%s: got %d workers, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestObserveWithoutWorkers(t *testing.T) {
+	c := &autoscalingComponent{&StarburstAddonReconciler{}}
+	spec := &addonv1alpha1.Autoscaling{MinWorkers: 0, MaxWorkers: 10, TargetCPUUtilization: int32Ptr(60)}
+	workers := &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")}},
+		}}}}},
+	}
+
+	// Prometheus is unreachable here, so this fails if it is queried.
+	load, err := c.observe(context.Background(), spec, workers)
+	if err != nil {
+		t.Fatalf("observe: %v", err)
+	}
+	if load.CPUUtilization != nil {
+		t.Errorf("got CPU utilization %d without workers, want none", *load.CPUUtilization)
+	}
+}
+
+func TestLicensedMaxWorkers(t *testing.T) {
+	cases := []struct {
+		name    string
+		nodes   string
+		want    int32
+		wantErr bool
+	}{
+		{"below maxWorkers", "5", 4, false},
+		{"above maxWorkers", "20", 10, false},
+		{"trailing newline", "5\n", 4, false},
+		{"invalid", "five", 0, true},
+	}
+
+	for _, tc := range cases {
+		params := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "addon-managed-starburst-parameters", Namespace: Namespace},
+			Data:       map[string][]byte{"starburst-licensed-nodes": []byte(tc.nodes)},
+		}
+		c := &autoscalingComponent{&StarburstAddonReconciler{Client: fake.NewClientBuilder().WithObjects(params).Build()}}
+		addon := testAddon(addonv1alpha1.StarburstAddonSpec{Autoscaling: &addonv1alpha1.Autoscaling{MaxWorkers: 10}})
+
+		got, err := c.licensedMaxWorkers(context.Background(), addon)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tc.name, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %d workers, want %d", tc.name, got, tc.want)
+		}
+	}
+}
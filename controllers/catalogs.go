@@ -0,0 +1,312 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// jdbcConnectors maps the JDBC connectors to the prefix of their connection-url.
+var jdbcConnectors = map[string]string{
+	"mysql":      "jdbc:mysql:",
+	"oracle":     "jdbc:oracle:",
+	"postgresql": "jdbc:postgresql:",
+	"redshift":   "jdbc:redshift:",
+	"sqlserver":  "jdbc:sqlserver:",
+}
+
+// catalogName is the Trino name of the catalog defined by a StarburstCatalog.
+func catalogName(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// validateCatalog checks that a catalog has the properties its connector needs
+// to start. Connectors not known here only get the generic checks; Trino
+// reports anything else when it loads the catalog.
+func validateCatalog(name string, spec addonv1alpha1.StarburstCatalogSpec) error {
+	if strings.Contains(name, ".") {
+		return fmt.Errorf("catalog name %q must not contain dots", name)
+	}
+
+	has := map[string]bool{}
+	for key, value := range spec.Properties {
+		if strings.ContainsAny(key+value, "\r\n") {
+			return fmt.Errorf("property %q must fit on one line", key)
+		}
+		has[key] = true
+	}
+	for _, p := range spec.SecretProperties {
+		if has[p.Name] {
+			return fmt.Errorf("property %q is set more than once", p.Name)
+		}
+		has[p.Name] = true
+	}
+	if has["connector.name"] {
+		return fmt.Errorf("connector.name is set from spec.connector")
+	}
+
+	var required []string
+	switch spec.Connector {
+	case "hive", "delta_lake", "hudi":
+		if spec.Properties["hive.metastore"] != "glue" {
+			required = append(required, "hive.metastore.uri")
+		}
+	case "iceberg":
+		switch catalogType := spec.Properties["iceberg.catalog.type"]; catalogType {
+		case "", "hive_metastore":
+			required = append(required, "hive.metastore.uri")
+		case "glue":
+		case "jdbc":
+			required = append(required, "iceberg.jdbc-catalog.connection-url")
+		case "nessie":
+			required = append(required, "iceberg.nessie-catalog.uri")
+		case "rest":
+			required = append(required, "iceberg.rest-catalog.uri")
+		default:
+			return fmt.Errorf("unknown iceberg.catalog.type %q", catalogType)
+		}
+	default:
+		if prefix, ok := jdbcConnectors[spec.Connector]; ok {
+			required = append(required, "connection-url")
+			url, ok := spec.Properties["connection-url"]
+			if ok && !strings.HasPrefix(url, prefix) && !strings.HasPrefix(url, "${secret:") {
+				return fmt.Errorf("connection-url of a %s catalog must start with %s", spec.Connector, prefix)
+			}
+		}
+	}
+	for _, key := range required {
+		if !has[key] {
+			return fmt.Errorf("%s catalogs need the %s property", spec.Connector, key)
+		}
+	}
+	return nil
+}
+
+// renderCatalog writes the catalog properties file the chart expects, with
+// the references to the values read from secrets merged in.
+func renderCatalog(spec addonv1alpha1.StarburstCatalogSpec, secretRefs map[string]string) string {
+	properties := map[string]string{}
+	for key, value := range spec.Properties {
+		properties[key] = value
+	}
+	for key, ref := range secretRefs {
+		properties[key] = ref
+	}
+
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := []string{"connector.name=" + spec.Connector}
+	for _, key := range keys {
+		lines = append(lines, key+"="+properties[key])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resolveSecretProperties reads the secret properties of catalog and the
+// properties with secret placeholders in their value. Errors never carry the
+// values.
+func (r *StarburstAddonReconciler) resolveSecretProperties(ctx context.Context, catalog *addonv1alpha1.StarburstCatalog) (map[string]string, error) {
+	values := map[string]string{}
+	lookup := r.secretLookup(ctx, catalog.Namespace)
+	for key, value := range catalog.Spec.Properties {
+		if !secretPlaceholder.MatchString(value) {
+			continue
+		}
+		expanded, err := expandPlaceholders(value, lookup)
+		if err != nil {
+			return nil, fmt.Errorf("property %s: %w", key, err)
+		}
+		values[key] = expanded
+	}
+	for _, p := range catalog.Spec.SecretProperties {
+		ref := p.SecretKeyRef
+		secret, err := r.getSecret(ctx, ref.Name, catalog.Namespace)
+		if err != nil {
+			if k8serrors.IsNotFound(err) && ref.Optional != nil && *ref.Optional {
+				continue
+			}
+			return nil, err
+		}
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			if ref.Optional != nil && *ref.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("Secret %s has no key %s", ref.Name, ref.Key)
+		}
+		if strings.ContainsAny(string(value), "\r\n") {
+			return nil, fmt.Errorf("key %s of Secret %s must fit on one line", ref.Key, ref.Name)
+		}
+		values[p.Name] = string(value)
+	}
+	return values, nil
+}
+
+// catalogsComponent adds every StarburstCatalog in the operand namespace to
+// the catalogs of the StarburstEnterprise and reports in the Loaded condition
+// of each whether the coordinator serves it. Secret values are handed to the
+// nodes through the catalogs env Secret. A catalog that is invalid or
+// whose secrets cannot be read keeps its last applied properties.
+type catalogsComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *catalogsComponent) Name() string { return "Catalogs" }
+
+func (c *catalogsComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	list := &addonv1alpha1.StarburstCatalogList{}
+	if err := c.r.Client.List(ctx, list, client.InNamespace(Namespace)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("could not list StarburstCatalogs: %v", err)
+	}
+
+	se, err := c.r.getStarburstEnterprise(ctx, Namespace)
+	if k8serrors.IsNotFound(err) && len(list.Items) == 0 {
+		return ctrl.Result{}, c.r.deleteAll(ctx, addon, operandEnvSecret(c.Name(), nil))
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	env, err := c.r.operandEnv(ctx, c.Name())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var (
+		catalogs   = map[string]interface{}{}
+		conditions = map[string]metav1.Condition{}
+		failed     []string
+	)
+	for i := range list.Items {
+		catalog := &list.Items[i]
+		name := catalogName(catalog.Name)
+
+		var secretValues map[string]string
+		reason := "InvalidSpec"
+		err := validateCatalog(catalog.Name, catalog.Spec)
+		if err == nil {
+			secretValues, err = c.r.resolveSecretProperties(ctx, catalog)
+			reason = "SecretUnavailable"
+			if k8serrors.IsNotFound(err) {
+				reason = "SecretNotFound"
+			}
+		}
+		if err != nil {
+			failed = append(failed, catalog.Name)
+			conditions[catalog.Name] = metav1.Condition{Status: metav1.ConditionFalse, Reason: reason, Message: err.Error()}
+			if live, ok, _ := unstructured.NestedString(se.Object, "spec", "catalogs", name); ok {
+				catalogs[name] = live
+				env.keep(live)
+			}
+			continue
+		}
+
+		refs := map[string]string{}
+		for key, value := range secretValues {
+			refs[key] = env.ref("catalog_"+name+"_"+key, value)
+		}
+		catalogs[name] = renderCatalog(catalog.Spec, refs)
+	}
+
+	if err := c.r.applyOperandEnv(ctx, addon, c.Name(), env); err != nil {
+		return ctrl.Result{}, err
+	}
+	patch := starburstEnterprisePatch(se)
+	if len(catalogs) > 0 {
+		_ = unstructured.SetNestedField(patch.Object, catalogs, "spec", "catalogs")
+	}
+	if err := c.r.applyOperandPatch(ctx, addon, c.Name(), patch); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var (
+		result  ctrl.Result
+		pending *pendingError
+		loading []string
+	)
+	if len(catalogs) > 0 {
+		loaded, err := c.r.trino(ctx).catalogs(ctx, coordinatorURL(Namespace))
+		for _, catalog := range list.Items {
+			name := catalogName(catalog.Name)
+			switch {
+			case conditions[catalog.Name].Reason != "":
+			case err != nil:
+				conditions[catalog.Name] = metav1.Condition{Status: metav1.ConditionUnknown, Reason: "CoordinatorUnavailable", Message: err.Error()}
+			case containsString(loaded, name):
+				conditions[catalog.Name] = metav1.Condition{Status: metav1.ConditionTrue, Reason: "Loaded", Message: fmt.Sprintf("Catalog %s is served by the coordinator", name)}
+			default:
+				conditions[catalog.Name] = metav1.Condition{Status: metav1.ConditionFalse, Reason: "Pending", Message: fmt.Sprintf("Waiting for the coordinator to load catalog %s", name)}
+				loading = append(loading, name)
+			}
+		}
+		switch {
+		case err != nil:
+			result.RequeueAfter = rolloutPollInterval
+			pending = &pendingError{reason: "CoordinatorUnavailable", message: fmt.Sprintf("Could not check the loaded catalogs: %v", err)}
+		case len(loading) > 0:
+			result.RequeueAfter = rolloutPollInterval
+			pending = &pendingError{reason: "CatalogsLoading", message: "Waiting for the coordinator to load " + strings.Join(loading, ", ")}
+		}
+	}
+
+	for i := range list.Items {
+		if err := c.setLoadedCondition(ctx, &list.Items[i], conditions[list.Items[i].Name]); err != nil {
+			return result, err
+		}
+	}
+
+	if len(failed) > 0 {
+		return result, fmt.Errorf("could not render StarburstCatalogs %s, see their Loaded condition", strings.Join(failed, ", "))
+	}
+	if pending != nil {
+		return result, pending
+	}
+	return result, nil
+}
+
+// setLoadedCondition records the Loaded condition of a catalog. The status is
+// only written when it changed, and never in plan mode.
+func (c *catalogsComponent) setLoadedCondition(ctx context.Context, catalog *addonv1alpha1.StarburstCatalog, condition metav1.Condition) error {
+	condition.Type = addonv1alpha1.ConditionLoaded
+	condition.ObservedGeneration = catalog.Generation
+
+	before := catalog.Status.DeepCopy()
+	meta.SetStatusCondition(&catalog.Status.Conditions, condition)
+	if c.r.Plan || equality.Semantic.DeepEqual(before, &catalog.Status) {
+		return nil
+	}
+	if err := c.r.Client.Status().Update(ctx, catalog); err != nil {
+		return fmt.Errorf("could not update StarburstCatalog %s status: %v", catalog.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+func TestValidateCatalog(t *testing.T) {
+	secret := []addonv1alpha1.SecretProperty{{Name: "connection-url"}}
+	cases := []struct {
+		name    string
+		catalog string
+		spec    addonv1alpha1.StarburstCatalogSpec
+		valid   bool
+	}{
+		{"hive with metastore", "lake", addonv1alpha1.StarburstCatalogSpec{Connector: "hive", Properties: map[string]string{"hive.metastore.uri": "thrift://hms:9083"}}, true},
+		{"hive on glue", "lake", addonv1alpha1.StarburstCatalogSpec{Connector: "hive", Properties: map[string]string{"hive.metastore": "glue"}}, true},
+		{"hive without metastore", "lake", addonv1alpha1.StarburstCatalogSpec{Connector: "hive"}, false},
+		{"iceberg rest", "ice", addonv1alpha1.StarburstCatalogSpec{Connector: "iceberg", Properties: map[string]string{"iceberg.catalog.type": "rest", "iceberg.rest-catalog.uri": "http://rest"}}, true},
+		{"iceberg rest without uri", "ice", addonv1alpha1.StarburstCatalogSpec{Connector: "iceberg", Properties: map[string]string{"iceberg.catalog.type": "rest"}}, false},
+		{"iceberg unknown type", "ice", addonv1alpha1.StarburstCatalogSpec{Connector: "iceberg", Properties: map[string]string{"iceberg.catalog.type": "foo"}}, false},
+		{"postgresql", "sales-db", addonv1alpha1.StarburstCatalogSpec{Connector: "postgresql", Properties: map[string]string{"connection-url": "jdbc:postgresql://db:5432/sales"}}, true},
+		{"postgresql url from secret", "sales-db", addonv1alpha1.StarburstCatalogSpec{Connector: "postgresql", SecretProperties: secret}, true},
+		{"postgresql with mysql url", "sales-db", addonv1alpha1.StarburstCatalogSpec{Connector: "postgresql", Properties: map[string]string{"connection-url": "jdbc:mysql://db:3306/sales"}}, false},
+		{"mysql without url", "sales-db", addonv1alpha1.StarburstCatalogSpec{Connector: "mysql"}, false},
+		{"unknown connector", "mem", addonv1alpha1.StarburstCatalogSpec{Connector: "memory"}, true},
+		{"connector.name property", "mem", addonv1alpha1.StarburstCatalogSpec{Connector: "memory", Properties: map[string]string{"connector.name": "tpch"}}, false},
+		{"duplicate property", "sales-db", addonv1alpha1.StarburstCatalogSpec{Connector: "postgresql", Properties: map[string]string{"connection-url": "jdbc:postgresql://db"}, SecretProperties: secret}, false},
+		{"multi-line value", "mem", addonv1alpha1.StarburstCatalogSpec{Connector: "memory", Properties: map[string]string{"a": "b\nconnector.name=tpch"}}, false},
+		{"dotted name", "sales.db", addonv1alpha1.StarburstCatalogSpec{Connector: "memory"}, false},
+	}
+
+	for _, tc := range cases {
+		err := validateCatalog(tc.catalog, tc.spec)
+		if (err == nil) != tc.valid {
+			t.Errorf("%s: validateCatalog() = %v, want valid %v", tc.name, err, tc.valid)
+		}
+	}
+}
+
+func TestRenderCatalog(t *testing.T) {
+	spec := addonv1alpha1.StarburstCatalogSpec{
+		Connector:  "postgresql",
+		Properties: map[string]string{"connection-user": "starburst", "connection-url": "jdbc:postgresql://db:5432/sales"},
+	}
+	got := renderCatalog(spec, map[string]string{"connection-password": "${ENV:CATALOG_SALES_CONNECTION_PASSWORD_0123ABCD}"})
+	want := "connector.name=postgresql\n" +
+		"connection-password=${ENV:CATALOG_SALES_CONNECTION_PASSWORD_0123ABCD}\n" +
+		"connection-url=jdbc:postgresql://db:5432/sales\n" +
+		"connection-user=starburst"
+	if got != want {
+		t.Errorf("renderCatalog() = %q, want %q", got, want)
+	}
+
+	if got := catalogName("sales-db"); got != "sales_db" {
+		t.Errorf("catalogName(sales-db) = %q, want sales_db", got)
+	}
+}
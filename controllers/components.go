@@ -0,0 +1,340 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+	configv1 "github.com/openshift/api/config/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// component reconciles one independent piece of the addon. Every component
+// runs on every reconcile and reports its own condition, so a failure in one
+// of them does not keep the others from converging.
+type component interface {
+	// Name identifies the component in logs. Its condition type is Name()+"Ready".
+	Name() string
+
+	// Reconcile brings the component to its desired state.
+	Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error)
+}
+
+// components returns the pipeline run by Reconcile, in order.
+func (r *StarburstAddonReconciler) components() []component {
+	return []component{
+		&licenseComponent{r},
+		&prometheusComponent{r},
+		&serviceMonitorsComponent{r},
+		&scheduleComponent{r},
+		&prometheusRulesComponent{r},
+		&alertingComponent{r},
+		&operandComponent{r},
+		&catalogsComponent{r},
+		&resourceGroupsComponent{r},
+		&accessControlComponent{r},
+		&exposeComponent{r},
+		&securityComponent{r},
+		&networkPolicyComponent{r},
+		&versionComponent{r},
+		&autoscalingComponent{r},
+		&podSecurityComponent{r},
+	}
+}
+
+// conflictError is returned by applyAll when some objects could not be
+// applied because another field manager owns fields the operator sets.
+type conflictError struct {
+	objects []string
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("fields owned by another manager, set spec.forceApply to take ownership: %s", strings.Join(e.objects, ", "))
+}
+
+// pendingError is returned by a component that is waiting on the operand,
+// for example during a staged rollout, or that found a problem in the operand
+// it can only report. It is reported in the component's condition with its
+// own reason but is not treated as a failure.
+type pendingError struct {
+	reason  string
+	message string
+}
+
+func (e *pendingError) Error() string {
+	return e.message
+}
+
+// applyAll server-side applies every object. Conflicting objects are skipped
+// and reported together as a *conflictError once the rest have been applied.
+func (r *StarburstAddonReconciler) applyAll(ctx context.Context, addon *addonv1alpha1.StarburstAddon, objs ...client.Object) error {
+	logger := log.FromContext(ctx)
+
+	var conflicts []string
+	for _, obj := range objs {
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		if err := r.apply(ctx, addon, obj); err != nil {
+			if k8serrors.IsConflict(err) {
+				logger.Info("Field conflict while applying", "kind", kind, "name", obj.GetName(), "reason", err.Error())
+				conflicts = append(conflicts, fmt.Sprintf("%s %s/%s", kind, obj.GetNamespace(), obj.GetName()))
+				continue
+			}
+			return fmt.Errorf("could not apply %s %s: %v", kind, obj.GetName(), err)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return &conflictError{objects: conflicts}
+	}
+	return nil
+}
+
+// getSecret fetches a secret the generated resources are built from.
+func (r *StarburstAddonReconciler) getSecret(ctx context.Context, name, namespace string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, types.NamespacedName{
+		Name:      name,
+		Namespace: namespace,
+	}, secret); err != nil {
+		return nil, fmt.Errorf("could not get Secret %s: %w", name, err)
+	}
+	return secret, nil
+}
+
+// deleteAll removes objects the operator no longer wants, ignoring those
+// that are already gone or whose kind the cluster does not serve. In plan
+// mode the deletions are only recorded.
+func (r *StarburstAddonReconciler) deleteAll(ctx context.Context, addon *addonv1alpha1.StarburstAddon, objs ...client.Object) error {
+	for _, obj := range objs {
+		if !r.served(obj.GetObjectKind().GroupVersionKind()) {
+			continue
+		}
+		if r.Plan {
+			if err := r.planDelete(ctx, addon, obj); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := r.Client.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("could not delete %s %s: %v", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// served reports whether the cluster serves gvk, for example whether Routes
+// are available.
+func (r *StarburstAddonReconciler) served(gvk schema.GroupVersionKind) bool {
+	_, err := r.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	return err == nil
+}
+
+// licenseComponent copies the license from the parameters secret into the
+// starburst-license secret consumed by the operand.
+type licenseComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *licenseComponent) Name() string { return "License" }
+
+func (c *licenseComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	userParams, err := c.r.getSecret(ctx, "addon-managed-starburst-parameters", addon.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	cfg := ResolveConfig(addon, RenderInputs{UserParams: userParams})
+	return ctrl.Result{}, c.r.applyAll(ctx, addon, DeployLicenseSecret(cfg))
+}
+
+// prometheusComponent deploys the Prometheus that remote-writes to the vault
+// endpoint and any additional spec.remoteWrite targets, and its identity.
+type prometheusComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *prometheusComponent) Name() string { return "Prometheus" }
+
+func (c *prometheusComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	if !addon.Spec.Metrics {
+		cfg := ResolveConfig(addon, RenderInputs{})
+		return ctrl.Result{}, c.r.deleteAll(ctx, addon, append([]client.Object{DeployPrometheus(cfg)}, DeployPrometheusRBAC(cfg)...)...)
+	}
+
+	vault, err := c.r.getSecret(ctx, "addon", addon.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	cv := &configv1.ClusterVersion{}
+	if err := c.r.Client.Get(ctx, types.NamespacedName{Name: "version"}, cv); err != nil {
+		return ctrl.Result{}, fmt.Errorf("could not get ClusterVersion: %w", err)
+	}
+
+	cfg := ResolveConfig(addon, RenderInputs{Vault: vault, ClusterVersion: cv})
+	return ctrl.Result{}, c.r.applyAll(ctx, addon, append(DeployPrometheusRBAC(cfg), DeployPrometheus(cfg))...)
+}
+
+// serviceMonitorsComponent deploys the operand, federation and Prometheus
+// ServiceMonitors.
+type serviceMonitorsComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *serviceMonitorsComponent) Name() string { return "ServiceMonitors" }
+
+func (c *serviceMonitorsComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	cfg := ResolveConfig(addon, RenderInputs{})
+	objs := []client.Object{DeployServiceMonitor(cfg), DeployFederationServiceMonitor(cfg), DeployPrometheusServiceMonitor(cfg)}
+	if !cfg.Metrics {
+		return ctrl.Result{}, c.r.deleteAll(ctx, addon, objs...)
+	}
+	return ctrl.Result{}, c.r.applyAll(ctx, addon, objs...)
+}
+
+// prometheusRulesComponent deploys the recording rules and the alerts of the
+// alert catalog.
+type prometheusRulesComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *prometheusRulesComponent) Name() string { return "PrometheusRules" }
+
+func (c *prometheusRulesComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	if !addon.Spec.Metrics {
+		return ctrl.Result{}, c.r.deleteAll(ctx, addon, DeployPrometheusRules(ResolveConfig(addon, RenderInputs{})))
+	}
+
+	// The alerts are labelled with the cluster ID.
+	cv := &configv1.ClusterVersion{}
+	if err := c.r.Client.Get(ctx, types.NamespacedName{Name: "version"}, cv); err != nil {
+		return ctrl.Result{}, fmt.Errorf("could not get ClusterVersion: %w", err)
+	}
+	cfg := ResolveConfig(addon, RenderInputs{ClusterVersion: cv})
+	return ctrl.Result{}, c.r.applyAll(ctx, addon, DeployPrometheusRules(cfg))
+}
+
+// operandComponent deploys the CronJob that applies the StarburstEnterprise
+// operand, and the secret holding the manifest it applies, with the fields the
+// operator sets removed and the secret placeholders of the parameters secret
+// turned into references to the operand env Secret. The CronJob may only
+// apply the kinds of the manifest. The CronJob is suspended while a maintenance window is open so
+// that operand upgrades wait for it to close.
+type operandComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *operandComponent) Name() string { return "Operand" }
+
+func (c *operandComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	end, err := maintenanceWindowEnd(addon.Spec.MaintenanceWindows, time.Now())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	userParams, err := c.r.getSecret(ctx, "addon-managed-starburst-parameters", addon.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	env, err := c.r.operandEnv(ctx, c.Name())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	cfg := ResolveConfig(addon, RenderInputs{UserParams: userParams})
+	if cfg.Operand, err = stripOperatorFields(cfg.Operand, operatorOwnedFields(addon.Spec)); err != nil {
+		return ctrl.Result{}, err
+	}
+	if cfg.Operand, err = expandManifestPlaceholders(cfg.Operand, c.r.secretLookup(ctx, Namespace), env); err != nil {
+		return ctrl.Result{}, err
+	}
+	if cfg.Operand, err = addOperandEnvFrom(cfg.Operand); err != nil {
+		return ctrl.Result{}, err
+	}
+	if cfg.OperandResources, err = manifestResources(cfg.Operand, c.r.Client.RESTMapper()); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := c.r.applyOperandEnv(ctx, addon, c.Name(), env); err != nil {
+		return ctrl.Result{}, err
+	}
+	var result ctrl.Result
+	if !end.IsZero() {
+		log.FromContext(ctx).Info("Deferring operand upgrades until the maintenance window closes", "until", end)
+		cfg.SuspendOperand = true
+		result.RequeueAfter = time.Until(end)
+	}
+	objs := append(DeployApplyRBAC(cfg), DeployOperandSecret(cfg), DeployCronJob(cfg))
+	return result, c.r.applyAll(ctx, addon, objs...)
+}
+
+// networkPolicyComponent deploys the NetworkPolicies of spec.networkPolicy.
+type networkPolicyComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *networkPolicyComponent) Name() string { return "NetworkPolicy" }
+
+func (c *networkPolicyComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	cfg := ResolveConfig(addon, RenderInputs{})
+	if cfg.NetworkPolicy == nil {
+		cfg.NetworkPolicy = &addonv1alpha1.NetworkPolicy{}
+		return ctrl.Result{}, c.r.deleteAll(ctx, addon, networkPolicyObjects(cfg)...)
+	}
+	if cfg.Expose != nil && ingressNamespaceSelector(cfg) == nil {
+		return ctrl.Result{}, fmt.Errorf("spec.networkPolicy.ingressNamespaceSelector must select the namespace of the ingress controller serving the Ingress of spec.expose")
+	}
+	return ctrl.Result{}, c.r.applyAll(ctx, addon, networkPolicyObjects(cfg)...)
+}
+
+func networkPolicyObjects(cfg RenderConfig) []client.Object {
+	var objs []client.Object
+	for _, policy := range DeployNetworkPolicies(cfg) {
+		objs = append(objs, policy)
+	}
+	return objs
+}
+
+// componentReason maps a component error to the reason of its condition.
+func componentReason(err error) string {
+	var (
+		conflict *conflictError
+		pending  *pendingError
+	)
+	switch {
+	case err == nil:
+		return "Reconciled"
+	case errors.As(err, &conflict):
+		return "FieldConflict"
+	case errors.As(err, &pending):
+		return pending.reason
+	case k8serrors.IsNotFound(err):
+		return "DependencyNotFound"
+	default:
+		return "ReconcileFailed"
+	}
+}
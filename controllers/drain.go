@@ -0,0 +1,211 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+const (
+	defaultWorkerDrainDeadline = 5 * time.Minute
+	defaultMaxDrainingWorkers  = int32(1)
+
+	// workerShutdownGracePeriod is the Trino shutdown.grace-period of the
+	// workers: how long a shutting down worker waits for the coordinator to
+	// stop scheduling on it, before and after finishing its tasks.
+	workerShutdownGracePeriod = 30 * time.Second
+
+	// podDeletionCostAnnotation makes the ReplicaSet remove the chosen
+	// workers first when the worker count drops.
+	podDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+)
+
+// setWorkerShutdown makes the chart shut workers down gracefully when their
+// pod is deleted: its preStop hook puts the node into SHUTTING_DOWN and waits
+// for Trino to exit, which it does once its active tasks have finished. The
+// termination grace period gives the tasks spec.workerDrainDeadline on top of
+// the two shutdown grace periods.
+func setWorkerShutdown(patch *unstructured.Unstructured, spec addonv1alpha1.StarburstAddonSpec) {
+	deadline := defaultWorkerDrainDeadline
+	if spec.WorkerDrainDeadline != nil {
+		deadline = spec.WorkerDrainDeadline.Duration
+	}
+	grace := int64(workerShutdownGracePeriod.Seconds())
+	_ = unstructured.SetNestedField(patch.Object, grace, "spec", "worker", "starburstWorkerShutdownGracePeriodSeconds")
+	_ = unstructured.SetNestedField(patch.Object, int64(deadline.Seconds())+2*grace, "spec", "worker", "deploymentTerminationGracePeriodSeconds")
+}
+
+func maxDrainingWorkers(spec addonv1alpha1.StarburstAddonSpec) int32 {
+	if spec.MaxDrainingWorkers != nil {
+		return *spec.MaxDrainingWorkers
+	}
+	return defaultMaxDrainingWorkers
+}
+
+// limitWorkerRollout makes the worker Deployment replace at most
+// spec.maxDrainingWorkers pods at a time and start their replacements only
+// once they are gone, so that an upgrade drains that many workers at once.
+// The chart leaves the strategy alone, so it is merge patched like the pods.
+func (r *StarburstAddonReconciler) limitWorkerRollout(ctx context.Context, addon *addonv1alpha1.StarburstAddon) error {
+	d := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: workerDeployment, Namespace: Namespace}, d); err != nil {
+		return fmt.Errorf("could not get Deployment %s: %w", workerDeployment, err)
+	}
+
+	maxUnavailable := intstr.FromInt(int(maxDrainingWorkers(addon.Spec)))
+	maxSurge := intstr.FromInt(0)
+	strategy := appsv1.DeploymentStrategy{
+		Type:          appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{MaxUnavailable: &maxUnavailable, MaxSurge: &maxSurge},
+	}
+	if reflect.DeepEqual(d.Spec.Strategy, strategy) || r.Plan {
+		return nil
+	}
+	patch := client.MergeFrom(d.DeepCopy())
+	d.Spec.Strategy = strategy
+	if err := r.Client.Patch(ctx, d, patch); err != nil {
+		return fmt.Errorf("could not limit the rollout of Deployment %s: %v", workerDeployment, err)
+	}
+	return nil
+}
+
+// workerPods lists the running pods of the worker deployment, newest first.
+func (r *StarburstAddonReconciler) workerPods(ctx context.Context) ([]corev1.Pod, error) {
+	d := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: workerDeployment, Namespace: Namespace}, d); err != nil {
+		return nil, fmt.Errorf("could not get Deployment %s: %w", workerDeployment, err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector on Deployment %s: %v", workerDeployment, err)
+	}
+
+	list := &corev1.PodList{}
+	if err := r.Client.List(ctx, list, client.InNamespace(Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("could not list worker pods: %v", err)
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range list.Items {
+		if pod.DeletionTimestamp.IsZero() && pod.Status.Phase == corev1.PodRunning {
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[j].CreationTimestamp.Before(&pods[i].CreationTimestamp)
+	})
+	return pods, nil
+}
+
+// scaleDownStep picks the next batch on the way to desired workers: the
+// worker count to move to and the running pods, newest first, it removes.
+func scaleDownStep(pods []corev1.Pod, desired, batch int32) (int32, []corev1.Pod) {
+	replicas := desired
+	if running := int32(len(pods)); running-batch > replicas {
+		replicas = running - batch
+	}
+	if int32(len(pods)) <= replicas {
+		return replicas, nil
+	}
+	return replicas, pods[:int32(len(pods))-replicas]
+}
+
+// workerReplicas returns the worker count to apply on the way to desired and
+// whether desired is reached. A scale-down removes workers in batches of
+// spec.maxDrainingWorkers: the pods of a batch are marked so that the
+// ReplicaSet deletes them rather than others, and the next batch starts once
+// they are gone, their tasks finished or spec.workerDrainDeadline passed.
+func (r *StarburstAddonReconciler) workerReplicas(ctx context.Context, addon *addonv1alpha1.StarburstAddon, desired int32) (int32, bool, error) {
+	if status := addon.Status.Drain; status != nil && desired <= status.Replicas {
+		remaining, err := r.existingPods(ctx, status.Pods)
+		if err != nil {
+			return 0, false, err
+		}
+		if len(remaining) > 0 {
+			status.Pods = remaining
+			return status.Replicas, false, nil
+		}
+	}
+	addon.Status.Drain = nil
+
+	pods, err := r.workerPods(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	replicas, batch := scaleDownStep(pods, desired, maxDrainingWorkers(addon.Spec))
+	if len(batch) == 0 {
+		return replicas, true, nil
+	}
+
+	status := &addonv1alpha1.DrainStatus{Replicas: replicas, StartTime: metav1.Now()}
+	for i := range batch {
+		pod := &batch[i]
+		log.FromContext(ctx).Info("Removing worker", "pod", pod.Name)
+		status.Pods = append(status.Pods, pod.Name)
+		if r.Plan || pod.Annotations[podDeletionCostAnnotation] == "-1000" {
+			continue
+		}
+		patch := client.MergeFrom(pod.DeepCopy())
+		metav1.SetMetaDataAnnotation(&pod.ObjectMeta, podDeletionCostAnnotation, "-1000")
+		if err := r.Client.Patch(ctx, pod, patch); err != nil {
+			return 0, false, fmt.Errorf("could not mark pod %s for deletion: %v", pod.Name, err)
+		}
+	}
+	addon.Status.Drain = status
+	return replicas, false, nil
+}
+
+// existingPods returns the names of the worker pods that still exist,
+// terminating or not.
+func (r *StarburstAddonReconciler) existingPods(ctx context.Context, names []string) ([]string, error) {
+	var existing []string
+	for _, name := range names {
+		err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: Namespace}, &corev1.Pod{})
+		switch {
+		case err == nil:
+			existing = append(existing, name)
+		case !k8serrors.IsNotFound(err):
+			return nil, fmt.Errorf("could not get pod %s: %v", name, err)
+		}
+	}
+	return existing, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
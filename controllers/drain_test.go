@@ -0,0 +1,168 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// testWorkers returns the worker Deployment and its running pods, the first
+// one the newest.
+func testWorkers(names ...string) []client.Object {
+	labels := map[string]string{"role": "worker"}
+	objs := []client.Object{&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: workerDeployment, Namespace: Namespace},
+		Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+	}}
+	created := time.Now()
+	for _, name := range names {
+		created = created.Add(-time.Minute)
+		objs = append(objs, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace, Labels: labels, CreationTimestamp: metav1.NewTime(created)},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		})
+	}
+	return objs
+}
+
+func TestScaleDownStep(t *testing.T) {
+	var pods []corev1.Pod
+	for _, name := range []string{"worker-a", "worker-b", "worker-c", "worker-d", "worker-e"} {
+		pods = append(pods, corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+
+	cases := []struct {
+		name         string
+		running      int
+		desired      int32
+		batch        int32
+		wantReplicas int32
+		wantPods     []string
+	}{
+		{"first batch", 5, 1, 2, 3, []string{"worker-a", "worker-b"}},
+		{"last batch", 5, 4, 2, 4, []string{"worker-a"}},
+		{"to zero", 1, 0, 1, 0, []string{"worker-a"}},
+		{"scale-up", 2, 4, 1, 4, nil},
+		{"nothing to remove", 3, 3, 1, 3, nil},
+	}
+
+	for _, tc := range cases {
+		replicas, batch := scaleDownStep(pods[:tc.running], tc.desired, tc.batch)
+		var names []string
+		for _, pod := range batch {
+			names = append(names, pod.Name)
+		}
+		if replicas != tc.wantReplicas || !reflect.DeepEqual(names, tc.wantPods) {
+			t.Errorf("%s: got %d replicas removing %v, want %d removing %v", tc.name, replicas, names, tc.wantReplicas, tc.wantPods)
+		}
+	}
+}
+
+func TestWorkerReplicasWaitsForRemovedPods(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(testWorkers("worker-a", "worker-b", "worker-c")...).Build()
+	r := &StarburstAddonReconciler{Client: c}
+	addon := testAddon(addonv1alpha1.StarburstAddonSpec{MaxDrainingWorkers: int32Ptr(2)})
+	ctx := context.Background()
+
+	deletePod := func(name string) {
+		if err := c.Delete(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		before   func()
+		replicas int32
+		done     bool
+		removing []string
+	}{
+		{nil, 1, false, []string{"worker-a", "worker-b"}},
+		{nil, 1, false, []string{"worker-a", "worker-b"}},
+		{func() { deletePod("worker-a") }, 1, false, []string{"worker-b"}},
+		{func() { deletePod("worker-b") }, 0, false, []string{"worker-c"}},
+		{func() { deletePod("worker-c") }, 0, true, nil},
+	}
+	for i, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		replicas, done, err := r.workerReplicas(ctx, addon, 0)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if replicas != step.replicas || done != step.done {
+			t.Fatalf("step %d: got %d replicas, done %v, want %d, done %v", i, replicas, done, step.replicas, step.done)
+		}
+		var removing []string
+		if addon.Status.Drain != nil {
+			removing = addon.Status.Drain.Pods
+		}
+		if !reflect.DeepEqual(removing, step.removing) {
+			t.Errorf("step %d: removing %v, want %v", i, removing, step.removing)
+		}
+	}
+}
+
+func TestWorkerReplicasMarksRemovedPods(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(testWorkers("worker-a", "worker-b")...).Build()
+	r := &StarburstAddonReconciler{Client: c}
+	addon := testAddon(addonv1alpha1.StarburstAddonSpec{})
+	ctx := context.Background()
+
+	if _, _, err := r.workerReplicas(ctx, addon, 1); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"worker-a": "-1000", "worker-b": ""} {
+		pod := &corev1.Pod{}
+		if err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: Namespace}, pod); err != nil {
+			t.Fatal(err)
+		}
+		if got := pod.Annotations[podDeletionCostAnnotation]; got != want {
+			t.Errorf("%s: got deletion cost %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLimitWorkerRollout(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(testWorkers()...).Build()
+	r := &StarburstAddonReconciler{Client: c}
+	addon := testAddon(addonv1alpha1.StarburstAddonSpec{MaxDrainingWorkers: int32Ptr(2)})
+
+	if err := r.limitWorkerRollout(context.Background(), addon); err != nil {
+		t.Fatal(err)
+	}
+	d := &appsv1.Deployment{}
+	if err := c.Get(context.Background(), client.ObjectKey{Name: workerDeployment, Namespace: Namespace}, d); err != nil {
+		t.Fatal(err)
+	}
+	rolling := d.Spec.Strategy.RollingUpdate
+	if rolling == nil || *rolling.MaxUnavailable != intstr.FromInt(2) || *rolling.MaxSurge != intstr.FromInt(0) {
+		t.Errorf("got rollout strategy %+v, want at most 2 unavailable and no surge", d.Spec.Strategy)
+	}
+}
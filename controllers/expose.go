@@ -0,0 +1,113 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// exposeComponent creates the Route or Ingress of spec.expose and reports the
+// URL of the coordinator in status.endpoint. Switching between the two
+// removes the one no longer wanted. A re-encrypting Route trusts the service
+// CA, or the internal CA whose node certificate the coordinator serves.
+type exposeComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *exposeComponent) Name() string { return "Expose" }
+
+func (c *exposeComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	in := RenderInputs{NoRoutes: !c.r.served(routev1.GroupVersion.WithKind("Route"))}
+	spec := addon.Spec.Expose
+	if spec == nil {
+		cfg := ResolveConfig(addon, in)
+		cfg.Expose = &ExposeConfig{}
+		addon.Status.Endpoint = ""
+		return ctrl.Result{}, c.r.deleteAll(ctx, addon, DeployRoute(cfg), DeployIngress(cfg))
+	}
+
+	if spec.CertificateSecret != "" {
+		secret, err := c.r.getSecret(ctx, spec.CertificateSecret, Namespace)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if len(secret.Data[corev1.TLSCertKey]) == 0 || len(secret.Data[corev1.TLSPrivateKeyKey]) == 0 {
+			return ctrl.Result{}, fmt.Errorf("Secret %s needs the %s and %s keys", secret.Name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+		}
+		in.Certificate = secret
+	}
+
+	cfg := ResolveConfig(addon, in)
+	if spec.ServiceCA {
+		if cfg.Expose.Type != "Route" {
+			return ctrl.Result{}, fmt.Errorf("spec.expose.serviceCA needs a Route, ingress controllers do not trust the service CA")
+		}
+		// With internal TLS the coordinator serves its node certificate.
+		if cfg.InternalTLS {
+			secret, err := c.r.getSecret(ctx, internalTLSSecret(nil).Name, Namespace)
+			if k8serrors.IsNotFound(err) {
+				return ctrl.Result{RequeueAfter: rolloutPollInterval}, &pendingError{reason: "InternalTLSPending", message: "Waiting for the internal TLS certificates"}
+			}
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			cfg.Expose.DestinationCACertificate = string(secret.Data[truststoreKey])
+		}
+	}
+	var (
+		host string
+		err  error
+	)
+	switch cfg.Expose.Type {
+	case "Ingress":
+		if cfg.Expose.Host == "" || cfg.Expose.CertificateSecret == "" {
+			return ctrl.Result{}, fmt.Errorf("an Ingress needs spec.expose.host and spec.expose.certificateSecret")
+		}
+		if err := c.r.deleteAll(ctx, addon, DeployRoute(cfg)); err != nil {
+			return ctrl.Result{}, err
+		}
+		err = c.r.applyAll(ctx, addon, DeployIngress(cfg))
+		host = cfg.Expose.Host
+	default:
+		if in.NoRoutes {
+			return ctrl.Result{}, fmt.Errorf("Routes are not available on this cluster, set spec.expose.type to Ingress")
+		}
+		if err := c.r.deleteAll(ctx, addon, DeployIngress(cfg)); err != nil {
+			return ctrl.Result{}, err
+		}
+		// The applied Route carries the host generated by the router.
+		route := DeployRoute(cfg)
+		err = c.r.applyAll(ctx, addon, route)
+		host = route.Spec.Host
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if host != "" && !c.r.Plan {
+		addon.Status.Endpoint = "https://" + host
+	}
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,456 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+const (
+	// internalTLSPort is the HTTPS port the Trino nodes talk to each other on.
+	internalTLSPort = 8443
+
+	// internalTLSMountPath is where the Secret returned by
+	// internalTLSSecret is mounted on every node.
+	internalTLSMountPath = starburstEtc + "/internal-tls"
+
+	defaultCertificateDuration = 90 * 24 * time.Hour
+	caDuration                 = 10 * 365 * 24 * time.Hour
+
+	caCertKey     = "ca.crt"
+	caKeyKey      = "ca.key"
+	nextCACertKey = "next-ca.crt"
+	nextCAKeyKey  = "next-ca.key"
+	truststoreKey = "truststore.pem"
+	// keystorePrefix starts the key of every node keystore, followed by the
+	// revision of its certificate.
+	keystorePrefix = "keystore-"
+)
+
+// servingTLSMountPath is where the Secret returned by servingKeystoreSecret is
+// mounted on every node.
+const servingTLSMountPath = starburstEtc + "/serving-tls"
+
+// servingKeystoreSecret holds the certificate the service CA issued for the
+// coordinator as the PEM keystore Trino reads, with the key and the
+// certificate in one file.
+func servingKeystoreSecret(data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      Name + "-serving-keystore",
+			Namespace: Namespace,
+		},
+		Data: data,
+	}
+}
+
+// internalTLSSecret holds the CA and the node keystores of spec.internalTLS.
+func internalTLSSecret(data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      Name + "-internal-tls",
+			Namespace: Namespace,
+		},
+		Data: data,
+	}
+}
+
+// internalServiceName is the Service the workers discover the coordinator
+// through over HTTPS.
+func internalServiceName(cfg RenderConfig) string {
+	return cfg.Name + "-internal"
+}
+
+// servingCertAnnotation asks the OpenShift service CA to issue a certificate
+// for a Service into the named Secret.
+const servingCertAnnotation = "service.beta.openshift.io/serving-cert-secret-name"
+
+// servingCertSecret is where the service CA writes the certificate of the
+// Service returned by internalServiceName.
+func servingCertSecret(cfg RenderConfig) string {
+	return cfg.Name + "-serving-cert"
+}
+
+// coordinatorHTTPS reports whether the coordinator serves HTTPS, with its node
+// certificate for internal TLS or one of the service CA for a re-encrypting
+// Route.
+func coordinatorHTTPS(cfg RenderConfig) bool {
+	return cfg.InternalTLS || (cfg.Expose != nil && cfg.Expose.Reencrypt)
+}
+
+// nodeHosts are the names the node certificate is valid for. Trino addresses
+// the nodes by their IP encoded as a host name under .ip.
+func nodeHosts(cfg RenderConfig) []string {
+	service := internalServiceName(cfg)
+	return []string{
+		"*.ip",
+		service,
+		service + "." + cfg.Namespace + ".svc",
+		service + "." + cfg.Namespace + ".svc.cluster.local",
+	}
+}
+
+// internalTLSProperties configure a node for HTTPS between the nodes, using
+// the keystore of revision.
+func internalTLSProperties(cfg RenderConfig, revision string) []string {
+	// The chart sets discovery.uri too; the last occurrence wins.
+	return []string{
+		"http-server.https.enabled=true",
+		fmt.Sprintf("http-server.https.port=%d", internalTLSPort),
+		"http-server.https.keystore.path=" + internalTLSMountPath + "/" + keystorePrefix + revision + ".pem",
+		"internal-communication.https.required=true",
+		"internal-communication.https.truststore.path=" + internalTLSMountPath + "/" + truststoreKey,
+		"node.internal-address-source=IP_ENCODED_AS_HOSTNAME",
+		fmt.Sprintf("discovery.uri=https://%s.%s.svc:%d", internalServiceName(cfg), cfg.Namespace, internalTLSPort),
+	}
+}
+
+// nodeCertificate describes the node certificate in use.
+type nodeCertificate struct {
+	revision  string
+	notAfter  time.Time
+	renewTime time.Time
+}
+
+// renewInternalTLS returns the content of the internal TLS Secret, issuing a
+// node certificate when data has none that is valid for hosts past its renew
+// time. It reports whether data changed.
+//
+// Nodes load their keystore and truststore at startup and are restarted
+// one at a time after a renewal, so old and new nodes must trust each other:
+// a replacement CA is added to the truststore one renewal before it signs
+// anything, and retired CAs stay trusted until they expire. The previous
+// keystore is kept for nodes that restart before being rolled.
+func renewInternalTLS(data map[string][]byte, hosts []string, spec addonv1alpha1.InternalTLS, now time.Time) (map[string][]byte, nodeCertificate, bool, error) {
+	duration := defaultCertificateDuration
+	if spec.CertificateDuration != nil {
+		duration = spec.CertificateDuration.Duration
+	}
+	renewBefore := duration / 3
+	if spec.RenewBefore != nil {
+		renewBefore = spec.RenewBefore.Duration
+	}
+	if renewBefore >= duration {
+		return nil, nodeCertificate{}, false, fmt.Errorf("spec.internalTLS.renewBefore must be shorter than the certificate duration")
+	}
+
+	current, currentKey := latestKeystore(data)
+	if current != nil {
+		cert := nodeCertificate{
+			revision:  strings.TrimSuffix(strings.TrimPrefix(currentKey, keystorePrefix), ".pem"),
+			notAfter:  current.NotAfter,
+			renewTime: current.NotAfter.Add(-renewBefore),
+		}
+		if now.Before(cert.renewTime) && sameHosts(current.DNSNames, hosts) {
+			return data, cert, false, nil
+		}
+	}
+
+	ca, _ := parseKeyPair(data[caCertKey], data[caKeyKey])
+	next, _ := parseKeyPair(data[nextCACertKey], data[nextCAKeyKey])
+	var err error
+	switch {
+	case next != nil:
+		// The replacement has been trusted by every node since the last renewal.
+		ca, next = next, nil
+	case ca == nil || !now.Before(ca.cert.NotAfter):
+		if ca, err = newKeyPair(nil, "starburst-internal-ca", nil, now, caDuration); err != nil {
+			return nil, nodeCertificate{}, false, err
+		}
+	}
+	if ca.cert.NotAfter.Before(now.Add(2 * duration)) {
+		if next, err = newKeyPair(nil, "starburst-internal-ca", nil, now, caDuration); err != nil {
+			return nil, nodeCertificate{}, false, err
+		}
+	}
+
+	validity := duration
+	if limit := ca.cert.NotAfter.Sub(now); limit < validity {
+		validity = limit
+	}
+	leaf, err := newKeyPair(ca, hosts[0], hosts, now, validity)
+	if err != nil {
+		return nil, nodeCertificate{}, false, err
+	}
+	revision := fmt.Sprintf("%032x", leaf.cert.SerialNumber)[:12]
+
+	out := map[string][]byte{
+		caCertKey:                          ca.certPEM,
+		caKeyKey:                           ca.keyPEM,
+		keystorePrefix + revision + ".pem": bytes.Join([][]byte{leaf.keyPEM, leaf.certPEM, ca.certPEM}, nil),
+	}
+	if current != nil {
+		out[currentKey] = data[currentKey]
+	}
+	trusted := [][]byte{ca.certPEM}
+	if next != nil {
+		out[nextCACertKey] = next.certPEM
+		out[nextCAKeyKey] = next.keyPEM
+		trusted = append(trusted, next.certPEM)
+	}
+	for _, cert := range parseCertificates(data[truststoreKey]) {
+		block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		if now.Before(cert.NotAfter) && !containsPEM(trusted, block) {
+			trusted = append(trusted, block)
+		}
+	}
+	out[truststoreKey] = bytes.Join(trusted, nil)
+
+	return out, nodeCertificate{
+		revision:  revision,
+		notAfter:  leaf.cert.NotAfter,
+		renewTime: leaf.cert.NotAfter.Add(-renewBefore),
+	}, true, nil
+}
+
+// servingKeystore copies the certificate the service CA issued for the
+// coordinator into servingKeystoreSecret and returns the key of its keystore.
+func (r *StarburstAddonReconciler) servingKeystore(ctx context.Context, addon *addonv1alpha1.StarburstAddon, cfg RenderConfig) (string, error) {
+	issued, err := r.getSecret(ctx, servingCertSecret(cfg), Namespace)
+	if k8serrors.IsNotFound(err) {
+		return "", &pendingError{reason: "ServingCertificatePending", message: fmt.Sprintf("Waiting for the service CA to issue Secret %s", servingCertSecret(cfg))}
+	}
+	if err != nil {
+		return "", err
+	}
+	var live map[string][]byte
+	secret, err := r.getSecret(ctx, servingKeystoreSecret(nil).Name, Namespace)
+	switch {
+	case err == nil:
+		live = secret.Data
+	case !k8serrors.IsNotFound(err):
+		return "", err
+	}
+
+	data, key, changed, err := renewServingKeystore(live, issued.Data[corev1.TLSCertKey], issued.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return "", fmt.Errorf("Secret %s: %v", issued.Name, err)
+	}
+	if changed {
+		if err := r.applyAll(ctx, addon, servingKeystoreSecret(data)); err != nil {
+			return "", err
+		}
+	}
+	return key, nil
+}
+
+// renewServingKeystore returns the content of servingKeystoreSecret holding
+// the keystore of the issued cert and key, and its key, which names the
+// revision of the certificate so that the nodes roll onto a reissued one. Like
+// node keystores, the previous keystore is kept for nodes that restart before
+// being rolled. It reports whether data changed.
+func renewServingKeystore(data map[string][]byte, cert, key []byte) (map[string][]byte, string, bool, error) {
+	certs := parseCertificates(cert)
+	if len(certs) == 0 || len(key) == 0 {
+		return nil, "", false, fmt.Errorf("no certificate and key in the %s and %s keys", corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+	revision := fmt.Sprintf("%032x", certs[0].SerialNumber)[:12]
+	name := keystorePrefix + revision + ".pem"
+	if _, ok := data[name]; ok {
+		return data, name, false, nil
+	}
+
+	out := map[string][]byte{name: bytes.Join([][]byte{key, cert}, []byte("\n"))}
+	if current, currentKey := latestKeystore(data); current != nil {
+		out[currentKey] = data[currentKey]
+	}
+	return out, name, true, nil
+}
+
+// servingTLSProperties make the coordinator serve HTTPS with the keystore
+// returned by servingKeystore.
+func servingTLSProperties(keystore string) []string {
+	return []string{
+		"http-server.https.enabled=true",
+		fmt.Sprintf("http-server.https.port=%d", internalTLSPort),
+		"http-server.https.keystore.path=" + servingTLSMountPath + "/" + keystore,
+	}
+}
+
+// latestKeystore returns the certificate of the keystore expiring last.
+func latestKeystore(data map[string][]byte) (*x509.Certificate, string) {
+	var (
+		latest *x509.Certificate
+		key    string
+	)
+	for k, v := range data {
+		if !strings.HasPrefix(k, keystorePrefix) {
+			continue
+		}
+		certs := parseCertificates(v)
+		if len(certs) > 0 && (latest == nil || certs[0].NotAfter.After(latest.NotAfter)) {
+			latest, key = certs[0], k
+		}
+	}
+	return latest, key
+}
+
+// keyPair is a certificate and its private key, parsed and PEM encoded.
+type keyPair struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newKeyPair issues a certificate for hosts signed by issuer, or a CA when
+// issuer is nil.
+func newKeyPair(issuer *keyPair, commonName string, hosts []string, now time.Time, validity time.Duration) (*keyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("could not generate serial number: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(validity),
+		BasicConstraintsValid: true,
+	}
+	parent, signer := template, key
+	if issuer == nil {
+		template.IsCA = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	} else {
+		template.DNSNames = hosts
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		parent, signer = issuer.cert, issuer.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, fmt.Errorf("could not issue certificate %s: %v", commonName, err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode key: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return parseKeyPair(certPEM, keyPEM)
+}
+
+func parseKeyPair(certPEM, keyPEM []byte) (*keyPair, error) {
+	certs := parseCertificates(certPEM)
+	block, _ := pem.Decode(keyPEM)
+	if len(certs) == 0 || block == nil {
+		return nil, fmt.Errorf("missing certificate or key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse key: %v", err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unexpected key type %T", key)
+	}
+	return &keyPair{cert: certs[0], key: ecKey, certPEM: certPEM, keyPEM: keyPEM}, nil
+}
+
+// parseCertificates returns the certificates of a PEM bundle, skipping
+// anything else in it.
+func parseCertificates(bundle []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+func containsPEM(list [][]byte, block []byte) bool {
+	for _, item := range list {
+		if bytes.Equal(item, block) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameHosts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeCertificates renews the internal TLS Secret as needed and returns the
+// node certificate in use.
+func (r *StarburstAddonReconciler) nodeCertificates(ctx context.Context, addon *addonv1alpha1.StarburstAddon, cfg RenderConfig) (nodeCertificate, error) {
+	var data map[string][]byte
+	secret, err := r.getSecret(ctx, internalTLSSecret(nil).Name, Namespace)
+	switch {
+	case err == nil:
+		data = secret.Data
+	case !k8serrors.IsNotFound(err):
+		return nodeCertificate{}, err
+	}
+
+	data, cert, changed, err := renewInternalTLS(data, nodeHosts(cfg), *addon.Spec.InternalTLS, time.Now())
+	if err != nil {
+		return nodeCertificate{}, err
+	}
+	if changed {
+		if err := r.applyAll(ctx, addon, internalTLSSecret(data)); err != nil {
+			return nodeCertificate{}, err
+		}
+	}
+	return cert, nil
+}
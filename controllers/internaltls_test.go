@@ -0,0 +1,167 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"crypto/x509"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// verifyNode checks that the current keystore of data is trusted by its
+// truststore for a node address.
+func verifyNode(t *testing.T, data map[string][]byte, cert nodeCertificate, now time.Time) *x509.Certificate {
+	t.Helper()
+	chain := parseCertificates(data[keystorePrefix+cert.revision+".pem"])
+	if len(chain) == 0 {
+		t.Fatalf("no keystore for revision %s", cert.revision)
+	}
+	roots := x509.NewCertPool()
+	for _, ca := range parseCertificates(data[truststoreKey]) {
+		roots.AddCert(ca)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{Roots: roots, DNSName: "10-128-0-7.ip", CurrentTime: now}); err != nil {
+		t.Fatalf("node certificate is not trusted: %v", err)
+	}
+	return chain[0]
+}
+
+func TestRenewInternalTLS(t *testing.T) {
+	cfg := RenderConfig{Name: "starburst", Namespace: "redhat-starburst-operator"}
+	spec := addonv1alpha1.InternalTLS{CertificateDuration: &metav1.Duration{Duration: 30 * 24 * time.Hour}}
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	data, first, changed, err := renewInternalTLS(nil, nodeHosts(cfg), spec, now)
+	if err != nil || !changed {
+		t.Fatalf("renewInternalTLS() = %v, changed %v, want a new certificate", err, changed)
+	}
+	verifyNode(t, data, first, now)
+	if want := now.Add(20 * 24 * time.Hour); !first.renewTime.Equal(want) {
+		t.Errorf("renew time = %s, want %s", first.renewTime, want)
+	}
+
+	if _, again, changed, _ := renewInternalTLS(data, nodeHosts(cfg), spec, now.Add(time.Hour)); changed || again.revision != first.revision {
+		t.Errorf("certificate renewed before its renew time")
+	}
+
+	later := first.renewTime.Add(time.Minute)
+	renewed, second, changed, err := renewInternalTLS(data, nodeHosts(cfg), spec, later)
+	if err != nil || !changed || second.revision == first.revision {
+		t.Fatalf("renewInternalTLS() = %v, changed %v, want a renewed certificate", err, changed)
+	}
+	verifyNode(t, renewed, second, later)
+	if _, ok := renewed[keystorePrefix+first.revision+".pem"]; !ok {
+		t.Errorf("previous keystore was dropped")
+	}
+
+	bad := addonv1alpha1.InternalTLS{RenewBefore: &metav1.Duration{Duration: 100 * 24 * time.Hour}}
+	if _, _, _, err := renewInternalTLS(nil, nodeHosts(cfg), bad, now); err == nil {
+		t.Errorf("renewBefore longer than the certificate duration was accepted")
+	}
+}
+
+func TestRenewInternalTLSReplacesCA(t *testing.T) {
+	cfg := RenderConfig{Name: "starburst", Namespace: "redhat-starburst-operator"}
+	spec := addonv1alpha1.InternalTLS{}
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	data, cert, _, err := renewInternalTLS(nil, nodeHosts(cfg), spec, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCA := parseCertificates(data[caCertKey])[0]
+
+	// Close to the end of the CA, a replacement is trusted first...
+	now = oldCA.NotAfter.Add(-2*defaultCertificateDuration + time.Hour)
+	data, cert, _, err = renewInternalTLS(data, nodeHosts(cfg), spec, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data[nextCACertKey]) == 0 {
+		t.Fatalf("no replacement CA ahead of the expiry of the CA")
+	}
+	leaf := verifyNode(t, data, cert, now)
+	if err := leaf.CheckSignatureFrom(oldCA); err != nil {
+		t.Errorf("node certificate is not signed by the current CA: %v", err)
+	}
+	if n := len(parseCertificates(data[truststoreKey])); n != 2 {
+		t.Errorf("truststore has %d CAs, want the current and the replacement", n)
+	}
+
+	// ...and signs from the next renewal on, the old CA staying trusted.
+	nextCA := parseCertificates(data[nextCACertKey])[0]
+	now = cert.renewTime.Add(time.Minute)
+	data, cert, _, err = renewInternalTLS(data, nodeHosts(cfg), spec, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf = verifyNode(t, data, cert, now)
+	if err := leaf.CheckSignatureFrom(nextCA); err != nil {
+		t.Errorf("node certificate is not signed by the replacement CA: %v", err)
+	}
+	if len(data[nextCACertKey]) != 0 {
+		t.Errorf("replacement CA was not promoted")
+	}
+	if n := len(parseCertificates(data[truststoreKey])); n != 2 {
+		t.Errorf("truststore has %d CAs, want the old and the new", n)
+	}
+}
+
+func TestRenewServingKeystore(t *testing.T) {
+	now := time.Now()
+	issue := func() *keyPair {
+		pair, err := newKeyPair(nil, "starburst-internal.redhat-starburst-operator.svc", nil, now, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pair
+	}
+	first, second := issue(), issue()
+
+	data, key, changed, err := renewServingKeystore(nil, first.certPEM, first.keyPEM)
+	if err != nil || !changed {
+		t.Fatalf("renewServingKeystore() = %v, changed %v, want a keystore", err, changed)
+	}
+	if certs := parseCertificates(data[key]); len(certs) != 1 || !certs[0].Equal(first.cert) {
+		t.Fatalf("keystore %s does not hold the issued certificate", key)
+	}
+	if !bytes.Contains(data[key], first.keyPEM) {
+		t.Errorf("keystore %s does not hold the issued key", key)
+	}
+
+	if _, again, changed, _ := renewServingKeystore(data, first.certPEM, first.keyPEM); changed || again != key {
+		t.Errorf("keystore rewritten for the same certificate")
+	}
+
+	reissued, next, changed, err := renewServingKeystore(data, second.certPEM, second.keyPEM)
+	if err != nil || !changed || next == key {
+		t.Fatalf("renewServingKeystore() = %v, changed %v, want a new keystore", err, changed)
+	}
+	if _, ok := reissued[key]; !ok || len(reissued) != 2 {
+		t.Errorf("got keystores %v, want the previous one kept", reflect.ValueOf(reissued).MapKeys())
+	}
+
+	if _, _, _, err := renewServingKeystore(nil, nil, first.keyPEM); err == nil {
+		t.Errorf("a Secret without certificate was accepted")
+	}
+}
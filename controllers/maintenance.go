@@ -0,0 +1,114 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// maintenanceWindowEnd returns when the maintenance window open at now
+// closes, or the zero time if no window is open. When windows overlap the
+// latest end wins.
+func maintenanceWindowEnd(windows []addonv1alpha1.MaintenanceWindow, now time.Time) (time.Time, error) {
+	var end time.Time
+	for i, w := range windows {
+		loc := time.UTC
+		if w.TimeZone != "" {
+			var err error
+			if loc, err = time.LoadLocation(w.TimeZone); err != nil {
+				return time.Time{}, fmt.Errorf("invalid time zone in maintenance window %d: %v", i, err)
+			}
+		}
+		start, err := time.Parse("15:04", w.Start)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid start in maintenance window %d: %v", i, err)
+		}
+		if w.Duration.Duration <= 0 || w.Duration.Duration > 7*24*time.Hour {
+			return time.Time{}, fmt.Errorf("maintenance window %d must last between 0 and 168h", i)
+		}
+
+		// A window lasts at most a week, so only the openings of the last
+		// seven days can still be running.
+		local := now.In(loc)
+		for days := 0; days <= 7; days++ {
+			opened := time.Date(local.Year(), local.Month(), local.Day()-days, start.Hour(), start.Minute(), 0, 0, loc)
+			closes := opened.Add(w.Duration.Duration)
+			if !opensOn(w, opened.Weekday()) || now.Before(opened) || !now.Before(closes) {
+				continue
+			}
+			if closes.After(end) {
+				end = closes
+			}
+		}
+	}
+	return end, nil
+}
+
+// deferDuringMaintenance returns a *pendingError deferring action, and a
+// requeue for when the maintenance window closes, while a window is open.
+// Components call it before anything disruptive, such as changing the worker
+// count or rolling the workers.
+func deferDuringMaintenance(addon *addonv1alpha1.StarburstAddon, action string) (ctrl.Result, error) {
+	end, err := maintenanceWindowEnd(addon.Spec.MaintenanceWindows, time.Now())
+	if err != nil || end.IsZero() {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: time.Until(end)}, &pendingError{
+		reason:  "MaintenanceWindow",
+		message: fmt.Sprintf("%s is deferred until the maintenance window closes", action),
+	}
+}
+
+func opensOn(w addonv1alpha1.MaintenanceWindow, day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if string(d) == day.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// setMaintenanceCondition records whether disruptive changes are currently
+// deferred by a maintenance window.
+func setMaintenanceCondition(addon *addonv1alpha1.StarburstAddon, end time.Time, err error) {
+	condition := metav1.Condition{
+		Type:               addonv1alpha1.ConditionMaintenanceWindow,
+		Status:             metav1.ConditionFalse,
+		Reason:             "NoWindowOpen",
+		Message:            "No maintenance window is open",
+		ObservedGeneration: addon.Generation,
+	}
+	switch {
+	case err != nil:
+		condition.Reason = "InvalidMaintenanceWindow"
+		condition.Message = err.Error()
+	case !end.IsZero():
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "WindowOpen"
+		condition.Message = fmt.Sprintf("Operand upgrades and disruptive changes are deferred until %s", end.UTC().Format(time.RFC3339))
+	}
+	meta.SetStatusCondition(&addon.Status.Conditions, condition)
+}
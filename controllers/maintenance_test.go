@@ -0,0 +1,144 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+func TestMaintenanceWindowEnd(t *testing.T) {
+	// 2022-11-05 is a Saturday.
+	saturdayNight := addonv1alpha1.MaintenanceWindow{
+		Days:     []addonv1alpha1.Weekday{"Saturday"},
+		Start:    "22:00",
+		Duration: metav1.Duration{Duration: 4 * time.Hour},
+	}
+
+	cases := []struct {
+		name    string
+		windows []addonv1alpha1.MaintenanceWindow
+		now     time.Time
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name: "no windows",
+			now:  time.Date(2022, 11, 5, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "inside",
+			windows: []addonv1alpha1.MaintenanceWindow{saturdayNight},
+			now:     time.Date(2022, 11, 5, 23, 0, 0, 0, time.UTC),
+			want:    time.Date(2022, 11, 6, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "past midnight",
+			windows: []addonv1alpha1.MaintenanceWindow{saturdayNight},
+			now:     time.Date(2022, 11, 6, 1, 59, 0, 0, time.UTC),
+			want:    time.Date(2022, 11, 6, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "closed at end",
+			windows: []addonv1alpha1.MaintenanceWindow{saturdayNight},
+			now:     time.Date(2022, 11, 6, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "other day",
+			windows: []addonv1alpha1.MaintenanceWindow{saturdayNight},
+			now:     time.Date(2022, 11, 4, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "time zone",
+			windows: []addonv1alpha1.MaintenanceWindow{{
+				Start:    "09:00",
+				Duration: metav1.Duration{Duration: time.Hour},
+				TimeZone: "Europe/Berlin",
+			}},
+			now:  time.Date(2022, 11, 5, 8, 30, 0, 0, time.UTC),
+			want: time.Date(2022, 11, 5, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "overlapping windows",
+			windows: []addonv1alpha1.MaintenanceWindow{saturdayNight, {
+				Start:    "21:00",
+				Duration: metav1.Duration{Duration: 8 * time.Hour},
+			}},
+			now:  time.Date(2022, 11, 5, 23, 0, 0, 0, time.UTC),
+			want: time.Date(2022, 11, 6, 5, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "unknown time zone",
+			windows: []addonv1alpha1.MaintenanceWindow{{
+				Start:    "09:00",
+				Duration: metav1.Duration{Duration: time.Hour},
+				TimeZone: "Mars/Olympus_Mons",
+			}},
+			now:     time.Date(2022, 11, 5, 8, 30, 0, 0, time.UTC),
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := maintenanceWindowEnd(tc.windows, tc.now)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDeferDuringMaintenance(t *testing.T) {
+	// A window opening every day for a week is always open.
+	always := addonv1alpha1.MaintenanceWindow{Start: "00:00", Duration: metav1.Duration{Duration: 7 * 24 * time.Hour}}
+
+	cases := []struct {
+		name     string
+		windows  []addonv1alpha1.MaintenanceWindow
+		deferred bool
+		wantErr  bool
+	}{
+		{name: "no windows"},
+		{name: "open window", windows: []addonv1alpha1.MaintenanceWindow{always}, deferred: true, wantErr: true},
+		{name: "invalid window", windows: []addonv1alpha1.MaintenanceWindow{{Start: "25:00", Duration: always.Duration}}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		addon := testAddon(addonv1alpha1.StarburstAddonSpec{MaintenanceWindows: tc.windows})
+		result, err := deferDuringMaintenance(addon, "Autoscaling")
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tc.name, err, tc.wantErr)
+		}
+		var pending *pendingError
+		if deferred := errors.As(err, &pending); deferred != tc.deferred {
+			t.Errorf("%s: deferred = %v, want %v", tc.name, deferred, tc.deferred)
+		}
+		if tc.deferred && (pending.reason != "MaintenanceWindow" || result.RequeueAfter <= 0) {
+			t.Errorf("%s: got reason %s and requeue %s, want MaintenanceWindow and a requeue", tc.name, pending.reason, result.RequeueAfter)
+		}
+	}
+}
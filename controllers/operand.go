@@ -0,0 +1,337 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// StarburstEnterpriseGVK is the operand custom resource applied by the CronJob
+// from the parameters secret and reconciled by the Starburst Helm operator.
+var StarburstEnterpriseGVK = schema.GroupVersionKind{
+	Group:   "charts.starburstdata.com",
+	Version: "v1alpha1",
+	Kind:    "StarburstEnterprise",
+}
+
+// Deployments and services the StarburstEnterprise chart creates in the
+// operand namespace.
+const (
+	coordinatorDeployment = "coordinator"
+	workerDeployment      = "worker"
+	coordinatorService    = "starburst"
+	coordinatorPort       = 8080
+
+	// metricsPort names the port of the JMX exporter on the coordinator and
+	// the workers, which the ServiceMonitor scrapes.
+	metricsPort = "metrics"
+)
+
+// getStarburstEnterprise returns the StarburstEnterprise in namespace. A
+// NotFound error is returned until the CronJob has created it.
+func (r *StarburstAddonReconciler) getStarburstEnterprise(ctx context.Context, namespace string) (*unstructured.Unstructured, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(StarburstEnterpriseGVK.GroupVersion().WithKind(StarburstEnterpriseGVK.Kind + "List"))
+	if err := r.Client.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("could not list StarburstEnterprises: %v", err)
+	}
+
+	switch len(list.Items) {
+	case 0:
+		return nil, k8serrors.NewNotFound(schema.GroupResource{Group: StarburstEnterpriseGVK.Group, Resource: "starburstenterprises"}, namespace)
+	case 1:
+		return &list.Items[0], nil
+	default:
+		return nil, fmt.Errorf("found %d StarburstEnterprises in %s, expected one", len(list.Items), namespace)
+	}
+}
+
+// starburstEnterprisePatch starts an apply configuration for the fields of se
+// owned by one component.
+func starburstEnterprisePatch(se *unstructured.Unstructured) *unstructured.Unstructured {
+	patch := &unstructured.Unstructured{}
+	patch.SetGroupVersionKind(StarburstEnterpriseGVK)
+	patch.SetName(se.GetName())
+	patch.SetNamespace(se.GetNamespace())
+	return patch
+}
+
+// applyOperandPatch server-side applies a partial StarburstEnterprise. Each
+// component owning operand fields applies them under its own field manager,
+// so that they do not drop each other's fields.
+func (r *StarburstAddonReconciler) applyOperandPatch(ctx context.Context, addon *addonv1alpha1.StarburstAddon, component string, patch *unstructured.Unstructured) error {
+	if err := r.applyAs(ctx, addon, FieldManager+"-"+strings.ToLower(component), patch); err != nil {
+		if k8serrors.IsConflict(err) {
+			return &conflictError{objects: []string{fmt.Sprintf("%s %s/%s", patch.GetKind(), patch.GetNamespace(), patch.GetName())}}
+		}
+		return fmt.Errorf("could not apply %s %s: %v", patch.GetKind(), patch.GetName(), err)
+	}
+	return nil
+}
+
+// runningVersion is the image tag of the coordinator Deployment in namespace,
+// the version the chart rolled out. It is empty until the Deployment exists.
+func (r *StarburstAddonReconciler) runningVersion(ctx context.Context, namespace string) (string, error) {
+	d := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: coordinatorDeployment, Namespace: namespace}, d); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("could not get Deployment %s: %w", coordinatorDeployment, err)
+	}
+	if containers := d.Spec.Template.Spec.Containers; len(containers) > 0 {
+		return imageTag(containers[0].Image), nil
+	}
+	return "", nil
+}
+
+// imageTag returns the tag of an image reference, or "" if it has none.
+func imageTag(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// deploymentRolledOut reports whether every replica of the operand deployment
+// runs the given image tag in its main container and is available.
+func (r *StarburstAddonReconciler) deploymentRolledOut(ctx context.Context, namespace, name, tag string) (bool, error) {
+	d := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, d); err != nil {
+		return false, fmt.Errorf("could not get Deployment %s: %w", name, err)
+	}
+
+	containers := d.Spec.Template.Spec.Containers
+	if tag != "" && (len(containers) == 0 || !strings.HasSuffix(containers[0].Image, ":"+tag)) {
+		return false, nil
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	return d.Status.ObservedGeneration >= d.Generation &&
+		d.Status.UpdatedReplicas == replicas &&
+		d.Status.AvailableReplicas == replicas &&
+		d.Status.Replicas == replicas, nil
+}
+
+// operatorOwnedFields lists the StarburstEnterprise fields the operator sets
+// for the features enabled in spec.
+func operatorOwnedFields(spec addonv1alpha1.StarburstAddonSpec) [][]string {
+	var fields [][]string
+	if spec.Version != "" {
+		fields = append(fields,
+			[]string{"spec", "coordinator", "image", "tag"},
+			[]string{"spec", "worker", "image", "tag"})
+	}
+	if spec.Autoscaling != nil || spec.Schedule != nil {
+		fields = append(fields, []string{"spec", "worker", "replicas"})
+	}
+	if spec.Version != "" || spec.Autoscaling != nil || spec.Schedule != nil {
+		fields = append(fields,
+			[]string{"spec", "worker", "deploymentTerminationGracePeriodSeconds"},
+			[]string{"spec", "worker", "starburstWorkerShutdownGracePeriodSeconds"})
+	}
+	if spec.Schedule != nil && spec.Schedule.Coordinator {
+		fields = append(fields, []string{"spec", "coordinator", "replicas"})
+	}
+	// The security component applies these along with the values of the
+	// manifest, see userSecuritySettings.
+	if securityEnabled(spec) {
+		fields = append(fields,
+			[]string{"spec", "coordinator", "additionalProperties"},
+			[]string{"spec", "worker", "additionalProperties"},
+			[]string{"spec", "additionalVolumes"})
+	}
+	if spec.Authentication != nil {
+		fields = append(fields, coordinatorEtcFileFields("password-authenticator")...)
+	}
+	if spec.ResourceGroups != nil {
+		fields = append(fields, coordinatorEtcFileFields("resource-groups", "resource-groups.json")...)
+		fields = append(fields, coordinatorEtcFileFields("session-property-config", "session-property-config.json")...)
+	}
+	if spec.AccessControl != nil {
+		fields = append(fields, coordinatorEtcFileFields("access-control", "rules.json")...)
+	}
+	return fields
+}
+
+// coordinatorEtcFileFields are the fields of the <manager>.properties file and
+// the other files setCoordinatorEtcFile sets.
+func coordinatorEtcFileFields(manager string, files ...string) [][]string {
+	fields := [][]string{{"spec", "coordinator", "etcFiles", "properties", manager + ".properties"}}
+	for _, file := range files {
+		fields = append(fields, []string{"spec", "coordinator", "etcFiles", "other", file})
+	}
+	return fields
+}
+
+// userOperand returns the StarburstEnterprise document of the parameters
+// secret, nil while there is none.
+func (r *StarburstAddonReconciler) userOperand(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (map[string]interface{}, error) {
+	params, err := r.getSecret(ctx, "addon-managed-starburst-parameters", addon.Namespace)
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg := ResolveConfig(addon, RenderInputs{UserParams: params})
+	for _, doc := range splitManifest(cfg.Operand) {
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			return nil, fmt.Errorf("could not parse manifest: %v", err)
+		}
+		if obj["kind"] == StarburstEnterpriseGVK.Kind {
+			return obj, nil
+		}
+	}
+	return nil, nil
+}
+
+// stripOperatorFields removes fields from the StarburstEnterprise documents of
+// manifest. The CronJob applies the manifest every minute and would otherwise
+// put back the values of starburstenterprise.yaml over those of the operator.
+// Documents without any of the fields are kept as they are.
+func stripOperatorFields(manifest []byte, fields [][]string) ([]byte, error) {
+	if len(fields) == 0 {
+		return manifest, nil
+	}
+	return editStarburstEnterprises(manifest, func(obj map[string]interface{}) bool {
+		stripped := false
+		for _, field := range fields {
+			if _, found, _ := unstructured.NestedFieldNoCopy(obj, field...); found {
+				unstructured.RemoveNestedField(obj, field...)
+				stripped = true
+			}
+		}
+		return stripped
+	})
+}
+
+// addOperandEnvFrom appends the operandEnvFrom Secrets to spec.envFrom of the
+// StarburstEnterprise documents of manifest, after the entries it lists.
+func addOperandEnvFrom(manifest []byte) ([]byte, error) {
+	return editStarburstEnterprises(manifest, func(obj map[string]interface{}) bool {
+		envFrom, _, _ := unstructured.NestedSlice(obj, "spec", "envFrom")
+		_ = unstructured.SetNestedSlice(obj, append(envFrom, operandEnvFrom()...), "spec", "envFrom")
+		return true
+	})
+}
+
+// manifestResources returns the resources of the documents of manifest other
+// than the StarburstEnterprise, which the CronJob needs to be allowed to
+// apply. The Role of the CronJob only grants access to its own namespace, so
+// cluster-scoped kinds and other namespaces are rejected.
+func manifestResources(manifest []byte, mapper meta.RESTMapper) ([]schema.GroupResource, error) {
+	var resources []schema.GroupResource
+	for i, doc := range splitManifest(manifest) {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(doc, &obj.Object); err != nil {
+			return nil, fmt.Errorf("could not parse manifest document %d: %v", i+1, err)
+		}
+		gvk := obj.GroupVersionKind()
+		if gvk.GroupKind() == StarburstEnterpriseGVK.GroupKind() {
+			continue
+		}
+		if gvk.Kind == "" {
+			return nil, fmt.Errorf("manifest document %d has no kind", i+1)
+		}
+		if ns := obj.GetNamespace(); ns != "" && ns != Namespace {
+			return nil, fmt.Errorf("manifest document %d: %s %s is in namespace %s, the CronJob only applies objects in %s", i+1, gvk.Kind, obj.GetName(), ns, Namespace)
+		}
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, fmt.Errorf("manifest document %d: could not find the resource of %s: %v", i+1, gvk, err)
+		}
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			return nil, fmt.Errorf("manifest document %d: %s is cluster-scoped, the CronJob only applies objects in %s", i+1, gvk.Kind, Namespace)
+		}
+		resources = append(resources, mapping.Resource.GroupResource())
+	}
+	return resources, nil
+}
+
+// editStarburstEnterprises calls edit on each StarburstEnterprise document of
+// manifest and renders again those it reports as changed.
+func editStarburstEnterprises(manifest []byte, edit func(obj map[string]interface{}) bool) ([]byte, error) {
+	docs := splitManifest(manifest)
+	for i, doc := range docs {
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			return nil, fmt.Errorf("could not parse manifest: %v", err)
+		}
+		if obj["kind"] != StarburstEnterpriseGVK.Kind || !edit(obj) {
+			continue
+		}
+		var err error
+		if docs[i], err = yaml.Marshal(obj); err != nil {
+			return nil, fmt.Errorf("could not render manifest: %v", err)
+		}
+	}
+	return joinManifest(docs), nil
+}
+
+// documentSeparator matches the lines separating the documents of a YAML
+// manifest.
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*(#.*)?$`)
+
+// splitManifest splits a YAML manifest into its documents, dropping the empty
+// ones.
+func splitManifest(manifest []byte) [][]byte {
+	var docs [][]byte
+	for _, doc := range documentSeparator.Split(string(manifest), -1) {
+		if strings.TrimSpace(doc) != "" {
+			docs = append(docs, []byte(strings.TrimLeft(doc, "\n")))
+		}
+	}
+	return docs
+}
+
+// joinManifest is the inverse of splitManifest.
+func joinManifest(docs [][]byte) []byte {
+	var buf bytes.Buffer
+	for i, doc := range docs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(doc)
+		if !bytes.HasSuffix(doc, []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+func TestStripOperatorFields(t *testing.T) {
+	manifest := `# applied by the CronJob
+apiVersion: charts.starburstdata.com/v1alpha1
+kind: StarburstEnterprise
+metadata:
+  name: starburst
+spec:
+  image:
+    tag: 402-e.6
+  coordinator:
+    image:
+      tag: 402-e.6
+    replicas: 1
+  worker:
+    deploymentTerminationGracePeriodSeconds: 600
+    image:
+      tag: 402-e.6
+    replicas: 3
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+data:
+  replicas: "3"
+`
+
+	cases := []struct {
+		name string
+		spec addonv1alpha1.StarburstAddonSpec
+		want string
+	}{
+		{"nothing owned", addonv1alpha1.StarburstAddonSpec{}, manifest},
+		{"version and autoscaling", addonv1alpha1.StarburstAddonSpec{
+			Version:     "413-e.1",
+			Autoscaling: &addonv1alpha1.Autoscaling{MaxWorkers: 5},
+		}, `apiVersion: charts.starburstdata.com/v1alpha1
+kind: StarburstEnterprise
+metadata:
+  name: starburst
+spec:
+  coordinator:
+    image: {}
+    replicas: 1
+  image:
+    tag: 402-e.6
+  worker:
+    image: {}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+data:
+  replicas: "3"
+`},
+		{"schedule with the coordinator", addonv1alpha1.StarburstAddonSpec{
+			Schedule: &addonv1alpha1.Schedule{Coordinator: true},
+		}, `apiVersion: charts.starburstdata.com/v1alpha1
+kind: StarburstEnterprise
+metadata:
+  name: starburst
+spec:
+  coordinator:
+    image:
+      tag: 402-e.6
+  image:
+    tag: 402-e.6
+  worker:
+    image:
+      tag: 402-e.6
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+data:
+  replicas: "3"
+`},
+	}
+
+	for _, tc := range cases {
+		got, err := stripOperatorFields([]byte(manifest), operatorOwnedFields(tc.spec))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStripSecurityFields(t *testing.T) {
+	manifest := `apiVersion: charts.starburstdata.com/v1alpha1
+kind: StarburstEnterprise
+spec:
+  additionalVolumes:
+  - path: /etc/extra
+  coordinator:
+    additionalProperties: query.max-memory=10GB
+    etcFiles:
+      other:
+        extra.json: '{}'
+        rules.json: '{}'
+      properties:
+        access-control.properties: access-control.name=allow-all
+        event-listener.properties: event-listener.name=audit
+  envFrom:
+  - secretRef:
+      name: extra-env
+  worker:
+    additionalProperties: query.max-memory-per-node=4GB
+`
+	spec := addonv1alpha1.StarburstAddonSpec{
+		Authentication: &addonv1alpha1.Authentication{Type: "PasswordFile"},
+		AccessControl:  &addonv1alpha1.AccessControl{},
+	}
+	got, err := stripOperatorFields([]byte(manifest), operatorOwnedFields(spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: charts.starburstdata.com/v1alpha1
+kind: StarburstEnterprise
+spec:
+  coordinator:
+    etcFiles:
+      other:
+        extra.json: '{}'
+      properties:
+        event-listener.properties: event-listener.name=audit
+  envFrom:
+  - secretRef:
+      name: extra-env
+  worker: {}
+`
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestManifestResources(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+
+	manifest := `apiVersion: charts.starburstdata.com/v1alpha1
+kind: StarburstEnterprise
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: hive-metastore
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+  namespace: ` + Namespace + `
+`
+	got, err := manifestResources([]byte(manifest), mapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []schema.GroupResource{{Resource: "secrets"}, {Resource: "configmaps"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got resources %v, want %v", got, want)
+	}
+
+	rules := DeployApplyRBAC(RenderConfig{Name: Name, Namespace: Namespace, OperandResources: got})[1].(*rbacv1.Role).Rules
+	wantRules := []rbacv1.PolicyRule{
+		{APIGroups: []string{StarburstEnterpriseGVK.Group}, Resources: []string{"starburstenterprises"}, Verbs: []string{"get", "create", "patch"}},
+		{APIGroups: []string{""}, Resources: []string{"configmaps", "secrets"}, Verbs: []string{"get", "create", "patch"}},
+	}
+	if !reflect.DeepEqual(rules, wantRules) {
+		t.Errorf("got rules %+v, want %+v", rules, wantRules)
+	}
+
+	for _, invalid := range []string{
+		"apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\n",
+		"apiVersion: v1\nkind: Secret\nmetadata:\n  namespace: default\n",
+		"apiVersion: example.com/v1\nkind: Widget\n",
+		"apiVersion: v1\n",
+	} {
+		if _, err := manifestResources([]byte(invalid), mapper); err == nil {
+			t.Errorf("manifestResources(%q) succeeded, want an error", invalid)
+		}
+	}
+}
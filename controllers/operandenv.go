@@ -0,0 +1,151 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// envReference matches the ${ENV:NAME} references Trino resolves from its
+// environment when it loads a properties file.
+var envReference = regexp.MustCompile(`\$\{ENV:([A-Za-z][A-Za-z0-9_]*)\}`)
+
+// envNameInvalid matches the characters that cannot be part of an environment
+// variable name.
+var envNameInvalid = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// envDigestKey holds, in the Secret returned by operandEnvSecret, the key of
+// the digests that end the variable names.
+const envDigestKey = "ENV_DIGEST_KEY"
+
+// operandEnvComponents are the components handing secret values to the Trino
+// nodes through their operandEnvSecret.
+var operandEnvComponents = []string{"Operand", "Catalogs", "Security"}
+
+// operandEnvSecret is the Secret holding the values component hands to the
+// Trino nodes as environment variables. Properties reference them as
+// ${ENV:NAME}, so that the values never land in the StarburstEnterprise.
+func operandEnvSecret(component string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      Name + "-" + strings.ToLower(component) + "-env",
+			Namespace: Namespace,
+		},
+		Data: data,
+	}
+}
+
+// operandEnvFrom lists the Secrets of every component in spec.envFrom of the
+// StarburstEnterprise. The Operand component adds them to the manifest the
+// CronJob applies, so that they never conflict with the entries of the
+// manifest. The Secrets are optional since each only exists while its
+// component has values.
+func operandEnvFrom() []interface{} {
+	var envFrom []interface{}
+	for _, component := range operandEnvComponents {
+		envFrom = append(envFrom, map[string]interface{}{
+			"secretRef": map[string]interface{}{
+				"name":     operandEnvSecret(component, nil).Name,
+				"optional": true,
+			},
+		})
+	}
+	return envFrom
+}
+
+// operandEnv collects the values a component hands to the Trino nodes.
+type operandEnv struct {
+	key  []byte
+	live map[string][]byte
+	vars map[string]string
+}
+
+// operandEnv loads the Secret of component, generating its digest key the
+// first time.
+func (r *StarburstAddonReconciler) operandEnv(ctx context.Context, component string) (*operandEnv, error) {
+	env := &operandEnv{vars: map[string]string{}}
+	secret, err := r.getSecret(ctx, operandEnvSecret(component, nil).Name, Namespace)
+	switch {
+	case err == nil:
+		env.live = secret.Data
+		env.key = secret.Data[envDigestKey]
+	case !k8serrors.IsNotFound(err):
+		return nil, err
+	}
+	if len(env.key) == 0 {
+		env.key = make([]byte, 32)
+		if _, err := rand.Read(env.key); err != nil {
+			return nil, fmt.Errorf("could not generate the digest key of %s: %v", component, err)
+		}
+	}
+	return env, nil
+}
+
+// ref stores value in a variable named after name and returns the reference
+// to it. The name ends in a keyed digest of the value, so the properties
+// change when the value does and the chart rolls the nodes, which only read
+// their environment at startup.
+func (e *operandEnv) ref(name, value string) string {
+	mac := hmac.New(sha256.New, e.key)
+	mac.Write([]byte(value))
+	digest := strings.ToUpper(hex.EncodeToString(mac.Sum(nil))[:8])
+
+	v := envNameInvalid.ReplaceAllString(strings.ToUpper(name), "_") + "_" + digest
+	e.vars[v] = value
+	return "${ENV:" + v + "}"
+}
+
+// keep holds on to the live values referenced from text, for properties that
+// keep their last applied value.
+func (e *operandEnv) keep(text string) {
+	for _, match := range envReference.FindAllStringSubmatch(text, -1) {
+		if value, ok := e.live[match[1]]; ok {
+			e.vars[match[1]] = string(value)
+		}
+	}
+}
+
+// applyOperandEnv writes the values collected in env into the Secret of
+// component, or deletes the Secret when there are none.
+func (r *StarburstAddonReconciler) applyOperandEnv(ctx context.Context, addon *addonv1alpha1.StarburstAddon, component string, env *operandEnv) error {
+	if len(env.vars) == 0 {
+		return r.deleteAll(ctx, addon, operandEnvSecret(component, nil))
+	}
+
+	data := map[string][]byte{envDigestKey: env.key}
+	for name, value := range env.vars {
+		data[name] = []byte(value)
+	}
+	return r.applyAll(ctx, addon, operandEnvSecret(component, data))
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestOperandEnvRef(t *testing.T) {
+	env := &operandEnv{key: []byte("key"), vars: map[string]string{}}
+
+	ref := env.ref("catalog_sales-db_connection-password", "hunter2")
+	if !regexp.MustCompile(`^\$\{ENV:CATALOG_SALES_DB_CONNECTION_PASSWORD_[0-9A-F]{8}\}$`).MatchString(ref) {
+		t.Fatalf("ref() = %s, want a reference to CATALOG_SALES_DB_CONNECTION_PASSWORD with a digest", ref)
+	}
+	if strings.Contains(ref, "hunter2") {
+		t.Errorf("ref() = %s carries the value", ref)
+	}
+	name := envReference.FindStringSubmatch(ref)[1]
+	if env.vars[name] != "hunter2" {
+		t.Errorf("variable %s = %q, want the value", name, env.vars[name])
+	}
+
+	if again := env.ref("catalog_sales-db_connection-password", "hunter2"); again != ref {
+		t.Errorf("ref() = %s for the same value, want %s", again, ref)
+	}
+	if rotated := env.ref("catalog_sales-db_connection-password", "hunter3"); rotated == ref {
+		t.Errorf("ref() = %s for a new value, want another name so the nodes restart", rotated)
+	}
+	other := &operandEnv{key: []byte("other"), vars: map[string]string{}}
+	if ref == other.ref("catalog_sales-db_connection-password", "hunter2") {
+		t.Errorf("ref() digest does not depend on the key")
+	}
+}
+
+func TestOperandEnvKeep(t *testing.T) {
+	env := &operandEnv{
+		live: map[string][]byte{"A_0123ABCD": []byte("a"), "B_0123ABCD": []byte("b")},
+		vars: map[string]string{},
+	}
+	env.keep("connector.name=postgresql\nconnection-password=${ENV:A_0123ABCD}\nconnection-user=${ENV:GONE_0123ABCD}")
+	if len(env.vars) != 1 || env.vars["A_0123ABCD"] != "a" {
+		t.Errorf("keep() kept %v, want only A_0123ABCD", env.vars)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// secretPlaceholder matches ${secret:<name>/<key>}, which is replaced by the
+// value of key in the Secret name of the operand namespace.
+var secretPlaceholder = regexp.MustCompile(`\$\{secret:([a-z0-9]([-a-z0-9.]*[a-z0-9])?)/([-._a-zA-Z0-9]+)\}`)
+
+// expandPlaceholders replaces the secret placeholders in s with the values
+// returned by lookup. Values must fit on one line so that they cannot add
+// properties or YAML of their own. Errors name the secret, never the value.
+func expandPlaceholders(s string, lookup func(name, key string) (string, error)) (string, error) {
+	var err error
+	expanded := secretPlaceholder.ReplaceAllStringFunc(s, func(placeholder string) string {
+		if err != nil {
+			return placeholder
+		}
+		match := secretPlaceholder.FindStringSubmatch(placeholder)
+		name, key := match[1], match[3]
+
+		var value string
+		if value, err = lookup(name, key); err != nil {
+			err = fmt.Errorf("could not resolve ${secret:%s/%s}: %w", name, key, err)
+			return placeholder
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			err = fmt.Errorf("could not resolve ${secret:%s/%s}: the value must fit on one line", name, key)
+			return placeholder
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+// expandManifestPlaceholders replaces the placeholders in the
+// StarburstEnterprise documents of manifest with references to variables of
+// env, so that the values reach the Trino nodes through their environment and
+// never land in the manifest. Trino resolves the references in properties.
+// Other documents are applied as they are and cannot hold placeholders. The
+// documents are parsed first, so nothing is pasted into the YAML.
+func expandManifestPlaceholders(manifest []byte, lookup func(name, key string) (string, error), env *operandEnv) ([]byte, error) {
+	if !secretPlaceholder.Match(manifest) {
+		return manifest, nil
+	}
+
+	refs := envRefs(lookup, env)
+	docs := splitManifest(manifest)
+	for i := range docs {
+		if !secretPlaceholder.Match(docs[i]) {
+			continue
+		}
+		var doc map[string]interface{}
+		if err := yaml.Unmarshal(docs[i], &doc); err != nil {
+			return nil, fmt.Errorf("could not parse manifest document %d: %v", i+1, err)
+		}
+		if doc["kind"] != StarburstEnterpriseGVK.Kind {
+			return nil, fmt.Errorf("manifest document %d: secret placeholders are only resolved in the %s", i+1, StarburstEnterpriseGVK.Kind)
+		}
+		expanded, err := expandValue(doc, refs)
+		if err != nil {
+			return nil, err
+		}
+		if docs[i], err = yaml.Marshal(expanded); err != nil {
+			return nil, fmt.Errorf("could not render manifest document %d: %v", i+1, err)
+		}
+	}
+	return joinManifest(docs), nil
+}
+
+// envRefs wraps lookup so that placeholders are replaced by references to
+// variables of env holding their values.
+func envRefs(lookup func(name, key string) (string, error), env *operandEnv) func(name, key string) (string, error) {
+	return func(name, key string) (string, error) {
+		value, err := lookup(name, key)
+		if err != nil {
+			return "", err
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return "", errors.New("the value must fit on one line")
+		}
+		return env.ref("secret_"+name+"_"+key, value), nil
+	}
+}
+
+func expandValue(v interface{}, lookup func(name, key string) (string, error)) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case string:
+		return expandPlaceholders(v, lookup)
+	case map[string]interface{}:
+		for k, item := range v {
+			if v[k], err = expandValue(item, lookup); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if v[i], err = expandValue(item, lookup); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// secretLookup reads placeholder values from the Secrets in namespace,
+// fetching each Secret once. Changes to them are picked up through the Secret
+// watch, which re-renders everything that references them.
+func (r *StarburstAddonReconciler) secretLookup(ctx context.Context, namespace string) func(name, key string) (string, error) {
+	secrets := map[string]*corev1.Secret{}
+	return func(name, key string) (string, error) {
+		secret, ok := secrets[name]
+		if !ok {
+			var err error
+			if secret, err = r.getSecret(ctx, name, namespace); err != nil {
+				return "", err
+			}
+			secrets[name] = secret
+		}
+		value, ok := secret.Data[key]
+		if !ok {
+			return "", fmt.Errorf("Secret %s has no key %s", name, key)
+		}
+		return string(value), nil
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+func testLookup(name, key string) (string, error) {
+	values := map[string]string{
+		"db/password":  "s3cr:t \"quoted\"",
+		"aws/key":      "AKIA123",
+		"bad/newline":  "a\nconnector.name=tpch",
+		"bad/password": "hunter2",
+	}
+	value, ok := values[name+"/"+key]
+	if !ok {
+		return "", fmt.Errorf("Secret %s has no key %s", name, key)
+	}
+	return value, nil
+}
+
+func TestExpandPlaceholders(t *testing.T) {
+	cases := []struct {
+		in, want string
+		valid    bool
+	}{
+		{"plain", "plain", true},
+		{"${secret:db/password}", "s3cr:t \"quoted\"", true},
+		{"key=${secret:aws/key};pw=${secret:db/password}", "key=AKIA123;pw=s3cr:t \"quoted\"", true},
+		{"${secret:db/missing}", "", false},
+		{"${secret:bad/newline}", "", false},
+		{"${secret:Upper/key}", "${secret:Upper/key}", true},
+	}
+
+	for _, tc := range cases {
+		got, err := expandPlaceholders(tc.in, testLookup)
+		if (err == nil) != tc.valid {
+			t.Errorf("expandPlaceholders(%q) error = %v, want valid %v", tc.in, err, tc.valid)
+			continue
+		}
+		if tc.valid && got != tc.want {
+			t.Errorf("expandPlaceholders(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestExpandPlaceholdersHidesValues(t *testing.T) {
+	_, err := expandPlaceholders("${secret:bad/password}${secret:bad/newline}", testLookup)
+	if err == nil {
+		t.Fatal("expected an error for a multi-line value")
+	}
+	if strings.Contains(err.Error(), "hunter2") || strings.Contains(err.Error(), "connector.name") {
+		t.Errorf("error %q contains a secret value", err)
+	}
+}
+
+func TestExpandManifestPlaceholders(t *testing.T) {
+	key := []byte("digest key")
+	refs := &operandEnv{key: key, vars: map[string]string{}}
+	password := refs.ref("secret_db_password", "s3cr:t \"quoted\"")
+	awsKey := refs.ref("secret_aws_key", "AKIA123")
+
+	manifest := []byte(`apiVersion: charts.starburstdata.com/v1alpha1
+kind: StarburstEnterprise
+spec:
+  catalogs:
+    sales: |-
+      connector.name=postgresql
+      connection-password=${secret:db/password}
+  coordinator:
+    additionalProperties: s3.aws-access-key=${secret:aws/key}
+---
+apiVersion: v1
+kind: ConfigMap
+data:
+  applied: as is
+`)
+	env := &operandEnv{key: key, vars: map[string]string{}}
+	got, err := expandManifestPlaceholders(manifest, testLookup, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf(`apiVersion: charts.starburstdata.com/v1alpha1
+kind: StarburstEnterprise
+spec:
+  catalogs:
+    sales: |-
+      connector.name=postgresql
+      connection-password=%s
+  coordinator:
+    additionalProperties: s3.aws-access-key=%s
+---
+apiVersion: v1
+kind: ConfigMap
+data:
+  applied: as is
+`, password, awsKey)
+	if string(got) != want {
+		t.Errorf("expandManifestPlaceholders() =\n%s\nwant\n%s", got, want)
+	}
+	if !reflect.DeepEqual(env.vars, refs.vars) {
+		t.Errorf("got variables %v, want %v", env.vars, refs.vars)
+	}
+
+	plain := []byte("kind: StarburstEnterprise\n")
+	if got, err := expandManifestPlaceholders(plain, testLookup, env); err != nil || string(got) != string(plain) {
+		t.Errorf("manifest without placeholders changed: %q, %v", got, err)
+	}
+
+	for _, invalid := range []string{
+		"kind: StarburstEnterprise\n---\nkind: Secret\nstringData:\n  password: ${secret:db/password}\n",
+		"kind: StarburstEnterprise\nspec:\n  catalogs:\n    bad: ${secret:bad/newline}\n",
+	} {
+		if _, err := expandManifestPlaceholders([]byte(invalid), testLookup, env); err == nil {
+			t.Errorf("expandManifestPlaceholders(%q) succeeded, want an error", invalid)
+		} else if strings.Contains(err.Error(), "s3cr:t") || strings.Contains(err.Error(), "connector.name=tpch") {
+			t.Errorf("error %q contains a secret value", err)
+		}
+	}
+}
+
+func TestOperandManifestHidesSecretValues(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `apiVersion: charts.starburstdata.com/v1alpha1
+kind: StarburstEnterprise
+metadata:
+  name: starburst
+spec:
+  envFrom:
+  - secretRef:
+      name: extra-env
+  catalogs:
+    sales: |-
+      connector.name=postgresql
+      connection-password=${secret:db/password}
+`
+	c := applyClient{fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "addon-managed-starburst-parameters", Namespace: Namespace},
+			Data:       map[string][]byte{operandManifestKey: []byte(manifest)},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: Namespace},
+			Data:       map[string][]byte{"password": []byte("hunter2")},
+		},
+	).Build()}
+	r := &StarburstAddonReconciler{Client: c}
+	ctx := context.Background()
+
+	if _, err := (&operandComponent{r: r}).Reconcile(ctx, testAddon(addonv1alpha1.StarburstAddonSpec{})); err != nil {
+		t.Fatal(err)
+	}
+
+	applied := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Name: Name + "-operand", Namespace: Namespace}, applied); err != nil {
+		t.Fatal(err)
+	}
+	got := string(applied.Data[operandManifestKey])
+	if strings.Contains(got, "hunter2") {
+		t.Errorf("the applied manifest contains a secret value:\n%s", got)
+	}
+	match := envReference.FindStringSubmatch(got)
+	if match == nil {
+		t.Fatalf("the applied manifest does not reference the secret value:\n%s", got)
+	}
+	for _, name := range []string{"extra-env", Name + "-operand-env", Name + "-catalogs-env", Name + "-security-env"} {
+		if !strings.Contains(got, "name: "+name) {
+			t.Errorf("the applied manifest does not load Secret %s:\n%s", name, got)
+		}
+	}
+
+	env := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Name: Name + "-operand-env", Namespace: Namespace}, env); err != nil {
+		t.Fatal(err)
+	}
+	if value := string(env.Data[match[1]]); value != "hunter2" {
+		t.Errorf("got %s=%q in the operand env Secret, want the secret value", match[1], value)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Actions reported in status.plan.
+const (
+	PlanCreate = "Create"
+	PlanPatch  = "Patch"
+	PlanDelete = "Delete"
+)
+
+// planApply dry-runs the server-side apply of obj and records whether it
+// would create the object or change the live one.
+func (r *StarburstAddonReconciler) planApply(ctx context.Context, addon *addonv1alpha1.StarburstAddon, obj client.Object, opts ...client.PatchOption) error {
+	live, err := r.getLive(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	// The dry-run still reports field conflicts, so they show up in plan mode
+	// exactly as they would when applying. It is made on a copy so obj keeps
+	// its type information for the report.
+	applied := obj.DeepCopyObject().(client.Object)
+	if err := r.Client.Patch(ctx, applied, client.Apply, append(opts, client.DryRunAll)...); err != nil {
+		return err
+	}
+
+	if live == nil {
+		recordPlan(ctx, addon, PlanCreate, obj)
+		return nil
+	}
+	changed, err := differs(live, applied)
+	if err != nil {
+		return err
+	}
+	if changed {
+		recordPlan(ctx, addon, PlanPatch, obj)
+	}
+	return nil
+}
+
+// planDelete records the deletion of obj if it exists.
+func (r *StarburstAddonReconciler) planDelete(ctx context.Context, addon *addonv1alpha1.StarburstAddon, obj client.Object) error {
+	live, err := r.getLive(ctx, obj)
+	if err != nil {
+		return err
+	}
+	if live != nil {
+		recordPlan(ctx, addon, PlanDelete, obj)
+	}
+	return nil
+}
+
+// getLive fetches the live copy of obj, or nil if it does not exist.
+func (r *StarburstAddonReconciler) getLive(ctx context.Context, obj client.Object) (client.Object, error) {
+	live := obj.DeepCopyObject().(client.Object)
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get %s %s: %v", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+	}
+	return live, nil
+}
+
+// differs compares the live object with the result of the dry-run apply,
+// ignoring the fields the API server updates on every write.
+func differs(live, applied client.Object) (bool, error) {
+	a, err := comparable(live)
+	if err != nil {
+		return false, err
+	}
+	b, err := comparable(applied)
+	if err != nil {
+		return false, err
+	}
+	return !equality.Semantic.DeepEqual(a, b), nil
+}
+
+func comparable(obj runtime.Object) (map[string]interface{}, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert object: %v", err)
+	}
+	delete(u, "apiVersion")
+	delete(u, "kind")
+	delete(u, "status")
+	for _, field := range []string{"managedFields", "resourceVersion", "generation"} {
+		unstructured.RemoveNestedField(u, "metadata", field)
+	}
+	return u, nil
+}
+
+// recordPlan adds a planned change to the addon's status and logs it.
+func recordPlan(ctx context.Context, addon *addonv1alpha1.StarburstAddon, action string, obj client.Object) {
+	change := addonv1alpha1.PlannedChange{
+		Action:    action,
+		Kind:      obj.GetObjectKind().GroupVersionKind().Kind,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+	}
+	log.FromContext(ctx).Info("Planned change", "action", change.Action, "kind", change.Kind, "namespace", change.Namespace, "name", change.Name)
+	addon.Status.Plan = append(addon.Status.Plan, change)
+}
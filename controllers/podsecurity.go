@@ -0,0 +1,168 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// podSecurityViolations checks pod against the restricted pod security
+// profile and for the resource limits of every container.
+func podSecurityViolations(pod *corev1.Pod) []string {
+	var violations []string
+	podSC := pod.Spec.SecurityContext
+	if podSC == nil {
+		podSC = &corev1.PodSecurityContext{}
+	}
+	if pod.Spec.HostNetwork || pod.Spec.HostPID || pod.Spec.HostIPC {
+		violations = append(violations, "shares a host namespace")
+	}
+
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		sc := c.SecurityContext
+		if sc == nil {
+			sc = &corev1.SecurityContext{}
+		}
+		add := func(format string, args ...interface{}) {
+			violations = append(violations, fmt.Sprintf("container %s: ", c.Name)+fmt.Sprintf(format, args...))
+		}
+
+		nonRoot := sc.RunAsNonRoot
+		if nonRoot == nil {
+			nonRoot = podSC.RunAsNonRoot
+		}
+		if nonRoot == nil || !*nonRoot {
+			add("runAsNonRoot is not true")
+		}
+		if sc.Privileged != nil && *sc.Privileged {
+			add("is privileged")
+		}
+		if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+			add("allowPrivilegeEscalation is not false")
+		}
+		if sc.Capabilities == nil || !containsCapability(sc.Capabilities.Drop, "ALL") {
+			add("does not drop ALL capabilities")
+		}
+		seccomp := sc.SeccompProfile
+		if seccomp == nil {
+			seccomp = podSC.SeccompProfile
+		}
+		if seccomp == nil || (seccomp.Type != corev1.SeccompProfileTypeRuntimeDefault && seccomp.Type != corev1.SeccompProfileTypeLocalhost) {
+			add("seccomp profile is not RuntimeDefault")
+		}
+		if sc.ReadOnlyRootFilesystem == nil || !*sc.ReadOnlyRootFilesystem {
+			add("readOnlyRootFilesystem is not true")
+		}
+		for _, resource := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			if _, ok := c.Resources.Limits[resource]; !ok {
+				add("has no %s limit", resource)
+			}
+		}
+	}
+	return violations
+}
+
+func containsCapability(list []corev1.Capability, capability corev1.Capability) bool {
+	for _, c := range list {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// podWorkload names the workload a pod belongs to, so that the replicas of a
+// Deployment are reported once.
+func podWorkload(pod *corev1.Pod) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "Pod/" + pod.Name
+	}
+	if hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; owner.Kind == "ReplicaSet" && hash != "" {
+		return "Deployment/" + strings.TrimSuffix(owner.Name, "-"+hash)
+	}
+	return owner.Kind + "/" + owner.Name
+}
+
+// podSecurityComponent audits the pods of the operand namespace, including
+// those of the chart, and reports those that do not meet the restricted pod
+// security profile in status.podSecurityViolations. The pods the operator
+// renders itself are created compliant.
+type podSecurityComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *podSecurityComponent) Name() string { return "PodSecurity" }
+
+func (c *podSecurityComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	pods := &corev1.PodList{}
+	if err := c.r.Client.List(ctx, pods, client.InNamespace(Namespace)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("could not list pods: %v", err)
+	}
+
+	byWorkload := map[string]map[string]bool{}
+	for i := range pods.Items {
+		violations := podSecurityViolations(&pods.Items[i])
+		if len(violations) == 0 {
+			continue
+		}
+		workload := podWorkload(&pods.Items[i])
+		if byWorkload[workload] == nil {
+			byWorkload[workload] = map[string]bool{}
+		}
+		for _, v := range violations {
+			byWorkload[workload][v] = true
+		}
+	}
+
+	var (
+		status    []addonv1alpha1.PodSecurityViolation
+		workloads []string
+	)
+	for workload, set := range byWorkload {
+		violations := make([]string, 0, len(set))
+		for v := range set {
+			violations = append(violations, v)
+		}
+		sort.Strings(violations)
+		status = append(status, addonv1alpha1.PodSecurityViolation{Workload: workload, Violations: violations})
+		workloads = append(workloads, workload)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Workload < status[j].Workload })
+	sort.Strings(workloads)
+	addon.Status.PodSecurityViolations = status
+
+	if len(workloads) > 0 {
+		return ctrl.Result{}, &pendingError{
+			reason:  "PodSecurityViolations",
+			message: "Pods do not meet the restricted pod security profile, see status.podSecurityViolations: " + strings.Join(workloads, ", "),
+		}
+	}
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodSecurityViolations(t *testing.T) {
+	// The CronJob the operator renders must pass its own audit.
+	job := DeployCronJob(RenderConfig{Name: "starburst", Namespace: "ns", ApplyImage: defaultApplyImage})
+	pod := &corev1.Pod{Spec: job.Spec.JobTemplate.Spec.Template.Spec}
+	if got := podSecurityViolations(pod); len(got) != 0 {
+		t.Errorf("CronJob pod violations = %v, want none", got)
+	}
+
+	chart := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "worker"}}}}
+	got := podSecurityViolations(chart)
+	for _, want := range []string{
+		"container worker: runAsNonRoot is not true",
+		"container worker: allowPrivilegeEscalation is not false",
+		"container worker: does not drop ALL capabilities",
+		"container worker: seccomp profile is not RuntimeDefault",
+		"container worker: readOnlyRootFilesystem is not true",
+		"container worker: has no cpu limit",
+		"container worker: has no memory limit",
+	} {
+		if !containsString(got, want) {
+			t.Errorf("podSecurityViolations() = %v, missing %q", got, want)
+		}
+	}
+
+	// Pod-level settings apply to every container.
+	hardened := pod.DeepCopy()
+	hardened.Spec.Containers[0].SecurityContext.RunAsNonRoot = nil
+	if got := podSecurityViolations(hardened); len(got) != 0 {
+		t.Errorf("violations with runAsNonRoot from the pod = %v, want none", got)
+	}
+	hardened.Spec.SecurityContext = nil
+	if got := podSecurityViolations(hardened); len(got) != 2 {
+		t.Errorf("violations without pod security context = %v, want runAsNonRoot and seccomp", got)
+	}
+}
+
+func TestPodWorkload(t *testing.T) {
+	controller := true
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            "worker-7d9f8c-abcde",
+		Labels:          map[string]string{"pod-template-hash": "7d9f8c"},
+		OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "worker-7d9f8c", Controller: &controller}},
+	}}
+	if got := podWorkload(pod); got != "Deployment/worker" {
+		t.Errorf("podWorkload() = %q, want Deployment/worker", got)
+	}
+
+	pod.OwnerReferences = nil
+	if got := podWorkload(pod); got != "Pod/worker-7d9f8c-abcde" {
+		t.Errorf("podWorkload() = %q, want Pod/worker-7d9f8c-abcde", got)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// prometheusURL is the address of the managed Prometheus, served by the
+// prometheus-operated service the Prometheus operator creates.
+func prometheusURL(namespace string) string {
+	return fmt.Sprintf("http://prometheus-operated.%s.svc:9090", namespace)
+}
+
+// errNoSamples is returned by queryPrometheus when no series matched, as when
+// nothing exported the metric yet.
+var errNoSamples = errors.New("no samples")
+
+// queryPrometheus evaluates an instant query that returns a single sample.
+func queryPrometheus(ctx context.Context, baseURL, query string) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/v1/query?query="+url.QueryEscape(query), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("could not reach Prometheus: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			Result []struct {
+				Value [2]interface{} `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("could not decode Prometheus response: %v", err)
+	}
+	if body.Status != "success" {
+		return 0, fmt.Errorf("query %q failed: %s", query, body.Error)
+	}
+	if len(body.Data.Result) == 0 {
+		return 0, fmt.Errorf("query %q failed: %w", query, errNoSamples)
+	}
+	if len(body.Data.Result) != 1 {
+		return 0, fmt.Errorf("query %q returned %d samples, expected one", query, len(body.Data.Result))
+	}
+
+	value, ok := body.Data.Result[0].Value[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("query %q returned an invalid sample", query)
+	}
+	return strconv.ParseFloat(value, 64)
+}
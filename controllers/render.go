@@ -0,0 +1,1307 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+	configv1 "github.com/openshift/api/config/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	promv1alpha1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// RenderConfig is everything the Deploy* builders need. It is resolved once
+// from the StarburstAddon and the secrets it depends on, so the builders are
+// pure functions of it and can be exercised without a cluster.
+type RenderConfig struct {
+	// Name of the generated resources.
+	Name string
+	// Namespace the generated resources are created in.
+	Namespace string
+	// ClusterID is added as an external label to everything Prometheus ships.
+	ClusterID string
+	// License is the Starburst license copied into the starburst-license secret.
+	License string
+	// Operand is the StarburstEnterprise manifest the CronJob applies. Secret
+	// placeholders are resolved by the operator before it is rendered.
+	Operand []byte
+	// OperandResources are the resources of the other documents of Operand,
+	// which the CronJob is allowed to apply besides the StarburstEnterprise.
+	OperandResources []schema.GroupResource
+	// Metrics enables the Prometheus, ServiceMonitors and PrometheusRules.
+	Metrics bool
+	// RemoteWrite lists the endpoints Prometheus writes to.
+	RemoteWrite []addonv1alpha1.RemoteWriteTarget
+	// Thresholds of the managed alerts.
+	Thresholds AlertThresholds
+	// RunbookBaseURL is linked from the runbook_url of the managed alerts.
+	RunbookBaseURL string
+	// SuspendOperand stops the CronJob from applying the operand, deferring
+	// operand upgrades while a maintenance window is open.
+	SuspendOperand bool
+	// Asleep drops the alerting rules while the schedule keeps the cluster
+	// scaled to zero.
+	Asleep bool
+	// Expose is the external access to the coordinator, nil when it is not exposed.
+	Expose *ExposeConfig
+	// NetworkPolicy is spec.networkPolicy, nil when traffic is not restricted.
+	NetworkPolicy *addonv1alpha1.NetworkPolicy
+	// OperatorNamespace is where the operator calls the coordinator, the
+	// workers and Prometheus from.
+	OperatorNamespace string
+	// InternalTLS is set when the Trino nodes talk to each other over HTTPS.
+	InternalTLS bool
+	// Authentication is set when the coordinator authenticates its users.
+	Authentication bool
+	// ApplyImage runs the CronJob applying the operand.
+	ApplyImage string
+	// PrometheusImage overrides the Prometheus image chosen by the Prometheus
+	// operator when set.
+	PrometheusImage string
+	// Alerting is spec.alerting, nil when no Alertmanager is deployed.
+	Alerting *addonv1alpha1.Alerting
+}
+
+// ExposeConfig is the resolved spec.expose.
+type ExposeConfig struct {
+	// Type is Route or Ingress.
+	Type             string
+	Host             string
+	IngressClassName *string
+	// CertificateSecret is referenced by Ingresses. Routes embed its
+	// Certificate, Key and CACertificate instead.
+	CertificateSecret string
+	Certificate       string
+	Key               string
+	CACertificate     string
+	// Reencrypt is spec.expose.serviceCA: the Route re-encrypts to the HTTPS
+	// port of the coordinator, trusting DestinationCACertificate, or the
+	// service CA when it is empty.
+	Reencrypt                bool
+	DestinationCACertificate string
+}
+
+// AlertThresholds are the resolved values at which the managed alerts fire.
+type AlertThresholds struct {
+	QueryMemoryBytes    int64
+	HeapMemoryBytes     int64
+	MaxQueryMemoryBytes int64
+	MaxHeapMemoryBytes  int64
+	ActiveNodes         int32
+	ExpectedInstances   int32
+	ThreadCount         int32
+	JVMMemoryPercent    int32
+	FailedQueries       int32
+}
+
+// DefaultAlertThresholds returns the thresholds used when the StarburstAddon
+// does not override them.
+func DefaultAlertThresholds() AlertThresholds {
+	return AlertThresholds{
+		QueryMemoryBytes:    45158388108,
+		HeapMemoryBytes:     45631505600,
+		MaxQueryMemoryBytes: 94489280512,
+		MaxHeapMemoryBytes:  94489280512,
+		ActiveNodes:         1,
+		ExpectedInstances:   3,
+		ThreadCount:         400,
+		JVMMemoryPercent:    80,
+		FailedQueries:       4,
+	}
+}
+
+// RenderInputs are the objects a RenderConfig is resolved from. Inputs left
+// nil leave the fields derived from them empty, so callers only need to
+// fetch what the resources they render depend on.
+type RenderInputs struct {
+	// UserParams is the addon-managed-starburst-parameters secret.
+	UserParams *corev1.Secret
+	// Vault is the addon secret with the remote write endpoint.
+	Vault *corev1.Secret
+	// ClusterVersion provides the cluster ID.
+	ClusterVersion *configv1.ClusterVersion
+	// Certificate is the spec.expose.certificateSecret secret.
+	Certificate *corev1.Secret
+	// NoRoutes is set on clusters without the OpenShift Route API, where the
+	// coordinator is exposed through an Ingress by default.
+	NoRoutes bool
+}
+
+// ResolveConfig builds the RenderConfig for addon from its inputs.
+func ResolveConfig(addon *addonv1alpha1.StarburstAddon, in RenderInputs) RenderConfig {
+	cfg := RenderConfig{
+		Name:              Name,
+		Namespace:         Namespace,
+		Metrics:           addon.Spec.Metrics,
+		Thresholds:        resolveThresholds(addon.Spec.AlertThresholds),
+		RunbookBaseURL:    addon.Spec.RunbookBaseURL,
+		NetworkPolicy:     addon.Spec.NetworkPolicy,
+		OperatorNamespace: addon.Namespace,
+		InternalTLS:       addon.Spec.InternalTLS != nil,
+		Authentication:    addon.Spec.Authentication != nil,
+		ApplyImage:        defaultApplyImage,
+	}
+	if addon.Spec.Metrics {
+		cfg.Alerting = addon.Spec.Alerting
+	}
+	if images := addon.Spec.Images; images != nil {
+		if images.Apply != "" {
+			cfg.ApplyImage = images.Apply
+		}
+		cfg.PrometheusImage = images.Prometheus
+	}
+
+	if in.UserParams != nil {
+		cfg.License = string(in.UserParams.Data["starburst-license"])
+		cfg.Operand = in.UserParams.Data[operandManifestKey]
+	}
+	if in.Vault != nil {
+		cfg.RemoteWrite = append(cfg.RemoteWrite, addonv1alpha1.RemoteWriteTarget{
+			URL:               string(in.Vault.Data["remote-write-url"]),
+			TokenURL:          string(in.Vault.Data["token-url"]),
+			CredentialsSecret: in.Vault.Name,
+		})
+	}
+	cfg.RemoteWrite = append(cfg.RemoteWrite, addon.Spec.RemoteWrite...)
+	if in.ClusterVersion != nil {
+		cfg.ClusterID = fetchClusterID(in.ClusterVersion)
+	}
+	cfg.Asleep = addon.Status.Schedule != nil && addon.Status.Schedule.Asleep
+	if e := addon.Spec.Expose; e != nil {
+		cfg.Expose = &ExposeConfig{
+			Type:              e.Type,
+			Host:              e.Host,
+			IngressClassName:  e.IngressClassName,
+			CertificateSecret: e.CertificateSecret,
+			Reencrypt:         e.ServiceCA,
+		}
+		if cfg.Expose.Type == "" {
+			cfg.Expose.Type = "Route"
+			if in.NoRoutes {
+				cfg.Expose.Type = "Ingress"
+			}
+		}
+		if in.Certificate != nil {
+			cfg.Expose.Certificate = string(in.Certificate.Data[corev1.TLSCertKey])
+			cfg.Expose.Key = string(in.Certificate.Data[corev1.TLSPrivateKeyKey])
+			cfg.Expose.CACertificate = string(in.Certificate.Data["ca.crt"])
+		}
+	}
+
+	return cfg
+}
+
+// resolveThresholds applies the overrides from the spec to the defaults.
+func resolveThresholds(spec *addonv1alpha1.AlertThresholds) AlertThresholds {
+	t := DefaultAlertThresholds()
+	if spec == nil {
+		return t
+	}
+
+	setBytes := func(dst *int64, q *resource.Quantity) {
+		if q != nil {
+			*dst = q.Value()
+		}
+	}
+	setCount := func(dst *int32, v *int32) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+	setBytes(&t.QueryMemoryBytes, spec.QueryMemory)
+	setBytes(&t.HeapMemoryBytes, spec.HeapMemory)
+	setBytes(&t.MaxQueryMemoryBytes, spec.MaxQueryMemory)
+	setBytes(&t.MaxHeapMemoryBytes, spec.MaxHeapMemory)
+	setCount(&t.ActiveNodes, spec.ActiveNodes)
+	setCount(&t.ExpectedInstances, spec.ExpectedInstances)
+	setCount(&t.ThreadCount, spec.ThreadCount)
+	setCount(&t.JVMMemoryPercent, spec.JVMMemoryPercent)
+	setCount(&t.FailedQueries, spec.FailedQueries)
+	return t
+}
+
+func fetchClusterID(cv *configv1.ClusterVersion) string {
+	clusterID := cv.Spec.ClusterID
+	return string(clusterID)
+}
+
+// DeployAll renders every resource the operator creates for cfg, in the
+// order they are applied.
+func DeployAll(cfg RenderConfig) []client.Object {
+	objs := []client.Object{
+		DeployLicenseSecret(cfg),
+		DeployOperandSecret(cfg),
+	}
+	if cfg.Metrics {
+		objs = append(objs, DeployPrometheusRBAC(cfg)...)
+		objs = append(objs,
+			DeployPrometheus(cfg),
+			DeployServiceMonitor(cfg),
+			DeployFederationServiceMonitor(cfg),
+			DeployPrometheusServiceMonitor(cfg),
+			DeployPrometheusRules(cfg),
+		)
+		if cfg.Alerting != nil {
+			objs = append(objs, DeployAlertmanagerObjects(cfg)...)
+		}
+	}
+	objs = append(objs, DeployApplyRBAC(cfg)...)
+	objs = append(objs, DeployCronJob(cfg))
+	if cfg.NetworkPolicy != nil {
+		objs = append(objs, networkPolicyObjects(cfg)...)
+	}
+	if cfg.Expose != nil {
+		switch cfg.Expose.Type {
+		case "Ingress":
+			objs = append(objs, DeployIngress(cfg))
+		default:
+			objs = append(objs, DeployRoute(cfg))
+		}
+	}
+	if coordinatorHTTPS(cfg) {
+		objs = append(objs, DeployInternalService(cfg))
+	}
+	return objs
+}
+
+// MarshalYAML serializes objs into a multi-document YAML stream.
+func MarshalYAML(objs []client.Object) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, obj := range objs {
+		out, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal %s %s: %v", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+		}
+		buf.WriteString("---\n")
+		buf.Write(out)
+	}
+	return buf.Bytes(), nil
+}
+
+// remoteWriteSpecs renders the remote write section of the Prometheus.
+func remoteWriteSpecs(targets []addonv1alpha1.RemoteWriteTarget) []promv1.RemoteWriteSpec {
+	specs := make([]promv1.RemoteWriteSpec, 0, len(targets))
+	for _, t := range targets {
+		specs = append(specs, promv1.RemoteWriteSpec{
+			WriteRelabelConfigs: []promv1.RelabelConfig{
+				{
+					Action: "keep",
+					Regex:  "csv_succeeded$|csv_abnormal$|cluster_version$|ALERTS$|subscription_sync_total|trino_.*$|jvm_heap_memory_used$|node_.*$|namespace_.*$|kube_.*$|cluster.*$|container_.*$",
+				},
+			},
+			URL: t.URL,
+			TLSConfig: &promv1.TLSConfig{
+				SafeTLSConfig: promv1.SafeTLSConfig{
+					InsecureSkipVerify: true,
+				},
+			},
+			OAuth2: &promv1.OAuth2{
+				ClientID: promv1.SecretOrConfigMap{
+					Secret: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: t.CredentialsSecret,
+						},
+						Key: "client-id",
+					},
+				},
+				ClientSecret: corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: t.CredentialsSecret,
+					},
+					Key: "client-secret",
+				},
+				TokenURL: t.TokenURL,
+			},
+		})
+	}
+	return specs
+}
+
+// defaultApplyImage is the kubectl image of the CronJob.
+const defaultApplyImage = "cmwylie19/kube-argo-base"
+
+// restrictedPodSecurityContext and restrictedSecurityContext meet the
+// restricted pod security profile. No user is set, so that OpenShift assigns
+// one from the namespace range.
+func restrictedPodSecurityContext() *corev1.PodSecurityContext {
+	nonRoot := true
+	return &corev1.PodSecurityContext{
+		RunAsNonRoot:   &nonRoot,
+		SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}
+}
+
+func restrictedSecurityContext() *corev1.SecurityContext {
+	no, yes := false, true
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &no,
+		ReadOnlyRootFilesystem:   &yes,
+		RunAsNonRoot:             &yes,
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+}
+
+func DeployCronJob(cfg RenderConfig) *batchv1.CronJob {
+	defaultMode := int32(0755)
+	failLimit := int32(3)
+	var suspend *bool
+	if cfg.SuspendOperand {
+		suspend = &cfg.SuspendOperand
+	}
+	return &batchv1.CronJob{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: batchv1.SchemeGroupVersion.String(),
+			Kind:       "CronJob",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.Name,
+			Namespace: cfg.Namespace,
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:               "*/1 * * * *",
+			Suspend:                suspend,
+			FailedJobsHistoryLimit: &failLimit,
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							ServiceAccountName: applyServiceAccount(cfg),
+							SecurityContext:    restrictedPodSecurityContext(),
+							Volumes: []corev1.Volume{
+								{
+									Name: "operand",
+									VolumeSource: corev1.VolumeSource{
+										Secret: &corev1.SecretVolumeSource{
+											SecretName:  cfg.Name + "-operand",
+											DefaultMode: &defaultMode,
+										},
+									},
+								},
+								{
+									// kubectl caches discovery under $HOME, the root FS is read-only
+									Name: "home",
+									VolumeSource: corev1.VolumeSource{
+										EmptyDir: &corev1.EmptyDirVolumeSource{},
+									},
+								},
+							},
+
+							Containers: []corev1.Container{
+								{
+									Name:  "addon",
+									Image: cfg.ApplyImage,
+									Command: []string{
+										"sh",
+										"-c",
+										"kubectl apply --server-side --field-manager=" + operandFieldManager + " -f /opt/scripts/" + operandManifestKey,
+									},
+									Env: []corev1.EnvVar{
+										{Name: "HOME", Value: "/home/addon"},
+									},
+									VolumeMounts: []corev1.VolumeMount{
+										{
+											Name:      "operand",
+											MountPath: "/opt/scripts",
+											ReadOnly:  true,
+										},
+										{
+											Name:      "home",
+											MountPath: "/home/addon",
+										},
+									},
+									Resources: corev1.ResourceRequirements{
+										Requests: corev1.ResourceList{
+											corev1.ResourceCPU:    resource.MustParse("10m"),
+											corev1.ResourceMemory: resource.MustParse("64Mi"),
+										},
+										Limits: corev1.ResourceList{
+											corev1.ResourceCPU:    resource.MustParse("200m"),
+											corev1.ResourceMemory: resource.MustParse("256Mi"),
+										},
+									},
+									SecurityContext: restrictedSecurityContext(),
+								},
+							},
+							RestartPolicy: corev1.RestartPolicyNever,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func DeployServiceMonitor(cfg RenderConfig) *promv1.ServiceMonitor {
+	return &promv1.ServiceMonitor{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: promv1.SchemeGroupVersion.String(),
+			Kind:       "ServiceMonitor",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.Name,
+			Namespace: cfg.Namespace,
+		},
+		Spec: promv1.ServiceMonitorSpec{
+			NamespaceSelector: promv1.NamespaceSelector{
+				MatchNames: []string{cfg.Namespace},
+			},
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": "starburst-enterprise",
+				},
+			},
+			Endpoints: []promv1.Endpoint{
+				{
+					Port:     metricsPort,
+					Interval: "2s",
+				},
+			},
+		},
+	}
+}
+
+// DeployPrometheusServiceMonitor has the managed Prometheus scrape itself,
+// for the remote write and rule evaluation alerts.
+func DeployPrometheusServiceMonitor(cfg RenderConfig) *promv1.ServiceMonitor {
+	return &promv1.ServiceMonitor{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: promv1.SchemeGroupVersion.String(),
+			Kind:       "ServiceMonitor",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.Name + "-prometheus",
+			Namespace: cfg.Namespace,
+		},
+		Spec: promv1.ServiceMonitorSpec{
+			NamespaceSelector: promv1.NamespaceSelector{
+				MatchNames: []string{cfg.Namespace},
+			},
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"operated-prometheus": "true",
+				},
+			},
+			Endpoints: []promv1.Endpoint{
+				{
+					Port:     "web",
+					Interval: "30s",
+				},
+			},
+		},
+	}
+}
+
+func DeployPrometheusRules(cfg RenderConfig) *promv1.PrometheusRule {
+	rules := &promv1.PrometheusRule{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: promv1.SchemeGroupVersion.String(),
+			Kind:       "PrometheusRule",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.Name,
+			Namespace: cfg.Namespace,
+			Labels: map[string]string{
+				"app": "starburst",
+			},
+		},
+		Spec: promv1.PrometheusRuleSpec{
+			Groups: []promv1.RuleGroup{
+				{
+					Name:  operandAlertGroup,
+					Rules: alertRules(cfg, operandAlertGroup),
+				},
+				{
+					Name: "starburst_custom_rules",
+					Rules: []promv1.Rule{
+						{
+							Record: "starburst_query_mem",
+							Expr:   intstr.FromString("avg_over_time(jvm_memory_bytes_used{endpoint=\"metrics\"}[5m])"),
+						},
+						{
+							Record: "starburst_max_query_mem",
+							Expr:   intstr.FromString("jvm_memory_bytes_max{endpoint=\"metrics\", area=\"heap\"}"),
+						},
+						{
+							Record: "starburst_heap_mem",
+							Expr:   intstr.FromString("jvm_memory_bytes_used{endpoint=\"metrics\",area=\"heap\"}"),
+						},
+						{
+							Record: "starburst_max_heap_mem",
+							Expr:   intstr.FromString("jvm_memory_bytes_max{endpoint=\"metrics\",area=\"heap\"}"),
+						},
+					},
+				},
+				{
+					Name:  monitoringAlertGroup,
+					Rules: alertRules(cfg, monitoringAlertGroup),
+				},
+			},
+		},
+	}
+
+	// Nothing about the operand should page while the cluster is asleep on
+	// purpose, only the recording rules and the monitoring alerts are kept.
+	if cfg.Asleep {
+		var groups []promv1.RuleGroup
+		for _, g := range rules.Spec.Groups {
+			if g.Name != operandAlertGroup {
+				groups = append(groups, g)
+			}
+		}
+		rules.Spec.Groups = groups
+	}
+	return rules
+}
+
+func DeployPrometheus(cfg RenderConfig) *promv1.Prometheus {
+	prometheus := &promv1.Prometheus{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: promv1.SchemeGroupVersion.String(),
+			Kind:       "Prometheus",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.Name,
+			Namespace: cfg.Namespace,
+		},
+		Spec: promv1.PrometheusSpec{
+			RuleSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": "starburst",
+				},
+			},
+			CommonPrometheusFields: promv1.CommonPrometheusFields{
+				ExternalLabels: map[string]string{
+					"cluster_id": cfg.ClusterID,
+				},
+				LogLevel:    "debug",
+				RemoteWrite: remoteWriteSpecs(cfg.RemoteWrite),
+				ServiceMonitorNamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"kubernetes.io/metadata.name": cfg.Namespace,
+					},
+				},
+
+				ServiceMonitorSelector: &metav1.LabelSelector{},
+				PodMonitorSelector:     &metav1.LabelSelector{},
+				ServiceAccountName:     prometheusServiceAccount(cfg),
+				// The Prometheus operator hardens the containers itself.
+				SecurityContext: restrictedPodSecurityContext(),
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("400Mi"),
+					},
+					Limits: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("1"),
+						corev1.ResourceMemory: resource.MustParse("2Gi"),
+					},
+				},
+			},
+		},
+	}
+	if cfg.PrometheusImage != "" {
+		prometheus.Spec.Image = &cfg.PrometheusImage
+	}
+	if cfg.Alerting != nil {
+		prometheus.Spec.Alerting = &promv1.AlertingSpec{
+			Alertmanagers: []promv1.AlertmanagerEndpoints{
+				{
+					Namespace: cfg.Namespace,
+					Name:      "alertmanager-operated",
+					Port:      intstr.FromString("web"),
+				},
+			},
+		}
+	}
+	return prometheus
+}
+
+func alertmanagerServiceAccount(cfg RenderConfig) string { return cfg.Name + "-alertmanager" }
+
+const (
+	// heartbeatReceiver is reserved for the Watchdog alert.
+	heartbeatReceiver        = "heartbeat"
+	defaultHeartbeatInterval = "5m"
+)
+
+// alertmanagerConfigLabels select the AlertmanagerConfig of the operator, so
+// that others in the namespace are not merged into the managed Alertmanager.
+var alertmanagerConfigLabels = map[string]string{"app": "starburst"}
+
+// DeployAlertmanagerObjects renders the managed Alertmanager, its
+// ServiceAccount, which needs no permissions, and its configuration.
+func DeployAlertmanagerObjects(cfg RenderConfig) []client.Object {
+	return []client.Object{
+		serviceAccount(cfg, alertmanagerServiceAccount(cfg)),
+		DeployAlertmanager(cfg),
+		DeployAlertmanagerConfig(cfg),
+	}
+}
+
+func DeployAlertmanager(cfg RenderConfig) *promv1.Alertmanager {
+	replicas := int32(1)
+	return &promv1.Alertmanager{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: promv1.SchemeGroupVersion.String(),
+			Kind:       "Alertmanager",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.Name,
+			Namespace: cfg.Namespace,
+		},
+		Spec: promv1.AlertmanagerSpec{
+			Replicas:                   &replicas,
+			ServiceAccountName:         alertmanagerServiceAccount(cfg),
+			SecurityContext:            restrictedPodSecurityContext(),
+			AlertmanagerConfigSelector: &metav1.LabelSelector{MatchLabels: alertmanagerConfigLabels},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("10m"),
+					corev1.ResourceMemory: resource.MustParse("64Mi"),
+				},
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("200m"),
+					corev1.ResourceMemory: resource.MustParse("256Mi"),
+				},
+			},
+		},
+	}
+}
+
+// DeployAlertmanagerConfig translates spec.alerting. The Secrets holding the
+// credentials are referenced, never read by the operator.
+func DeployAlertmanagerConfig(cfg RenderConfig) *promv1alpha1.AlertmanagerConfig {
+	spec := cfg.Alerting
+	if spec == nil {
+		spec = &addonv1alpha1.Alerting{}
+	}
+	sendResolved := true
+
+	var receivers []promv1alpha1.Receiver
+	for _, r := range spec.Receivers {
+		receiver := promv1alpha1.Receiver{Name: r.Name}
+		if r.PagerDuty != nil {
+			key := r.PagerDuty.RoutingKey
+			receiver.PagerDutyConfigs = []promv1alpha1.PagerDutyConfig{{SendResolved: &sendResolved, RoutingKey: &key}}
+		}
+		if r.Slack != nil {
+			url := r.Slack.WebhookURL
+			receiver.SlackConfigs = []promv1alpha1.SlackConfig{{SendResolved: &sendResolved, APIURL: &url, Channel: r.Slack.Channel}}
+		}
+		if r.Email != nil {
+			receiver.EmailConfigs = []promv1alpha1.EmailConfig{{
+				SendResolved: &sendResolved,
+				To:           r.Email.To,
+				From:         r.Email.From,
+				Smarthost:    r.Email.Smarthost,
+				AuthUsername: r.Email.AuthUsername,
+				AuthPassword: r.Email.AuthPassword,
+			}}
+		}
+		receivers = append(receivers, receiver)
+	}
+
+	// The Watchdog alert always goes to the heartbeat receiver, which drops
+	// it when no heartbeat is configured.
+	heartbeat := promv1alpha1.Receiver{Name: heartbeatReceiver}
+	interval := defaultHeartbeatInterval
+	if spec.Heartbeat != nil {
+		url := spec.Heartbeat.URL
+		heartbeat.WebhookConfigs = []promv1alpha1.WebhookConfig{{URLSecret: &url}}
+		if spec.Heartbeat.Interval != "" {
+			interval = spec.Heartbeat.Interval
+		}
+	}
+	receivers = append(receivers, heartbeat)
+
+	route := &promv1alpha1.Route{
+		Receiver:       spec.DefaultReceiver,
+		GroupBy:        spec.GroupBy,
+		RepeatInterval: spec.RepeatInterval,
+	}
+	if route.Receiver == "" && len(spec.Receivers) > 0 {
+		route.Receiver = spec.Receivers[0].Name
+	}
+	if len(route.GroupBy) == 0 {
+		route.GroupBy = []string{"alertname"}
+	}
+	watchdog, _ := json.Marshal(promv1alpha1.Route{
+		Receiver:       heartbeatReceiver,
+		Matchers:       []promv1alpha1.Matcher{{Name: "alertname", Value: "Watchdog", MatchType: promv1alpha1.MatchEqual}},
+		GroupWait:      "0s",
+		GroupInterval:  interval,
+		RepeatInterval: interval,
+	})
+	route.Routes = append(route.Routes, apiextensionsv1.JSON{Raw: watchdog})
+	for _, r := range spec.Routes {
+		child := promv1alpha1.Route{Receiver: r.Receiver, Continue: r.Continue}
+		for _, m := range r.Matchers {
+			matchType := promv1alpha1.MatchEqual
+			if m.Regex {
+				matchType = promv1alpha1.MatchRegexp
+			}
+			child.Matchers = append(child.Matchers, promv1alpha1.Matcher{Name: m.Name, Value: m.Value, MatchType: matchType})
+		}
+		raw, _ := json.Marshal(child)
+		route.Routes = append(route.Routes, apiextensionsv1.JSON{Raw: raw})
+	}
+
+	return &promv1alpha1.AlertmanagerConfig{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: promv1alpha1.SchemeGroupVersion.String(),
+			Kind:       "AlertmanagerConfig",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.Name,
+			Namespace: cfg.Namespace,
+			Labels:    alertmanagerConfigLabels,
+		},
+		Spec: promv1alpha1.AlertmanagerConfigSpec{
+			Route:     route,
+			Receivers: receivers,
+		},
+	}
+}
+
+// returns the license secret
+func DeployLicenseSecret(cfg RenderConfig) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "starburst-license",
+			Namespace: cfg.Namespace,
+		},
+		Data: map[string][]byte{
+			"starburstdata.license": []byte(cfg.License),
+		},
+	}
+}
+
+// operandManifestKey is the key of the StarburstEnterprise manifest in the
+// parameters secret and in the operand secret.
+const operandManifestKey = "starburstenterprise.yaml"
+
+// operandFieldManager is the field manager of the CronJob. It applies without
+// forcing, so a field the operator owns fails the apply instead of flipping
+// between the two values.
+const operandFieldManager = FieldManager + "-cronjob"
+
+// DeployOperandSecret holds the resolved StarburstEnterprise manifest mounted
+// into the CronJob, so that secret values never live in the parameters secret.
+func DeployOperandSecret(cfg RenderConfig) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.Name + "-operand",
+			Namespace: cfg.Namespace,
+		},
+		Data: map[string][]byte{
+			operandManifestKey: cfg.Operand,
+		},
+	}
+}
+
+func DeployFederationServiceMonitor(cfg RenderConfig) *promv1.ServiceMonitor {
+	metrics := make(map[string][]string)
+	str1 := fmt.Sprintf("container_memory_working_set_bytes{namespace=\"%s\"}", cfg.Namespace)
+	str2 := fmt.Sprintf("node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace=\"%s\"}", cfg.Namespace)
+	str3 := fmt.Sprintf("namespace_workload_pod:kube_pod_owner:relabel{namespace=\"%s\"}", cfg.Namespace)
+	str4 := fmt.Sprintf("kube_pod_container_info{namespace=\"%s\"}", cfg.Namespace)
+	str5 := fmt.Sprintf("kube_pod_status_ready{namespace=\"%s\"}", cfg.Namespace)
+	str6 := fmt.Sprintf("kube_pod_container_status_last_terminated_reason{namespace=\"%s\"}", cfg.Namespace)
+	str7 := fmt.Sprintf("kube_pod_container_status_waiting{namespace=\"%s\"}", cfg.Namespace)
+	str8 := fmt.Sprintf("kube_namespace_status_phase{namespace=\"%s\"}", cfg.Namespace)
+	str9 := fmt.Sprintf("node_namespace_pod:kube_pod_info:{namespace=\"%s\"}", cfg.Namespace)
+	str10 := fmt.Sprintf("kube_service_info{namespace=\"%s\"}", cfg.Namespace)
+	str11 := fmt.Sprintf("cluster:namespace:pod_memory:active:kube_pod_container_resource_limits{namespace=\"%s\"}", cfg.Namespace)
+	str12 := fmt.Sprintf("container_cpu_cfs_throttled_seconds_total{namespace=\"%s\"}", cfg.Namespace)
+	str13 := fmt.Sprintf("container_fs_usage_bytes{namespace=\"%s\"}", cfg.Namespace)
+	str14 := fmt.Sprintf("container_network_receive_bytes_total{namespace=\"%s\"}", cfg.Namespace)
+	str15 := fmt.Sprintf("container_network_transmit_bytes_total{namespace=\"%s\"}", cfg.Namespace)
+	str16 := fmt.Sprintf("kube_deployment_status_replicas_available{namespace=\"%s\"}", cfg.Namespace)
+	str17 := "kube_node_status_capacity"
+	str18 := fmt.Sprintf("container_memory_usage_bytes{namespace=\"%s\"}", cfg.Namespace)
+	str19 := fmt.Sprintf("kube_pod_container_resource_requests{namespace=\"%s\"}", cfg.Namespace)
+	str20 := fmt.Sprintf("kube_deployment_status_replicas_unavailable{namespace=\"%s\"}", cfg.Namespace)
+	str21 := fmt.Sprintf("kube_persistentvolumeclaim_status_phase{namespace=\"%s\"}", cfg.Namespace)
+	str22 := fmt.Sprintf("container_memory_working_set_bytes{namespace=\"%s\"}", cfg.Namespace)
+	str23 := fmt.Sprintf("kube_pod_container_resource_limits{namespace=\"%s\"}", cfg.Namespace)
+	str24 := fmt.Sprintf("cluster:namespace:pod_cpu:active:kube_pod_container_resource_limits{namespace=\"%s\"}", cfg.Namespace)
+	str25 := fmt.Sprintf("container_network_receive_packets_total{namespace=\"%s\"}", cfg.Namespace)
+	str26 := fmt.Sprintf("container_network_transmit_packets_total{namespace=\"%s\"}", cfg.Namespace)
+	str27 := fmt.Sprintf("kube_running_pod_ready{namespace=\"%s\"}", cfg.Namespace)
+	str28 := fmt.Sprintf("node_namespace_pod:kube_pod_info:{namespace=\"%s\"}", cfg.Namespace)
+	str29 := fmt.Sprintf("container_cpu_usage_seconds_total{namespace=\"%s\"}", cfg.Namespace)
+	str30 := fmt.Sprintf("kube_pod_container_status_restarts_total{namespace=\"%s\"}", cfg.Namespace)
+	str31 := fmt.Sprintf("kube_pod_status_phase{namespace=\"%s\"}", cfg.Namespace)
+	str32 := fmt.Sprintf("cluster:namespace:pod_memory:active:kube_pod_container_resource_requests{namespace=\"%s\"}", cfg.Namespace)
+
+	metrics["match[]"] = append(metrics["match[]"], str1, str2, str3, str4, str5, str6, str7, str8, str9, str10, str11, str12, str13, str14, str15, str16, str17, str18, str19, str20, str21, str22, str23, str24, str25, str26, str27, str28, str29, str30, str31, str32)
+
+	return &promv1.ServiceMonitor{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: promv1.SchemeGroupVersion.String(),
+			Kind:       "ServiceMonitor",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.Name + "-federation",
+			Namespace: cfg.Namespace,
+		},
+		Spec: promv1.ServiceMonitorSpec{
+			JobLabel: "openshift-monitoring-federation",
+			NamespaceSelector: promv1.NamespaceSelector{
+				MatchNames: []string{
+					"openshift-monitoring",
+				},
+			},
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app.kubernetes.io/instance": "k8s",
+				},
+			},
+			Endpoints: []promv1.Endpoint{
+				{
+					BearerTokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+					Port:            "web",
+					Path:            "/federate",
+					Interval:        "30s",
+					Scheme:          "https",
+					Params:          metrics,
+					TLSConfig: &promv1.TLSConfig{
+						SafeTLSConfig: promv1.SafeTLSConfig{
+							InsecureSkipVerify: true,
+							ServerName:         "prometheus-k8s.openshift-monitoring.svc.cluster.local",
+						},
+						CAFile: "/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt",
+					},
+				},
+			},
+		},
+	}
+}
+
+// DeployRoute exposes the coordinator through an edge terminated Route, or
+// one re-encrypting to the HTTPS port of the coordinator with
+// spec.expose.serviceCA. Plain HTTP requests are redirected to HTTPS.
+func DeployRoute(cfg RenderConfig) *routev1.Route {
+	weight := int32(100)
+	service, port, termination := coordinatorService, coordinatorPort, routev1.TLSTerminationEdge
+	if cfg.Expose.Reencrypt {
+		service, port, termination = internalServiceName(cfg), internalTLSPort, routev1.TLSTerminationReencrypt
+	}
+	return &routev1.Route{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: routev1.GroupVersion.String(),
+			Kind:       "Route",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.Name,
+			Namespace: cfg.Namespace,
+		},
+		Spec: routev1.RouteSpec{
+			Host: cfg.Expose.Host,
+			To: routev1.RouteTargetReference{
+				Kind:   "Service",
+				Name:   service,
+				Weight: &weight,
+			},
+			Port: &routev1.RoutePort{
+				TargetPort: intstr.FromInt(port),
+			},
+			TLS: &routev1.TLSConfig{
+				Termination:                   termination,
+				InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
+				Certificate:                   cfg.Expose.Certificate,
+				Key:                           cfg.Expose.Key,
+				CACertificate:                 cfg.Expose.CACertificate,
+				DestinationCACertificate:      cfg.Expose.DestinationCACertificate,
+			},
+		},
+	}
+}
+
+// DeployIngress exposes the coordinator through an Ingress serving the
+// certificate of spec.expose.certificateSecret.
+func DeployIngress(cfg RenderConfig) *networkingv1.Ingress {
+	pathType := networkingv1.PathTypePrefix
+	return &networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networkingv1.SchemeGroupVersion.String(),
+			Kind:       "Ingress",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.Name,
+			Namespace: cfg.Namespace,
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: cfg.Expose.IngressClassName,
+			TLS: []networkingv1.IngressTLS{
+				{
+					Hosts:      []string{cfg.Expose.Host},
+					SecretName: cfg.Expose.CertificateSecret,
+				},
+			},
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: cfg.Expose.Host,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     "/",
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: coordinatorService,
+											Port: networkingv1.ServiceBackendPort{Number: coordinatorPort},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// DeployInternalService exposes the HTTPS port of the coordinator, which
+// the Service of the chart does not, for the workers to discover it through
+// and for a re-encrypting Route. Without internal TLS, the service CA issues
+// the certificate the coordinator serves on it.
+func DeployInternalService(cfg RenderConfig) *corev1.Service {
+	var annotations map[string]string
+	if !cfg.InternalTLS {
+		annotations = map[string]string{servingCertAnnotation: servingCertSecret(cfg)}
+	}
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        internalServiceName(cfg),
+			Namespace:   cfg.Namespace,
+			Annotations: annotations,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: coordinatorPodLabels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "https",
+					Port:       internalTLSPort,
+					TargetPort: intstr.FromInt(internalTLSPort),
+				},
+			},
+		},
+	}
+}
+
+// monitoringNamespace runs the cluster Prometheus the federation
+// ServiceMonitor scrapes.
+const monitoringNamespace = "openshift-monitoring"
+
+func prometheusServiceAccount(cfg RenderConfig) string { return cfg.Name + "-prometheus" }
+
+func applyServiceAccount(cfg RenderConfig) string { return cfg.Name + "-apply" }
+
+// DeployPrometheusRBAC is the identity of the managed Prometheus. It may
+// discover the targets of the ServiceMonitors in the operand namespace and
+// in openshift-monitoring, and query the federation endpoint of the cluster
+// Prometheus, which checks for cluster-monitoring-view.
+func DeployPrometheusRBAC(cfg RenderConfig) []client.Object {
+	name := prometheusServiceAccount(cfg)
+	// Named after the operand namespace outside of it, to stay unique.
+	external := cfg.Namespace + "-" + name
+	discovery := []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"services", "endpoints", "pods"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+	}
+	return []client.Object{
+		serviceAccount(cfg, name),
+		role(cfg.Namespace, name, append(discovery, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"get"},
+		})),
+		roleBinding(cfg, cfg.Namespace, name, name),
+		role(monitoringNamespace, external, discovery),
+		roleBinding(cfg, monitoringNamespace, external, name),
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: rbacv1.SchemeGroupVersion.String(),
+				Kind:       "ClusterRoleBinding",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: external,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     "cluster-monitoring-view",
+			},
+			Subjects: []rbacv1.Subject{
+				{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: cfg.Namespace},
+			},
+		},
+	}
+}
+
+// DeployApplyRBAC is the identity of the CronJob, which only applies the
+// StarburstEnterprise and the OperandResources.
+func DeployApplyRBAC(cfg RenderConfig) []client.Object {
+	name := applyServiceAccount(cfg)
+	rules := []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{StarburstEnterpriseGVK.Group},
+			Resources: []string{"starburstenterprises"},
+			Verbs:     []string{"get", "create", "patch"},
+		},
+	}
+	groups := map[string][]string{}
+	for _, gr := range cfg.OperandResources {
+		if !containsString(groups[gr.Group], gr.Resource) {
+			groups[gr.Group] = append(groups[gr.Group], gr.Resource)
+		}
+	}
+	var names []string
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+	for _, group := range names {
+		resources := groups[group]
+		sort.Strings(resources)
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{group},
+			Resources: resources,
+			Verbs:     []string{"get", "create", "patch"},
+		})
+	}
+	return []client.Object{
+		serviceAccount(cfg, name),
+		role(cfg.Namespace, name, rules),
+		roleBinding(cfg, cfg.Namespace, name, name),
+	}
+}
+
+func serviceAccount(cfg RenderConfig, name string) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "ServiceAccount",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cfg.Namespace,
+		},
+	}
+}
+
+func role(namespace, name string, rules []rbacv1.PolicyRule) *rbacv1.Role {
+	return &rbacv1.Role{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+			Kind:       "Role",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Rules: rules,
+	}
+}
+
+// roleBinding binds the Role name of namespace to a ServiceAccount of the
+// operand namespace.
+func roleBinding(cfg RenderConfig, namespace, name, serviceAccount string) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+			Kind:       "RoleBinding",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     name,
+		},
+		Subjects: []rbacv1.Subject{
+			{Kind: rbacv1.ServiceAccountKind, Name: serviceAccount, Namespace: cfg.Namespace},
+		},
+	}
+}
+
+// Labels of the pods the StarburstEnterprise chart and the Prometheus
+// operator create.
+var (
+	starburstPodLabels   = map[string]string{"app": "starburst-enterprise"}
+	coordinatorPodLabels = map[string]string{"app": "starburst-enterprise", "role": "coordinator"}
+)
+
+// DeployNetworkPolicies denies all ingress into the operand namespace and
+// then allows, per policy, the traffic the cluster needs.
+// ingressNamespaceSelector selects the namespaces of the ingress controller
+// in front of the coordinator, nil when it is not exposed or, for an Ingress,
+// when spec.networkPolicy does not say where its controller runs.
+func ingressNamespaceSelector(cfg RenderConfig) *metav1.LabelSelector {
+	switch {
+	case cfg.Expose == nil:
+		return nil
+	case cfg.NetworkPolicy.IngressNamespaceSelector != nil:
+		return cfg.NetworkPolicy.IngressNamespaceSelector
+	case cfg.Expose.Type == "Route":
+		return &metav1.LabelSelector{
+			MatchLabels: map[string]string{"network.openshift.io/policy-group": "ingress"},
+		}
+	}
+	return nil
+}
+
+func DeployNetworkPolicies(cfg RenderConfig) []*networkingv1.NetworkPolicy {
+	namespaces := func(names ...string) []networkingv1.NetworkPolicyPeer {
+		peers := make([]networkingv1.NetworkPolicyPeer, 0, len(names))
+		for _, name := range names {
+			peers = append(peers, networkingv1.NetworkPolicyPeer{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"kubernetes.io/metadata.name": name},
+				},
+			})
+		}
+		return peers
+	}
+	prometheusPods := map[string]string{"prometheus": cfg.Name}
+	metrics := intstr.FromString(metricsPort)
+	operator := networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"kubernetes.io/metadata.name": cfg.OperatorNamespace},
+		},
+		PodSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"control-plane": "controller-manager"},
+		},
+	}
+
+	// Clients of the coordinator: the operator, the allowlists and, when the
+	// coordinator is exposed, the ingress controller.
+	clients := append([]networkingv1.NetworkPolicyPeer{operator}, namespaces(cfg.NetworkPolicy.AllowedNamespaces...)...)
+	for _, cidr := range cfg.NetworkPolicy.AllowedCIDRs {
+		clients = append(clients, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+	var ingress []networkingv1.NetworkPolicyPeer
+	if selector := ingressNamespaceSelector(cfg); selector != nil {
+		ingress = append(ingress, networkingv1.NetworkPolicyPeer{NamespaceSelector: selector})
+	}
+	clients = append(clients, ingress...)
+
+	// With authentication the coordinator trusts the X-Forwarded headers of
+	// its plain HTTP port, so only the ingress controller and the operator,
+	// which signs its calls, may reach it. The allowlists keep HTTPS.
+	plain := clients
+	if cfg.Authentication {
+		plain = append([]networkingv1.NetworkPolicyPeer{operator}, ingress...)
+	}
+	port := intstr.FromInt(coordinatorPort)
+	https := intstr.FromInt(internalTLSPort)
+	coordinator := []networkingv1.NetworkPolicyIngressRule{{
+		From:  plain,
+		Ports: []networkingv1.NetworkPolicyPort{{Port: &port}},
+	}}
+	if coordinatorHTTPS(cfg) {
+		coordinator = append(coordinator, networkingv1.NetworkPolicyIngressRule{
+			From:  clients,
+			Ports: []networkingv1.NetworkPolicyPort{{Port: &https}},
+		})
+	}
+
+	scrapers := append([]networkingv1.NetworkPolicyPeer{{
+		PodSelector: &metav1.LabelSelector{MatchLabels: prometheusPods},
+	}}, namespaces(append([]string{"openshift-monitoring"}, cfg.NetworkPolicy.MonitoringNamespaces...)...)...)
+
+	policy := func(name string, pods map[string]string, rules ...networkingv1.NetworkPolicyIngressRule) *networkingv1.NetworkPolicy {
+		return &networkingv1.NetworkPolicy{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: networkingv1.SchemeGroupVersion.String(),
+				Kind:       "NetworkPolicy",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      cfg.Name + "-" + name,
+				Namespace: cfg.Namespace,
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: pods},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				Ingress:     rules,
+			},
+		}
+	}
+
+	return []*networkingv1.NetworkPolicy{
+		policy("default-deny", nil),
+		// Coordinator, workers and the exchanges between workers.
+		policy("internal", starburstPodLabels, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{
+				{PodSelector: &metav1.LabelSelector{MatchLabels: starburstPodLabels}},
+			},
+		}),
+		policy("coordinator", coordinatorPodLabels, coordinator...),
+		policy("monitoring", starburstPodLabels, networkingv1.NetworkPolicyIngressRule{
+			From:  scrapers,
+			Ports: []networkingv1.NetworkPolicyPort{{Port: &metrics}},
+		}),
+		// The operator queries the managed Prometheus for autoscaling, and
+		// the Prometheus scrapes itself.
+		policy("prometheus", prometheusPods, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{
+				operator,
+				{PodSelector: &metav1.LabelSelector{MatchLabels: prometheusPods}},
+			},
+		}),
+		// The managed Prometheus sends its alerts to the managed Alertmanager.
+		// The policy selects nothing while spec.alerting is unset.
+		policy("alertmanager", map[string]string{"alertmanager": cfg.Name}, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: prometheusPods}}},
+		}),
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testRenderInputs are the secrets and cluster version the golden files are
+// rendered from.
+func testRenderInputs() RenderInputs {
+	return RenderInputs{
+		UserParams: &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "addon-managed-starburst-parameters", Namespace: Namespace},
+			Data: map[string][]byte{
+				"starburst-license":        []byte("test-license"),
+				"starburstenterprise.yaml": []byte("kind: StarburstEnterprise\nspec:\n  catalogs:\n    sales: connection-password=${secret:sales-db/password}\n"),
+			},
+		},
+		Vault: &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "addon", Namespace: Namespace},
+			Data: map[string][]byte{
+				"token-url":        []byte("https://sso.example.com/token"),
+				"remote-write-url": []byte("https://observatorium.example.com/api/metrics/v1/receive"),
+			},
+		},
+		ClusterVersion: &configv1.ClusterVersion{
+			Spec: configv1.ClusterVersionSpec{ClusterID: "00000000-0000-0000-0000-000000000000"},
+		},
+	}
+}
+
+func testAddon(spec addonv1alpha1.StarburstAddonSpec) *addonv1alpha1.StarburstAddon {
+	return &addonv1alpha1.StarburstAddon{
+		ObjectMeta: metav1.ObjectMeta{Name: "starburst", Namespace: Namespace},
+		Spec:       spec,
+	}
+}
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func quantityPtr(s string) *resource.Quantity {
+	q := resource.MustParse(s)
+	return &q
+}
+
+// TestDeployAllGolden compares the rendered resources with testdata/<case>.yaml.
+// Run with -update to accept changes to the generated manifests.
+func TestDeployAllGolden(t *testing.T) {
+	cases := map[string]*addonv1alpha1.StarburstAddon{
+		"default": testAddon(addonv1alpha1.StarburstAddonSpec{
+			Metrics: true,
+		}),
+		"metrics-disabled": testAddon(addonv1alpha1.StarburstAddonSpec{
+			Metrics: false,
+		}),
+		"custom-thresholds": testAddon(addonv1alpha1.StarburstAddonSpec{
+			Metrics: true,
+			AlertThresholds: &addonv1alpha1.AlertThresholds{
+				QueryMemory:       quantityPtr("32Gi"),
+				MaxHeapMemory:     quantityPtr("128Gi"),
+				ActiveNodes:       int32Ptr(2),
+				ExpectedInstances: int32Ptr(5),
+				JVMMemoryPercent:  int32Ptr(90),
+				FailedQueries:     int32Ptr(10),
+			},
+		}),
+		"multi-remote-write": testAddon(addonv1alpha1.StarburstAddonSpec{
+			Metrics: true,
+			RemoteWrite: []addonv1alpha1.RemoteWriteTarget{
+				{
+					URL:               "https://metrics.example.org/api/v1/write",
+					TokenURL:          "https://auth.example.org/oauth/token",
+					CredentialsSecret: "secondary-remote-write",
+				},
+			},
+		}),
+	}
+
+	ingressClass := "nginx"
+	cases["expose-ingress"] = testAddon(addonv1alpha1.StarburstAddonSpec{
+		Metrics: false,
+		Expose: &addonv1alpha1.Expose{
+			Type:              "Ingress",
+			Host:              "starburst.example.com",
+			IngressClassName:  &ingressClass,
+			CertificateSecret: "starburst-tls",
+		},
+	})
+
+	cases["network-policy"] = testAddon(addonv1alpha1.StarburstAddonSpec{
+		Metrics: true,
+		NetworkPolicy: &addonv1alpha1.NetworkPolicy{
+			AllowedNamespaces:    []string{"analytics"},
+			AllowedCIDRs:         []string{"10.0.0.0/8"},
+			MonitoringNamespaces: []string{"user-monitoring"},
+			IngressNamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"kubernetes.io/metadata.name": "ingress-nginx"},
+			},
+		},
+		Expose: &addonv1alpha1.Expose{Type: "Ingress", Host: "starburst.example.com", CertificateSecret: "starburst-tls"},
+	})
+
+	cases["expose-service-ca"] = testAddon(addonv1alpha1.StarburstAddonSpec{
+		Metrics:       false,
+		Expose:        &addonv1alpha1.Expose{ServiceCA: true},
+		NetworkPolicy: &addonv1alpha1.NetworkPolicy{},
+	})
+
+	cases["authentication"] = testAddon(addonv1alpha1.StarburstAddonSpec{
+		Metrics: false,
+		Expose:  &addonv1alpha1.Expose{ServiceCA: true},
+		NetworkPolicy: &addonv1alpha1.NetworkPolicy{
+			AllowedNamespaces: []string{"analytics"},
+		},
+		Authentication: &addonv1alpha1.Authentication{
+			Type:         "PasswordFile",
+			PasswordFile: &addonv1alpha1.PasswordFileAuthentication{SecretName: "users"},
+		},
+	})
+
+	cases["internal-tls"] = testAddon(addonv1alpha1.StarburstAddonSpec{
+		Metrics:     false,
+		InternalTLS: &addonv1alpha1.InternalTLS{},
+	})
+
+	secretKey := func(name, key string) corev1.SecretKeySelector {
+		return corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+	}
+	cases["alerting"] = testAddon(addonv1alpha1.StarburstAddonSpec{
+		Metrics: true,
+		Alerting: &addonv1alpha1.Alerting{
+			Receivers: []addonv1alpha1.AlertReceiver{
+				{Name: "oncall", PagerDuty: &addonv1alpha1.PagerDutyReceiver{RoutingKey: secretKey("pagerduty", "routing-key")}},
+				{Name: "team", Slack: &addonv1alpha1.SlackReceiver{WebhookURL: secretKey("slack", "url"), Channel: "#starburst"}},
+			},
+			DefaultReceiver: "team",
+			Heartbeat:       &addonv1alpha1.Heartbeat{URL: secretKey("snitch", "url"), Interval: "5m"},
+			Routes: []addonv1alpha1.AlertRoute{
+				{Receiver: "oncall", Matchers: []addonv1alpha1.AlertMatcher{{Name: "severity", Value: "critical"}}},
+			},
+		},
+	})
+
+	asleep := testAddon(addonv1alpha1.StarburstAddonSpec{Metrics: true})
+	asleep.Status.Schedule = &addonv1alpha1.ScheduleStatus{Asleep: true}
+	cases["asleep"] = asleep
+
+	for name, addon := range cases {
+		addon := addon
+		t.Run(name, func(t *testing.T) {
+			got, err := MarshalYAML(DeployAll(ResolveConfig(addon, testRenderInputs())))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", name+".yaml")
+			if *update {
+				if err := os.WriteFile(path, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("could not read golden file, run with -update to create it: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("rendered manifests differ from %s, run with -update and review the diff", path)
+			}
+		})
+	}
+}
+
+func TestNetworkPolicyNeedsIngressNamespace(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	addon := testAddon(addonv1alpha1.StarburstAddonSpec{
+		NetworkPolicy: &addonv1alpha1.NetworkPolicy{},
+		Expose:        &addonv1alpha1.Expose{Type: "Ingress", Host: "starburst.example.com", CertificateSecret: "starburst-tls"},
+	})
+
+	if _, err := (&networkPolicyComponent{r: &StarburstAddonReconciler{Client: c}}).Reconcile(context.Background(), addon); err == nil {
+		t.Error("the policies of an Ingress were applied without its ingress controller namespace")
+	}
+
+	addon.Spec.Expose = &addonv1alpha1.Expose{Type: "Route"}
+	cfg := ResolveConfig(addon, RenderInputs{})
+	want := map[string]string{"network.openshift.io/policy-group": "ingress"}
+	if selector := ingressNamespaceSelector(cfg); selector == nil || !reflect.DeepEqual(selector.MatchLabels, want) {
+		t.Errorf("got ingress namespace selector %v for a Route, want the OpenShift router", selector)
+	}
+}
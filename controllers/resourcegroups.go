@@ -0,0 +1,237 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// starburstEtc is where the chart mounts coordinator.etcFiles.
+const starburstEtc = "/etc/starburst"
+
+// resourceGroupJSON is a group in resource-groups.json.
+type resourceGroupJSON struct {
+	Name                 string               `json:"name"`
+	SoftMemoryLimit      string               `json:"softMemoryLimit"`
+	HardConcurrencyLimit int32                `json:"hardConcurrencyLimit"`
+	SoftConcurrencyLimit *int32               `json:"softConcurrencyLimit,omitempty"`
+	MaxQueued            int32                `json:"maxQueued"`
+	SchedulingPolicy     string               `json:"schedulingPolicy,omitempty"`
+	SchedulingWeight     *int32               `json:"schedulingWeight,omitempty"`
+	SubGroups            []*resourceGroupJSON `json:"subGroups,omitempty"`
+}
+
+// renderResourceGroups validates spec and renders resource-groups.json and,
+// when spec has session property rules, session-property-config.json.
+func renderResourceGroups(spec addonv1alpha1.ResourceGroups) (string, string, error) {
+	paths, err := resourceGroupPaths(spec.Groups)
+	if err != nil {
+		return "", "", err
+	}
+
+	nodes := map[string]*resourceGroupJSON{}
+	var roots []*resourceGroupJSON
+	for i, g := range spec.Groups {
+		if g.SoftConcurrencyLimit != nil && *g.SoftConcurrencyLimit > g.HardConcurrencyLimit {
+			return "", "", fmt.Errorf("resource group %s has a softConcurrencyLimit above its hardConcurrencyLimit", paths[i])
+		}
+		nodes[paths[i]] = &resourceGroupJSON{
+			Name:                 g.Name,
+			SoftMemoryLimit:      g.SoftMemoryLimit,
+			HardConcurrencyLimit: g.HardConcurrencyLimit,
+			SoftConcurrencyLimit: g.SoftConcurrencyLimit,
+			MaxQueued:            g.MaxQueued,
+			SchedulingPolicy:     g.SchedulingPolicy,
+			SchedulingWeight:     g.SchedulingWeight,
+		}
+	}
+	for i, g := range spec.Groups {
+		if g.Parent == "" {
+			roots = append(roots, nodes[paths[i]])
+			continue
+		}
+		parent := nodes[g.Parent]
+		parent.SubGroups = append(parent.SubGroups, nodes[paths[i]])
+	}
+
+	for i, s := range spec.Selectors {
+		node, ok := nodes[s.Group]
+		if !ok {
+			return "", "", fmt.Errorf("selector %d selects unknown resource group %s", i, s.Group)
+		}
+		if len(node.SubGroups) > 0 {
+			return "", "", fmt.Errorf("selector %d selects %s, which is not a leaf group", i, s.Group)
+		}
+		if err := compilePatterns(fmt.Sprintf("selector %d", i), s.User, s.UserGroup, s.Source); err != nil {
+			return "", "", err
+		}
+	}
+	for i, rule := range spec.SessionProperties {
+		if err := compilePatterns(fmt.Sprintf("session property rule %d", i), rule.Group, rule.User, rule.Source); err != nil {
+			return "", "", err
+		}
+	}
+
+	groups, err := json.MarshalIndent(struct {
+		RootGroups []*resourceGroupJSON                  `json:"rootGroups"`
+		Selectors  []addonv1alpha1.ResourceGroupSelector `json:"selectors"`
+	}{roots, spec.Selectors}, "", "  ")
+	if err != nil {
+		return "", "", fmt.Errorf("could not render resource groups: %v", err)
+	}
+	if len(spec.SessionProperties) == 0 {
+		return string(groups), "", nil
+	}
+	sessionProperties, err := json.MarshalIndent(spec.SessionProperties, "", "  ")
+	if err != nil {
+		return "", "", fmt.Errorf("could not render session properties: %v", err)
+	}
+	return string(groups), string(sessionProperties), nil
+}
+
+// resourceGroupPaths resolves the dotted path of every group through its
+// parent, rejecting unknown parents, cycles and duplicate paths.
+func resourceGroupPaths(groups []addonv1alpha1.ResourceGroup) ([]string, error) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	paths := make([]string, len(groups))
+	state := make([]int, len(groups))
+
+	var resolve func(i int) error
+	resolve = func(i int) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("resource group %s is its own ancestor", groups[i].Name)
+		}
+		state[i] = visiting
+
+		g := groups[i]
+		paths[i] = g.Name
+		if g.Parent != "" {
+			found := false
+			parentName := g.Parent[strings.LastIndex(g.Parent, ".")+1:]
+			for j := range groups {
+				if groups[j].Name != parentName {
+					continue
+				}
+				if err := resolve(j); err != nil {
+					return err
+				}
+				if paths[j] == g.Parent {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("resource group %s has unknown parent %s", g.Name, g.Parent)
+			}
+			paths[i] = g.Parent + "." + g.Name
+		}
+		state[i] = done
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for i := range groups {
+		if err := resolve(i); err != nil {
+			return nil, err
+		}
+		if seen[paths[i]] {
+			return nil, fmt.Errorf("resource group %s is defined more than once", paths[i])
+		}
+		seen[paths[i]] = true
+	}
+	return paths, nil
+}
+
+// compilePatterns checks the regular expressions of a selector or rule.
+func compilePatterns(owner string, patterns ...string) error {
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("%s has an invalid pattern %q: %v", owner, p, err)
+		}
+	}
+	return nil
+}
+
+// resourceGroupsComponent renders spec.resourceGroups into the etc files of
+// the coordinator. Trino reads the file-based resource group and session
+// property managers at startup, so the chart restarts the coordinator when
+// they change.
+type resourceGroupsComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *resourceGroupsComponent) Name() string { return "ResourceGroups" }
+
+func (c *resourceGroupsComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	spec := addon.Spec.ResourceGroups
+
+	var groups, sessionProperties string
+	if spec != nil {
+		var err error
+		if groups, sessionProperties, err = renderResourceGroups(*spec); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	se, err := c.r.getStarburstEnterprise(ctx, Namespace)
+	if k8serrors.IsNotFound(err) && spec == nil {
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Applying without the files drops them once spec.resourceGroups is removed.
+	patch := starburstEnterprisePatch(se)
+	if groups != "" {
+		setCoordinatorEtcFile(patch, "resource-groups", "resource-groups.json", groups,
+			"resource-groups.configuration-manager=file",
+			"resource-groups.config-file="+starburstEtc+"/resource-groups.json")
+	}
+	if sessionProperties != "" {
+		setCoordinatorEtcFile(patch, "session-property-config", "session-property-config.json", sessionProperties,
+			"session-property-config.configuration-manager=file",
+			"session-property-manager.config-file="+starburstEtc+"/session-property-config.json")
+	}
+	return ctrl.Result{}, c.r.applyOperandPatch(ctx, addon, c.Name(), patch)
+}
+
+// setCoordinatorEtcFile adds file and the <manager>.properties file that
+// configures the manager reading it to the coordinator etc files of patch.
+func setCoordinatorEtcFile(patch *unstructured.Unstructured, manager, file, content string, properties ...string) {
+	_ = unstructured.SetNestedField(patch.Object, strings.Join(properties, "\n"),
+		"spec", "coordinator", "etcFiles", "properties", manager+".properties")
+	_ = unstructured.SetNestedField(patch.Object, content,
+		"spec", "coordinator", "etcFiles", "other", file)
+}
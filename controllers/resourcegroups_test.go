@@ -0,0 +1,125 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+func group(name, parent string) addonv1alpha1.ResourceGroup {
+	return addonv1alpha1.ResourceGroup{Name: name, Parent: parent, SoftMemoryLimit: "50%", HardConcurrencyLimit: 10, MaxQueued: 100}
+}
+
+func TestRenderResourceGroups(t *testing.T) {
+	spec := addonv1alpha1.ResourceGroups{
+		Groups: []addonv1alpha1.ResourceGroup{
+			group("adhoc", "global"),
+			group("global", ""),
+			group("${USER}", "global.adhoc"),
+		},
+		Selectors: []addonv1alpha1.ResourceGroupSelector{
+			{Group: "global.adhoc.${USER}", Source: ".*cli.*"},
+		},
+		SessionProperties: []addonv1alpha1.SessionPropertyRule{
+			{Group: "global\\.adhoc\\..*", SessionProperties: map[string]string{"query_max_execution_time": "1h"}},
+		},
+	}
+	groups, sessionProperties, err := renderResourceGroups(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantGroups := `{
+  "rootGroups": [
+    {
+      "name": "global",
+      "softMemoryLimit": "50%",
+      "hardConcurrencyLimit": 10,
+      "maxQueued": 100,
+      "subGroups": [
+        {
+          "name": "adhoc",
+          "softMemoryLimit": "50%",
+          "hardConcurrencyLimit": 10,
+          "maxQueued": 100,
+          "subGroups": [
+            {
+              "name": "${USER}",
+              "softMemoryLimit": "50%",
+              "hardConcurrencyLimit": 10,
+              "maxQueued": 100
+            }
+          ]
+        }
+      ]
+    }
+  ],
+  "selectors": [
+    {
+      "group": "global.adhoc.${USER}",
+      "source": ".*cli.*"
+    }
+  ]
+}`
+	if groups != wantGroups {
+		t.Errorf("resource groups =\n%s\nwant\n%s", groups, wantGroups)
+	}
+	wantSessionProperties := `[
+  {
+    "group": "global\\.adhoc\\..*",
+    "sessionProperties": {
+      "query_max_execution_time": "1h"
+    }
+  }
+]`
+	if sessionProperties != wantSessionProperties {
+		t.Errorf("session properties =\n%s\nwant\n%s", sessionProperties, wantSessionProperties)
+	}
+}
+
+func TestRenderResourceGroupsInvalid(t *testing.T) {
+	soft := int32(20)
+	cases := map[string]addonv1alpha1.ResourceGroups{
+		"cycle":          {Groups: []addonv1alpha1.ResourceGroup{group("a", "b"), group("b", "a")}},
+		"self parent":    {Groups: []addonv1alpha1.ResourceGroup{group("a", "a")}},
+		"unknown parent": {Groups: []addonv1alpha1.ResourceGroup{group("global", ""), group("adhoc", "other")}},
+		"duplicate":      {Groups: []addonv1alpha1.ResourceGroup{group("global", ""), group("global", "")}},
+		"selector not a leaf": {
+			Groups:    []addonv1alpha1.ResourceGroup{group("global", ""), group("adhoc", "global")},
+			Selectors: []addonv1alpha1.ResourceGroupSelector{{Group: "global"}},
+		},
+		"selector unknown group": {
+			Groups:    []addonv1alpha1.ResourceGroup{group("global", "")},
+			Selectors: []addonv1alpha1.ResourceGroupSelector{{Group: "global.adhoc"}},
+		},
+		"selector invalid pattern": {
+			Groups:    []addonv1alpha1.ResourceGroup{group("global", "")},
+			Selectors: []addonv1alpha1.ResourceGroupSelector{{Group: "global", User: "("}},
+		},
+		"soft above hard concurrency": {
+			Groups: []addonv1alpha1.ResourceGroup{{Name: "global", SoftMemoryLimit: "1GB", HardConcurrencyLimit: 10, SoftConcurrencyLimit: &soft}},
+		},
+	}
+
+	for name, spec := range cases {
+		if _, _, err := renderResourceGroups(spec); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+	"sigs.k8s.io/yaml"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// ruleEvalInterval is how often the harness evaluates the rule groups, the
+// default evaluation interval of Prometheus.
+const ruleEvalInterval = time.Minute
+
+// The harness follows the rules engine API of Prometheus 2.40, the
+// github.com/prometheus/prometheus v0.40 module pinned in go.mod. Later
+// releases log with slog and changed the LazyLoader and LoadGroups
+// signatures.
+
+// prometheusRuleLoader loads the groups of a generated PrometheusRule into
+// the rules manager, validating them as Prometheus does a rule file.
+type prometheusRuleLoader struct {
+	rule *promv1.PrometheusRule
+}
+
+func (l prometheusRuleLoader) Load(string) (*rulefmt.RuleGroups, []error) {
+	content, err := yaml.Marshal(l.rule.Spec)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return rulefmt.Parse(content)
+}
+
+func (prometheusRuleLoader) Parse(query string) (parser.Expr, error) { return parser.ParseExpr(query) }
+
+// firingAlerts loads series, in the notation of promtool rule tests with one
+// sample per minute, evaluates every group of rule each minute up to
+// evalTime, like promtool test rules, and returns the alerts firing at
+// evalTime by name. Rules failing to evaluate fail the test.
+func firingAlerts(t *testing.T, rule *promv1.PrometheusRule, series []string, evalTime time.Duration) map[string][]*rules.Alert {
+	t.Helper()
+	suite, err := promql.NewLazyLoader(t, "load 1m\n  "+strings.Join(series, "\n  "),
+		promql.LazyLoaderOpts{EnableAtModifier: true, EnableNegativeOffset: true})
+	if err != nil {
+		t.Fatalf("could not load series: %v", err)
+	}
+	defer suite.Close()
+
+	m := rules.NewManager(&rules.ManagerOptions{
+		QueryFunc:   rules.EngineQueryFunc(suite.QueryEngine(), suite.Storage()),
+		Appendable:  suite.Storage(),
+		Queryable:   suite.Storage(),
+		Context:     context.Background(),
+		NotifyFunc:  func(context.Context, string, ...*rules.Alert) {},
+		Logger:      log.NewNopLogger(),
+		GroupLoader: prometheusRuleLoader{rule},
+	})
+	loaded, errs := m.LoadGroups(ruleEvalInterval, labels.Labels{}, "", nil, rule.Name)
+	if len(errs) > 0 {
+		t.Fatalf("could not load rules: %v", errs)
+	}
+	var groups []*rules.Group
+	for _, g := range rule.Spec.Groups {
+		group := loaded[rules.GroupKey(rule.Name, g.Name)]
+		for _, r := range group.Rules() {
+			// Restored alerting rules write the ALERTS series right away.
+			if a, ok := r.(*rules.AlertingRule); ok {
+				a.SetRestored(true)
+			}
+		}
+		groups = append(groups, group)
+	}
+
+	start := time.Unix(0, 0).UTC()
+	for ts := start; !ts.After(start.Add(evalTime)); ts = ts.Add(ruleEvalInterval) {
+		suite.WithSamplesTill(ts, func(err error) {
+			if err != nil {
+				t.Fatalf("could not append series: %v", err)
+			}
+			for _, g := range groups {
+				g.Eval(suite.Context(), ts)
+				for _, r := range g.Rules() {
+					if err := r.LastError(); err != nil {
+						t.Fatalf("rule %s failed at %s: %v", r.Name(), ts.Sub(start), err)
+					}
+				}
+			}
+		})
+	}
+
+	firing := map[string][]*rules.Alert{}
+	for _, g := range groups {
+		for _, r := range g.AlertingRules() {
+			for _, a := range r.ActiveAlerts() {
+				if a.State == rules.StateFiring {
+					firing[r.Name()] = append(firing[r.Name()], a)
+				}
+			}
+		}
+	}
+	return firing
+}
+
+func TestPrometheusRulesFire(t *testing.T) {
+	defaults := ResolveConfig(testAddon(addonv1alpha1.StarburstAddonSpec{Metrics: true}), testRenderInputs())
+	asleep := defaults
+	asleep.Asleep = true
+	strict := ResolveConfig(testAddon(addonv1alpha1.StarburstAddonSpec{
+		Metrics:         true,
+		AlertThresholds: &addonv1alpha1.AlertThresholds{JVMMemoryPercent: int32Ptr(95)},
+	}), testRenderInputs())
+
+	heap := func(instance, used, max string) []string {
+		return []string{
+			`jvm_memory_bytes_used{area="heap",endpoint="metrics",instance="` + instance + `"} ` + used,
+			`jvm_memory_bytes_max{area="heap",endpoint="metrics",instance="` + instance + `"} ` + max,
+		}
+	}
+	remoteWrite := func(failed, total string) []string {
+		target := `{job="prometheus-operated",remote_name="vault",url="https://vault.example.com/api/v1/write"} `
+		return []string{
+			`prometheus_remote_storage_samples_failed_total` + target + failed,
+			`prometheus_remote_storage_samples_total` + target + total,
+		}
+	}
+
+	cases := []struct {
+		name     string
+		cfg      RenderConfig
+		series   []string
+		evalTime time.Duration
+		alert    string
+		// instances lists the instance label of every alert expected to fire.
+		instances []string
+	}{
+		{"JvmMemoryFillingUp fires on a full heap", defaults,
+			append(heap("worker-1", "90x10", "100x10"), heap("worker-2", "50x10", "100x10")...),
+			5 * time.Minute, "JvmMemoryFillingUp", []string{"worker-1"}},
+		{"JvmMemoryFillingUp is silent below the threshold", defaults,
+			heap("worker-1", "79x10", "100x10"),
+			5 * time.Minute, "JvmMemoryFillingUp", nil},
+		{"JvmMemoryFillingUp waits for its for duration", defaults,
+			heap("worker-1", "50x3 90x3", "100x10"),
+			5 * time.Minute, "JvmMemoryFillingUp", nil},
+		{"JvmMemoryFillingUp fires once the for duration passed", defaults,
+			heap("worker-1", "50x3 90x3", "100x10"),
+			7 * time.Minute, "JvmMemoryFillingUp", []string{"worker-1"}},
+		{"JvmMemoryFillingUp follows the threshold", strict,
+			heap("worker-1", "90x10", "100x10"),
+			5 * time.Minute, "JvmMemoryFillingUp", nil},
+		{"trino_node_failure fires when nodes are lost", defaults,
+			[]string{`trino_active_nodes{instance="coordinator"} 3x2 1x10`},
+			10 * time.Minute, "trino_node_failure", []string{"coordinator"}},
+		{"trino_node_failure is silent with every node active", defaults,
+			[]string{`trino_active_nodes{instance="coordinator"} 3x10`},
+			10 * time.Minute, "trino_node_failure", nil},
+		{"trino_node_failure waits for its for duration", defaults,
+			[]string{`trino_active_nodes{instance="coordinator"} 3x6 1x10`},
+			10 * time.Minute, "trino_node_failure", nil},
+		{"trino_node_failure is silent while asleep", asleep,
+			[]string{`trino_active_nodes{instance="coordinator"} 0x10`},
+			10 * time.Minute, "trino_node_failure", nil},
+		{"high_starburst_query_mem fires through its recording rule", defaults,
+			[]string{`jvm_memory_bytes_used{area="heap",endpoint="metrics",instance="worker-1"} 50000000000x15`},
+			12 * time.Minute, "high_starburst_query_mem", []string{"worker-1"}},
+		{"Watchdog always fires", defaults,
+			nil,
+			0, "Watchdog", []string{""}},
+		{"Watchdog fires while asleep", asleep,
+			nil,
+			0, "Watchdog", []string{""}},
+		{"PrometheusRemoteWriteFailing fires when samples are dropped", defaults,
+			remoteWrite("0+10x30", "0+100x30"),
+			25 * time.Minute, "PrometheusRemoteWriteFailing", []string{""}},
+		{"PrometheusRemoteWriteFailing is silent when samples are sent", defaults,
+			remoteWrite("0x30", "0+100x30"),
+			25 * time.Minute, "PrometheusRemoteWriteFailing", nil},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.series == nil {
+				// The loader needs a series to create the storage.
+				tc.series = []string{`up{job="prometheus-operated"} 1x10`}
+			}
+			alerts := firingAlerts(t, DeployPrometheusRules(tc.cfg), tc.series, tc.evalTime)[tc.alert]
+			if len(alerts) != len(tc.instances) {
+				t.Fatalf("%d %s alerts firing at %s, want %d", len(alerts), tc.alert, tc.evalTime, len(tc.instances))
+			}
+			for i, a := range alerts {
+				if got := a.Labels.Get("instance"); got != tc.instances[i] {
+					t.Errorf("alert %d fires for instance %q, want %q", i, got, tc.instances[i])
+				}
+				if a.Labels.Get("severity") == "" || a.Labels.Get("namespace") != Namespace {
+					t.Errorf("alert %d has labels %s, want severity and namespace", i, a.Labels)
+				}
+			}
+		})
+	}
+}
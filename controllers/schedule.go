@@ -0,0 +1,177 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// scheduleLookback is how far back the last sleep and wake are searched for.
+// Schedules firing less than weekly are not supported.
+const scheduleLookback = 8 * 24 * time.Hour
+
+// scheduleState reports whether the cluster should be asleep at now, that is
+// whether the last sleep fired after the last wake, and when that changes next.
+func scheduleState(schedule addonv1alpha1.Schedule, now time.Time) (bool, time.Time, error) {
+	loc := time.UTC
+	if schedule.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(schedule.TimeZone); err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid schedule time zone: %v", err)
+		}
+	}
+	sleep, err := cron.ParseStandard(schedule.Sleep)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("invalid sleep schedule: %v", err)
+	}
+	wake, err := cron.ParseStandard(schedule.Wake)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("invalid wake schedule: %v", err)
+	}
+
+	now = now.In(loc)
+	asleep := lastActivation(sleep, now).After(lastActivation(wake, now))
+	next := wake.Next(now)
+	if !asleep {
+		next = sleep.Next(now)
+	}
+	return asleep, next, nil
+}
+
+// lastActivation returns the last time s fired at or before now, or the zero
+// time if it did not fire within scheduleLookback.
+func lastActivation(s cron.Schedule, now time.Time) time.Time {
+	var last time.Time
+	for t := s.Next(now.Add(-scheduleLookback)); !t.IsZero() && !t.After(now); t = s.Next(t) {
+		last = t
+	}
+	return last
+}
+
+// scheduleComponent puts the cluster to sleep and wakes it up on the
+// schedule. It sets the worker count itself unless spec.autoscaling is set,
+// in which case the autoscaler scales to zero while status.schedule.asleep.
+// It runs before the PrometheusRules so that alerts follow the same state.
+type scheduleComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *scheduleComponent) Name() string { return "Schedule" }
+
+func (c *scheduleComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	schedule := addon.Spec.Schedule
+	if schedule == nil {
+		addon.Status.Schedule = nil
+		return ctrl.Result{}, nil
+	}
+	if schedule.Workers == nil && addon.Spec.Autoscaling == nil {
+		return ctrl.Result{}, fmt.Errorf("schedule.workers is required unless spec.autoscaling is set")
+	}
+
+	asleep, next, err := scheduleState(*schedule, time.Now())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Replicas are held while a maintenance window is open.
+	if result, err := deferDuringMaintenance(addon, "The sleep schedule"); err != nil {
+		return result, err
+	}
+
+	// Plan mode reports the next step without recording it.
+	if c.r.Plan {
+		saved, drain := addon.Status.Schedule.DeepCopy(), addon.Status.Drain.DeepCopy()
+		defer func() { addon.Status.Schedule, addon.Status.Drain = saved, drain }()
+	}
+
+	status := addon.Status.Schedule
+	if status == nil {
+		status = &addonv1alpha1.ScheduleStatus{}
+		addon.Status.Schedule = status
+	}
+	if status.LastTransitionTime == nil || status.Asleep != asleep {
+		log.FromContext(ctx).Info("Schedule changed the cluster state", "asleep", asleep)
+		now := metav1.Now()
+		status.LastTransitionTime = &now
+	}
+	status.Asleep = asleep
+	nextTransition := metav1.NewTime(next)
+	status.NextTransitionTime = &nextTransition
+	result := ctrl.Result{RequeueAfter: time.Until(next)}
+
+	se, err := c.r.getStarburstEnterprise(ctx, Namespace)
+	if err != nil {
+		return result, err
+	}
+
+	workers := &appsv1.Deployment{}
+	if err := c.r.Client.Get(ctx, types.NamespacedName{Name: workerDeployment, Namespace: Namespace}, workers); err != nil {
+		return result, fmt.Errorf("could not get Deployment %s: %w", workerDeployment, err)
+	}
+
+	patch := starburstEnterprisePatch(se)
+	var draining *pendingError
+	if addon.Spec.Autoscaling == nil {
+		desired := *schedule.Workers
+		if asleep {
+			desired = 0
+		}
+		replicas, done, err := c.r.workerReplicas(ctx, addon, desired)
+		if err != nil {
+			return result, err
+		}
+		if !done {
+			result.RequeueAfter = rolloutPollInterval
+			draining = &pendingError{
+				reason:  "DrainingWorkers",
+				message: fmt.Sprintf("Waiting for workers to finish their tasks before scaling down to %d", desired),
+			}
+		}
+		patch = workerReplicasPatch(se, replicas, addon.Spec)
+	}
+
+	// The coordinator goes last, once the workers have drained and stopped.
+	if schedule.Coordinator {
+		coordinators := int32(1)
+		if asleep && addon.Status.Drain == nil && workers.Status.Replicas == 0 {
+			coordinators = 0
+		} else if asleep {
+			result.RequeueAfter = rolloutPollInterval
+		}
+		_ = unstructured.SetNestedField(patch.Object, int64(coordinators), "spec", "coordinator", "replicas")
+	}
+
+	if err := c.r.applyOperandPatch(ctx, addon, c.Name(), patch); err != nil {
+		return result, err
+	}
+	if draining != nil {
+		return result, draining
+	}
+	return result, nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+func TestScheduleState(t *testing.T) {
+	businessHours := addonv1alpha1.Schedule{
+		Sleep:    "0 19 * * 1-5",
+		Wake:     "0 7 * * 1-5",
+		TimeZone: "Europe/Berlin",
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2022-11-07 is a Monday.
+	cases := []struct {
+		name       string
+		now        time.Time
+		wantAsleep bool
+		wantNext   time.Time
+	}{
+		{"working day", time.Date(2022, 11, 7, 12, 0, 0, 0, berlin), false, time.Date(2022, 11, 7, 19, 0, 0, 0, berlin)},
+		{"night", time.Date(2022, 11, 7, 23, 0, 0, 0, berlin), true, time.Date(2022, 11, 8, 7, 0, 0, 0, berlin)},
+		{"weekend", time.Date(2022, 11, 12, 12, 0, 0, 0, berlin), true, time.Date(2022, 11, 14, 7, 0, 0, 0, berlin)},
+		{"at wake", time.Date(2022, 11, 8, 7, 0, 0, 0, berlin), false, time.Date(2022, 11, 8, 19, 0, 0, 0, berlin)},
+		{"time zone", time.Date(2022, 11, 7, 18, 30, 0, 0, time.UTC), true, time.Date(2022, 11, 8, 7, 0, 0, 0, berlin)},
+	}
+
+	for _, tc := range cases {
+		asleep, next, err := scheduleState(businessHours, tc.now)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if asleep != tc.wantAsleep || !next.Equal(tc.wantNext) {
+			t.Errorf("%s: got asleep=%v next=%v, want asleep=%v next=%v", tc.name, asleep, next, tc.wantAsleep, tc.wantNext)
+		}
+	}
+
+	if _, _, err := scheduleState(addonv1alpha1.Schedule{Sleep: "not cron", Wake: "0 7 * * *"}, time.Now()); err == nil {
+		t.Error("expected an error for an invalid cron expression")
+	}
+}
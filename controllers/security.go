@@ -0,0 +1,391 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+const (
+	// sharedSecretKey holds the internal communication secret of the Trino
+	// nodes in the Secret returned by internalCommunicationSecret.
+	sharedSecretKey = "shared-secret"
+
+	// authMountPath is where the Secret of the password file is mounted.
+	authMountPath = starburstEtc + "/auth"
+
+	defaultPasswordFileKey = "password.db"
+)
+
+// internalCommunicationSecret is the Secret holding the shared secret the
+// Trino nodes, and the operator, authenticate to each other with.
+func internalCommunicationSecret(value []byte) *corev1.Secret {
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      Name + "-internal-communication",
+			Namespace: Namespace,
+		},
+	}
+	if value != nil {
+		secret.Data = map[string][]byte{sharedSecretKey: value}
+	}
+	return secret
+}
+
+// authenticationConfig is spec.authentication rendered for the chart.
+type authenticationConfig struct {
+	// properties are added to config.properties of the coordinator.
+	properties []string
+	// authenticator is password-authenticator.properties, empty for OAuth2.
+	authenticator []string
+	// secretVolume is the Secret mounted at authMountPath, if any.
+	secretVolume string
+}
+
+// renderAuthentication validates spec and renders the coordinator properties
+// it needs, reading secret values through lookup and handing them to the
+// nodes through env. Errors never carry the values.
+func renderAuthentication(spec addonv1alpha1.Authentication, lookup func(name, key string) (string, error), env *operandEnv) (authenticationConfig, error) {
+	secretValue := func(field string, ref corev1.SecretKeySelector) (string, error) {
+		value, err := lookup(ref.Name, ref.Key)
+		if err != nil {
+			return "", fmt.Errorf("could not read %s: %w", field, err)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return "", fmt.Errorf("%s must fit on one line", field)
+		}
+		return value, nil
+	}
+
+	// TLS is terminated by the Route or Ingress, which tells the coordinator
+	// through the X-Forwarded headers that the client connection is secure.
+	cfg := authenticationConfig{properties: []string{"http-server.process-forwarded=true"}}
+	switch spec.Type {
+	case "OAuth2":
+		o := spec.OAuth2
+		if o == nil {
+			return cfg, fmt.Errorf("spec.authentication.oauth2 is required for type OAuth2")
+		}
+		clientSecret, err := secretValue("spec.authentication.oauth2.clientSecret", o.ClientSecret)
+		if err != nil {
+			return cfg, err
+		}
+		scopes := o.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"openid"}
+		}
+		principal := o.PrincipalField
+		if principal == "" {
+			principal = "sub"
+		}
+		cfg.properties = append(cfg.properties,
+			"http-server.authentication.type=oauth2",
+			"web-ui.authentication.type=oauth2",
+			"http-server.authentication.oauth2.issuer="+o.Issuer,
+			"http-server.authentication.oauth2.client-id="+o.ClientID,
+			"http-server.authentication.oauth2.client-secret="+env.ref("oauth2_client_secret", clientSecret),
+			"http-server.authentication.oauth2.scopes="+strings.Join(scopes, ","),
+			"http-server.authentication.oauth2.principal-field="+principal)
+		switch {
+		case o.AuthURL == "" && o.TokenURL == "" && o.JWKSURL == "":
+		case o.AuthURL == "" || o.TokenURL == "" || o.JWKSURL == "":
+			return cfg, fmt.Errorf("spec.authentication.oauth2 needs authURL, tokenURL and jwksURL together")
+		default:
+			cfg.properties = append(cfg.properties,
+				"http-server.authentication.oauth2.oidc.discovery=false",
+				"http-server.authentication.oauth2.auth-url="+o.AuthURL,
+				"http-server.authentication.oauth2.token-url="+o.TokenURL,
+				"http-server.authentication.oauth2.jwks-url="+o.JWKSURL)
+		}
+	case "LDAP":
+		l := spec.LDAP
+		if l == nil {
+			return cfg, fmt.Errorf("spec.authentication.ldap is required for type LDAP")
+		}
+		cfg.properties = append(cfg.properties, "http-server.authentication.type=PASSWORD")
+		cfg.authenticator = []string{"password-authenticator.name=ldap", "ldap.url=" + l.URL}
+		switch {
+		case l.BindDN != "":
+			if l.BindPassword == nil || l.UserBaseDN == "" || l.GroupAuthorizationSearchPattern == "" {
+				return cfg, fmt.Errorf("spec.authentication.ldap.bindDN needs bindPassword, userBaseDN and groupAuthorizationSearchPattern")
+			}
+			password, err := secretValue("spec.authentication.ldap.bindPassword", *l.BindPassword)
+			if err != nil {
+				return cfg, err
+			}
+			cfg.authenticator = append(cfg.authenticator,
+				"ldap.bind-dn="+l.BindDN,
+				"ldap.bind-password="+env.ref("ldap_bind_password", password),
+				"ldap.user-base-dn="+l.UserBaseDN,
+				"ldap.group-auth-pattern="+l.GroupAuthorizationSearchPattern)
+		case l.UserBindPattern != "":
+			cfg.authenticator = append(cfg.authenticator, "ldap.user-bind-pattern="+l.UserBindPattern)
+			if l.UserBaseDN != "" && l.GroupAuthorizationSearchPattern != "" {
+				cfg.authenticator = append(cfg.authenticator,
+					"ldap.user-base-dn="+l.UserBaseDN,
+					"ldap.group-auth-pattern="+l.GroupAuthorizationSearchPattern)
+			}
+		default:
+			return cfg, fmt.Errorf("spec.authentication.ldap needs userBindPattern or bindDN")
+		}
+	case "PasswordFile":
+		p := spec.PasswordFile
+		if p == nil {
+			return cfg, fmt.Errorf("spec.authentication.passwordFile is required for type PasswordFile")
+		}
+		key := p.Key
+		if key == "" {
+			key = defaultPasswordFileKey
+		}
+		// The file is mounted rather than copied; reading it only checks it exists.
+		if _, err := lookup(p.SecretName, key); err != nil {
+			return cfg, fmt.Errorf("could not read spec.authentication.passwordFile: %w", err)
+		}
+		cfg.properties = append(cfg.properties, "http-server.authentication.type=PASSWORD")
+		cfg.authenticator = []string{"password-authenticator.name=file", "file.password-file=" + authMountPath + "/" + key}
+		cfg.secretVolume = p.SecretName
+	default:
+		return cfg, fmt.Errorf("unknown authentication type %q", spec.Type)
+	}
+	return cfg, nil
+}
+
+// securityComponent renders spec.authentication, spec.internalTLS and the
+// HTTPS port of spec.expose.serviceCA into the configuration of the Trino
+// nodes. They need the nodes to share a secret, which the component generates
+// and hands to the coordinator and the workers. Secret values reach the nodes
+// through the security env Secret.
+type securityComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *securityComponent) Name() string { return "Security" }
+
+func (c *securityComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	spec := addon.Spec.Authentication
+	enabled := securityEnabled(addon.Spec)
+	cfg := ResolveConfig(addon, RenderInputs{})
+
+	env, err := c.r.operandEnv(ctx, c.Name())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	var auth authenticationConfig
+	if spec != nil {
+		if addon.Spec.Expose == nil {
+			return ctrl.Result{}, fmt.Errorf("spec.authentication needs spec.expose, which terminates TLS in front of the coordinator")
+		}
+		if addon.Spec.NetworkPolicy == nil {
+			return ctrl.Result{}, fmt.Errorf("spec.authentication needs spec.networkPolicy, which keeps the other clients in the cluster off the plain HTTP port of the coordinator")
+		}
+		if auth, err = renderAuthentication(*spec, c.r.secretLookup(ctx, Namespace), env); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	se, err := c.r.getStarburstEnterprise(ctx, Namespace)
+	if k8serrors.IsNotFound(err) && !enabled {
+		addon.Status.InternalTLS = nil
+		return ctrl.Result{}, c.cleanUp(ctx, addon, cfg)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Applying without the properties drops them once both are removed.
+	var result ctrl.Result
+	patch := starburstEnterprisePatch(se)
+	if enabled {
+		shared, err := c.r.sharedSecret(ctx, addon)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		user, err := c.r.userOperand(ctx, addon)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		coordinator, worker, volumes, err := userSecuritySettings(user, c.r.secretLookup(ctx, Namespace), env)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		sharedRef := env.ref("internal_communication_shared_secret", shared)
+		coordinator = append(coordinator, auth.properties...)
+		coordinator = append(coordinator, "internal-communication.shared-secret="+sharedRef)
+		worker = append(worker, "internal-communication.shared-secret="+sharedRef)
+		if auth.secretVolume != "" {
+			volumes = append(volumes, secretVolume(authMountPath, auth.secretVolume))
+		}
+
+		if addon.Spec.InternalTLS != nil {
+			cert, err := c.r.nodeCertificates(ctx, addon, cfg)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if err := c.r.applyAll(ctx, addon, DeployInternalService(cfg)); err != nil {
+				return ctrl.Result{}, err
+			}
+			// A new keystore path changes the configuration, so the chart
+			// rolls the nodes onto the renewed certificate.
+			tls := internalTLSProperties(cfg, cert.revision)
+			coordinator = append(coordinator, tls...)
+			worker = append(worker, tls...)
+			volumes = append(volumes, secretVolume(internalTLSMountPath, internalTLSSecret(nil).Name))
+			result.RequeueAfter = time.Until(cert.renewTime)
+			if !c.r.Plan {
+				addon.Status.InternalTLS = &addonv1alpha1.InternalTLSStatus{
+					Revision:  cert.revision,
+					NotAfter:  metav1.NewTime(cert.notAfter),
+					RenewTime: metav1.NewTime(cert.renewTime),
+				}
+			}
+		} else if coordinatorHTTPS(cfg) {
+			// The service CA issues the certificate once the Service exists.
+			if err := c.r.applyAll(ctx, addon, DeployInternalService(cfg)); err != nil {
+				return ctrl.Result{}, err
+			}
+			keystore, err := c.r.servingKeystore(ctx, addon, cfg)
+			if err != nil {
+				return ctrl.Result{RequeueAfter: rolloutPollInterval}, err
+			}
+			coordinator = append(coordinator, servingTLSProperties(keystore)...)
+			volumes = append(volumes, secretVolume(servingTLSMountPath, servingKeystoreSecret(nil).Name))
+		}
+
+		_ = unstructured.SetNestedField(patch.Object, strings.Join(coordinator, "\n"),
+			"spec", "coordinator", "additionalProperties")
+		_ = unstructured.SetNestedField(patch.Object, strings.Join(worker, "\n"),
+			"spec", "worker", "additionalProperties")
+		if len(auth.authenticator) > 0 {
+			_ = unstructured.SetNestedField(patch.Object, strings.Join(auth.authenticator, "\n"),
+				"spec", "coordinator", "etcFiles", "properties", "password-authenticator.properties")
+		}
+		if len(volumes) > 0 {
+			_ = unstructured.SetNestedSlice(patch.Object, volumes, "spec", "additionalVolumes")
+		}
+	}
+	if err := c.r.applyOperandEnv(ctx, addon, c.Name(), env); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := c.r.applyOperandPatch(ctx, addon, c.Name(), patch); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !enabled {
+		addon.Status.InternalTLS = nil
+		return result, c.cleanUp(ctx, addon, cfg)
+	}
+	var unused []client.Object
+	if addon.Spec.InternalTLS == nil {
+		addon.Status.InternalTLS = nil
+		unused = append(unused, internalTLSSecret(nil))
+	}
+	if addon.Spec.InternalTLS != nil || !coordinatorHTTPS(cfg) {
+		unused = append(unused, servingKeystoreSecret(nil))
+	}
+	if !coordinatorHTTPS(cfg) {
+		unused = append(unused, DeployInternalService(cfg))
+	}
+	return result, c.r.deleteAll(ctx, addon, unused...)
+}
+
+// securityEnabled reports whether spec needs the security component to
+// configure the Trino nodes.
+func securityEnabled(spec addonv1alpha1.StarburstAddonSpec) bool {
+	return spec.Authentication != nil || spec.InternalTLS != nil ||
+		(spec.Expose != nil && spec.Expose.ServiceCA)
+}
+
+// userSecuritySettings returns the additionalProperties of the nodes and the
+// additionalVolumes of starburstenterprise.yaml, which the Operand component
+// strips while security is enabled. The component applies them first, ahead
+// of its own, as server-side apply cannot share a string or a list between
+// managers setting different values. Placeholders become references to env.
+func userSecuritySettings(user map[string]interface{}, lookup func(name, key string) (string, error), env *operandEnv) (coordinator, worker []string, volumes []interface{}, err error) {
+	refs := envRefs(lookup, env)
+	for _, node := range []struct {
+		name       string
+		properties *[]string
+	}{{"coordinator", &coordinator}, {"worker", &worker}} {
+		properties, _, _ := unstructured.NestedString(user, "spec", node.name, "additionalProperties")
+		if properties = strings.TrimSpace(properties); properties == "" {
+			continue
+		}
+		if properties, err = expandPlaceholders(properties, refs); err != nil {
+			return nil, nil, nil, fmt.Errorf("spec.%s.additionalProperties: %w", node.name, err)
+		}
+		*node.properties = append(*node.properties, properties)
+	}
+	volumes, _, _ = unstructured.NestedSlice(user, "spec", "additionalVolumes")
+	return coordinator, worker, volumes, nil
+}
+
+// cleanUp deletes what the component generated once nothing needs it.
+func (c *securityComponent) cleanUp(ctx context.Context, addon *addonv1alpha1.StarburstAddon, cfg RenderConfig) error {
+	return c.r.deleteAll(ctx, addon, internalCommunicationSecret(nil), internalTLSSecret(nil), servingKeystoreSecret(nil), operandEnvSecret(c.Name(), nil), DeployInternalService(cfg))
+}
+
+// secretVolume mounts a Secret on every node through the additionalVolumes
+// of the chart.
+func secretVolume(path, secretName string) map[string]interface{} {
+	return map[string]interface{}{
+		"path": path,
+		"volume": map[string]interface{}{
+			"secret": map[string]interface{}{"secretName": secretName},
+		},
+	}
+}
+
+// sharedSecret returns the internal communication secret, generating it the
+// first time. It is kept across reconciles since changing it restarts every
+// node.
+func (r *StarburstAddonReconciler) sharedSecret(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (string, error) {
+	secret, err := r.getSecret(ctx, internalCommunicationSecret(nil).Name, Namespace)
+	if err == nil && len(secret.Data[sharedSecretKey]) > 0 {
+		return string(secret.Data[sharedSecretKey]), nil
+	}
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return "", err
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("could not generate the internal communication secret: %v", err)
+	}
+	value := base64.StdEncoding.EncodeToString(random)
+	if err := r.applyAll(ctx, addon, internalCommunicationSecret([]byte(value))); err != nil {
+		return "", err
+	}
+	return value, nil
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+func TestRenderAuthentication(t *testing.T) {
+	secrets := map[string]string{"oidc/client-secret": "s3cr3t", "ldap/password": "bindpw", "users/password.db": "alice:$2y$10$x", "bad/value": "a\nb"}
+	lookup := func(name, key string) (string, error) {
+		if value, ok := secrets[name+"/"+key]; ok {
+			return value, nil
+		}
+		return "", fmt.Errorf("Secret %s has no key %s", name, key)
+	}
+	ref := func(name, key string) corev1.SecretKeySelector {
+		return corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+	}
+	// The references name the same variables for the same key and values.
+	envRef := func(name, value string) string {
+		return (&operandEnv{key: []byte("key"), vars: map[string]string{}}).ref(name, value)
+	}
+	oauth2 := &addonv1alpha1.OAuth2Authentication{Issuer: "https://sso.example.com", ClientID: "starburst", ClientSecret: ref("oidc", "client-secret")}
+
+	cases := []struct {
+		name          string
+		spec          addonv1alpha1.Authentication
+		valid         bool
+		property      string
+		authenticator string
+		volume        string
+	}{
+		{"oauth2", addonv1alpha1.Authentication{Type: "OAuth2", OAuth2: oauth2}, true,
+			"http-server.authentication.oauth2.client-secret=" + envRef("oauth2_client_secret", "s3cr3t"), "", ""},
+		{"oauth2 without section", addonv1alpha1.Authentication{Type: "OAuth2"}, false, "", "", ""},
+		{"oauth2 with partial endpoints", addonv1alpha1.Authentication{Type: "OAuth2", OAuth2: &addonv1alpha1.OAuth2Authentication{
+			Issuer: "https://sso.example.com", ClientSecret: ref("oidc", "client-secret"), AuthURL: "https://sso.example.com/auth"}}, false, "", "", ""},
+		{"oauth2 with multi-line secret", addonv1alpha1.Authentication{Type: "OAuth2", OAuth2: &addonv1alpha1.OAuth2Authentication{
+			Issuer: "https://sso.example.com", ClientSecret: ref("bad", "value")}}, false, "", "", ""},
+		{"ldap bind pattern", addonv1alpha1.Authentication{Type: "LDAP", LDAP: &addonv1alpha1.LDAPAuthentication{
+			URL: "ldaps://ldap.example.com:636", UserBindPattern: "uid=${USER},ou=people,dc=example,dc=com"}}, true,
+			"http-server.authentication.type=PASSWORD", "ldap.user-bind-pattern=uid=${USER},ou=people,dc=example,dc=com", ""},
+		{"ldap bind dn", addonv1alpha1.Authentication{Type: "LDAP", LDAP: &addonv1alpha1.LDAPAuthentication{
+			URL: "ldaps://ldap.example.com:636", BindDN: "cn=starburst", BindPassword: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ldap"}, Key: "password"},
+			UserBaseDN: "ou=people,dc=example,dc=com", GroupAuthorizationSearchPattern: "(uid=${USER})"}}, true,
+			"http-server.authentication.type=PASSWORD", "ldap.bind-password=" + envRef("ldap_bind_password", "bindpw"), ""},
+		{"ldap bind dn without password", addonv1alpha1.Authentication{Type: "LDAP", LDAP: &addonv1alpha1.LDAPAuthentication{
+			URL: "ldaps://ldap.example.com:636", BindDN: "cn=starburst", UserBaseDN: "ou=people", GroupAuthorizationSearchPattern: "(uid=${USER})"}}, false, "", "", ""},
+		{"ldap without bind", addonv1alpha1.Authentication{Type: "LDAP", LDAP: &addonv1alpha1.LDAPAuthentication{URL: "ldaps://ldap.example.com:636"}}, false, "", "", ""},
+		{"password file", addonv1alpha1.Authentication{Type: "PasswordFile", PasswordFile: &addonv1alpha1.PasswordFileAuthentication{SecretName: "users"}}, true,
+			"http-server.authentication.type=PASSWORD", "file.password-file=/etc/starburst/auth/password.db", "users"},
+		{"password file missing key", addonv1alpha1.Authentication{Type: "PasswordFile", PasswordFile: &addonv1alpha1.PasswordFileAuthentication{SecretName: "users", Key: "other"}}, false, "", "", ""},
+	}
+
+	for _, tc := range cases {
+		env := &operandEnv{key: []byte("key"), vars: map[string]string{}}
+		cfg, err := renderAuthentication(tc.spec, lookup, env)
+		if (err == nil) != tc.valid {
+			t.Errorf("%s: renderAuthentication() = %v, want valid %v", tc.name, err, tc.valid)
+			continue
+		}
+		if err != nil {
+			if strings.Contains(err.Error(), "bindpw") || strings.Contains(err.Error(), "a\nb") {
+				t.Errorf("%s: error %q carries a secret value", tc.name, err)
+			}
+			continue
+		}
+		for _, line := range append(cfg.properties, cfg.authenticator...) {
+			if strings.Contains(line, "s3cr3t") || strings.Contains(line, "bindpw") {
+				t.Errorf("%s: %q carries a secret value", tc.name, line)
+			}
+		}
+		if !containsString(cfg.properties, "http-server.process-forwarded=true") || !containsString(cfg.properties, tc.property) {
+			t.Errorf("%s: properties %v, want process-forwarded and %s", tc.name, cfg.properties, tc.property)
+		}
+		if tc.authenticator != "" && !containsString(cfg.authenticator, tc.authenticator) {
+			t.Errorf("%s: authenticator %v, want %s", tc.name, cfg.authenticator, tc.authenticator)
+		}
+		if cfg.secretVolume != tc.volume {
+			t.Errorf("%s: secret volume %q, want %q", tc.name, cfg.secretVolume, tc.volume)
+		}
+	}
+}
+
+func TestInternalBearer(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	token := internalBearer([]byte("shared"), now)
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("internalBearer() = %q, want a JWT", token)
+	}
+	key := sha256.Sum256([]byte("shared"))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if got := base64.RawURLEncoding.EncodeToString(mac.Sum(nil)); got != parts[2] {
+		t.Errorf("signature = %s, want %s", parts[2], got)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims struct {
+		Sub string `json:"sub"`
+		Exp int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Sub != FieldManager || claims.Exp != now.Add(5*time.Minute).Unix() {
+		t.Errorf("claims = %+v, want sub %s expiring in 5m", claims, FieldManager)
+	}
+}
+
+func TestSecurityKeepsOperandSettings(t *testing.T) {
+	manifest := `apiVersion: charts.starburstdata.com/v1alpha1
+kind: StarburstEnterprise
+spec:
+  additionalVolumes:
+  - path: /etc/extra
+    secret: extra
+  coordinator:
+    additionalProperties: |
+      query.max-memory=10GB
+      s3.aws-secret-key=${secret:aws/secret-key}
+`
+	c := applyClient{testOperand(t, "", "")}
+	ctx := context.Background()
+	for _, secret := range []*corev1.Secret{
+		{ObjectMeta: metav1.ObjectMeta{Name: "addon-managed-starburst-parameters", Namespace: Namespace}, Data: map[string][]byte{operandManifestKey: []byte(manifest)}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: Namespace}, Data: map[string][]byte{"secret-key": []byte("s3cr3t")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "users", Namespace: Namespace}, Data: map[string][]byte{"password.db": []byte("alice:$2y$10$x")}},
+	} {
+		if err := c.Create(ctx, secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addon := testAddon(addonv1alpha1.StarburstAddonSpec{
+		Expose:        &addonv1alpha1.Expose{},
+		NetworkPolicy: &addonv1alpha1.NetworkPolicy{},
+		Authentication: &addonv1alpha1.Authentication{
+			Type:         "PasswordFile",
+			PasswordFile: &addonv1alpha1.PasswordFileAuthentication{SecretName: "users"},
+		},
+	})
+
+	if _, err := (&securityComponent{r: &StarburstAddonReconciler{Client: c}}).Reconcile(ctx, addon); err != nil {
+		t.Fatal(err)
+	}
+	se := &unstructured.Unstructured{}
+	se.SetGroupVersionKind(StarburstEnterpriseGVK)
+	if err := c.Get(ctx, client.ObjectKey{Name: Name, Namespace: Namespace}, se); err != nil {
+		t.Fatal(err)
+	}
+
+	properties, _, _ := unstructured.NestedString(se.Object, "spec", "coordinator", "additionalProperties")
+	lines := strings.Split(properties, "\n")
+	if len(lines) < 3 || lines[0] != "query.max-memory=10GB" || !envReference.MatchString(lines[1]) || !containsString(lines, "http-server.authentication.type=PASSWORD") {
+		t.Errorf("got coordinator properties\n%s\nwant those of the manifest followed by the authentication", properties)
+	}
+	if strings.Contains(properties, "s3cr3t") {
+		t.Errorf("coordinator properties carry a secret value:\n%s", properties)
+	}
+	volumes, _, _ := unstructured.NestedSlice(se.Object, "spec", "additionalVolumes")
+	if len(volumes) != 2 || volumes[0].(map[string]interface{})["secret"] != "extra" {
+		t.Errorf("got volumes %v, want the extra volume followed by the password file", volumes)
+	}
+}
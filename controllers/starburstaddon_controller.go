@@ -18,32 +18,47 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
-	addonv1alpha1 "github.com/cmwylie19/addon-operator/api/v1alpha1"
 	"github.com/go-logr/logr"
 
-	configv1 "github.com/openshift/api/config/v1"
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+	routev1 "github.com/openshift/api/route/v1"
 	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	promv1alpha1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1alpha1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
-// AddonReconciler reconciles a Addon object
-type AddonReconciler struct {
+// StarburstAddonReconciler reconciles a StarburstAddon object
+type StarburstAddonReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	Log    logr.Logger
+
+	// Plan runs the reconciler without mutating generated resources. Desired
+	// state is dry-run against the live objects and the changes it would make
+	// are logged and reported in status.plan.
+	Plan bool
 }
 
 var (
@@ -52,612 +67,313 @@ var (
 	Namespace = "redhat-starburst-operator"
 )
 
-// +kubebuilder:rbac:groups=charts.starburstdata.com,resources=starburstenterprises,verbs=create;get;list;watch
-// +kubebuilder:rbac:groups=addon.redhat.com,resources=addons,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=addon.redhat.com,resources=addons/status,verbs=get;update;patch
-// +kubebuilder:rbac:groups=addon.redhat.com,resources=addons/finalizers,verbs=update
-// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
-
-// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch
+// FieldManager is the server-side apply field manager for every object the
+// operator generates. Only the fields set by the Deploy* builders are owned by
+// it.
+const FieldManager = "starburstaddon-operator"
+
+// Finalizer removes the generated resources before a StarburstAddon is deleted.
+// They live in the operand namespace, so owner references cannot be used.
+const Finalizer = "managed-tenants.redhat.com/finalizer"
+
+// +kubebuilder:rbac:groups=charts.starburstdata.com,resources=starburstenterprises,verbs=create;get;list;watch;update;patch
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=managed-tenants.redhat.com,resources=starburstaddons,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=managed-tenants.redhat.com,resources=starburstaddons/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=managed-tenants.redhat.com,resources=starburstaddons/finalizers,verbs=update
+// +kubebuilder:rbac:groups=managed-tenants.redhat.com,resources=starburstcatalogs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=managed-tenants.redhat.com,resources=starburstcatalogs/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=config.openshift.io,resources=clusterversions,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch
+
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=endpoints,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings;clusterrolebindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles,verbs=bind,resourceNames=cluster-monitoring-view
 // +kubebuilder:rbac:groups=monitoring.coreos.com,resources={alertmanagers,prometheuses,alertmanagerconfigs},verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheusrules,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheusrules,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=monitoring.coreos.com,resources=podmonitors,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;list;watch;update;patch;create;delete
+// +kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=route.openshift.io,resources=routes/custom-host,verbs=create;update;patch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the Addon object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// The work is split into components (license, prometheus, servicemonitors,
+// schedule, rules, alerting, operand, catalogs, resource groups, access
+// control, expose, security, network policies, version, autoscaling, pod
+// security) that are reconciled independently, each reporting its own
+// <Name>Ready condition. Every generated object is server-side applied under
+// FieldManager, so fields set by other actors are left alone. Conflicting
+// fields are reported in the FieldConflict condition unless spec.forceApply
+// is set.
+//
+// spec.paused skips everything but the Paused condition.
+// spec.maintenanceWindows defers operand upgrades while a window is open.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.13.0/pkg/reconcile
-func (r *AddonReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *StarburstAddonReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 
-	// Fetch the Addon instance
+	// Fetch the StarburstAddon instance
 	// if addon is not found, we will ignore it will stop reconciling
-	addon := &addonv1alpha1.Addon{}
+	addon := &addonv1alpha1.StarburstAddon{}
 	if err := r.Client.Get(ctx, types.NamespacedName{
 		Name:      req.Name,
 		Namespace: req.Namespace,
 	}, addon); err != nil {
 
 		if k8serrors.IsNotFound(err) {
-			logger.Info("Addon CR not found. Probably deleted.")
+			logger.Info("StarburstAddon CR not found. Probably deleted.")
 			return ctrl.Result{}, nil
 		}
 
-		return ctrl.Result{}, fmt.Errorf("could not get Addon CR: %v", err)
+		return ctrl.Result{}, fmt.Errorf("could not get StarburstAddon CR: %v", err)
 	}
 
-	// Fetch clusterversion instance
-	cv := &configv1.ClusterVersion{}
-	if err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      req.Name,
-		Namespace: req.Namespace,
-	}, cv); err != nil {
-
-		if k8serrors.IsNotFound(err) {
-			logger.Info("ClusterVersion not found")
-			return ctrl.Result{}, nil
-		}
+	// status.plan only describes the current reconcile
+	addon.Status.Plan = nil
 
-		return ctrl.Result{}, fmt.Errorf("could not get ClusterVersion CR: %v", err)
+	if !addon.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, addon)
 	}
 
-	// Fetch User Params Secret
-	userParams := &corev1.Secret{}
-	if err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      "addon-managed-starburst-parameters",
-		Namespace: req.Namespace,
-	}, userParams); err != nil {
-
-		if k8serrors.IsNotFound(err) {
-			logger.Info("User Params Secret not found.")
-			return ctrl.Result{Requeue: true}, nil
+	setPausedCondition(addon)
+	if addon.Spec.Paused {
+		logger.Info("Reconciliation is paused, leaving generated resources untouched")
+		if err := r.Client.Status().Update(ctx, addon); err != nil {
+			return ctrl.Result{}, fmt.Errorf("could not update StarburstAddon status: %v", err)
 		}
+		return ctrl.Result{}, nil
+	}
 
-		return ctrl.Result{Requeue: true}, fmt.Errorf("could not get User Params Secret: %v", err)
+	if !r.Plan && !controllerutil.ContainsFinalizer(addon, Finalizer) {
+		controllerutil.AddFinalizer(addon, Finalizer)
+		if err := r.Client.Update(ctx, addon); err != nil {
+			return ctrl.Result{}, fmt.Errorf("could not add finalizer: %v", err)
+		}
 	}
 
-	// Get or Create starburst-license secret
-	licenseSecret := &corev1.Secret{}
-	if err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      "starburst-license",
-		Namespace: req.Namespace,
-	}, licenseSecret); err != nil && k8serrors.IsNotFound(err) {
-		logger.Info("License Secret not found. Creating...")
-		licenseSecret = r.DeployLicenseSecret(ctx, string(userParams.Data["starburst-license"]), req.Namespace)
-		if err := r.Client.Create(ctx, licenseSecret); err != nil {
-			return ctrl.Result{Requeue: true}, fmt.Errorf("could not create License Secret: %v", err)
+	// Run every component, even if an earlier one failed, and record the
+	// outcome of each in its own condition.
+	var (
+		result    = ctrl.Result{RequeueAfter: time.Minute}
+		errs      []error
+		conflicts []string
+	)
+	windowEnd, windowErr := maintenanceWindowEnd(addon.Spec.MaintenanceWindows, time.Now())
+	setMaintenanceCondition(addon, windowEnd, windowErr)
+	for _, c := range r.components() {
+		res, err := c.Reconcile(ctx, addon)
+		setComponentCondition(addon, c, err)
+
+		var (
+			conflict *conflictError
+			pending  *pendingError
+		)
+		switch {
+		case err == nil:
+		case errors.As(err, &conflict):
+			conflicts = append(conflicts, conflict.objects...)
+		case errors.As(err, &pending):
+			logger.Info("Component in progress", "component", c.Name(), "reason", pending.reason, "message", pending.message)
+		case k8serrors.IsNotFound(err):
+			logger.Info("Component waiting for a dependency", "component", c.Name(), "reason", err.Error())
+		default:
+			logger.Error(err, "Component failed", "component", c.Name())
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name(), err))
 		}
+		result = mergeResults(result, res)
+	}
 
-		// License secret creation successful
-		// We will requeue the reconciliation so that we can ensure the secret remains
-		return ctrl.Result{Requeue: true}, nil
-	} else if err != nil {
-		logger.Error(err, "could not get License Secret")
-		return ctrl.Result{Requeue: true}, fmt.Errorf("could not get License Secret: %v", err)
+	setConflictCondition(addon, conflicts)
+	if err := r.Client.Status().Update(ctx, addon); err != nil {
+		return ctrl.Result{Requeue: true}, fmt.Errorf("could not update StarburstAddon status: %v", err)
 	}
 
-	// Secret
-	vault := &corev1.Secret{}
-	if err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      "addon",
-		Namespace: req.Namespace,
-	}, vault); err != nil {
+	return result, kerrors.NewAggregate(errs)
+}
 
-		if k8serrors.IsNotFound(err) {
-			logger.Info("Addon Secret not found.")
-			return ctrl.Result{}, err
-		}
+// apply server-side applies obj under FieldManager. Ownership of fields held
+// by another manager is only taken over when spec.forceApply is set. In plan
+// mode the apply is only dry-run and recorded in addon's status.
+func (r *StarburstAddonReconciler) apply(ctx context.Context, addon *addonv1alpha1.StarburstAddon, obj client.Object) error {
+	return r.applyAs(ctx, addon, FieldManager, obj)
+}
 
-		return ctrl.Result{}, fmt.Errorf("could not get Addon Secret: %v", err)
+// applyAs is apply under a different field manager.
+func (r *StarburstAddonReconciler) applyAs(ctx context.Context, addon *addonv1alpha1.StarburstAddon, manager string, obj client.Object) error {
+	opts := []client.PatchOption{client.FieldOwner(manager)}
+	if addon.Spec.ForceApply {
+		opts = append(opts, client.ForceOwnership)
+	}
+	if r.Plan {
+		return r.planApply(ctx, addon, obj, opts...)
 	}
+	return r.Client.Patch(ctx, obj, client.Apply, opts...)
+}
 
-	// Deploy Prometheus
-	prometheus := &promv1.Prometheus{}
-	if err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      Name,
-		Namespace: Namespace,
-	}, prometheus); err != nil && k8serrors.IsNotFound(err) {
-		logger.Info("Prometheus not found. Creating...")
-		// tokenURL, remoteWriteURL, clusterID string
-		prometheus = r.DeployPrometheus(string(vault.Data["token-url"]), string(vault.Data["remote-write-url"]), fetchClusterID())
-		if err := r.Client.Create(ctx, prometheus); err != nil {
-			logger.Error(err, "Could not create Prometheus")
-			return ctrl.Result{Requeue: true}, fmt.Errorf("could not create Prometheus: %v", err)
-		}
+// finalize deletes everything the operator generated for addon and then
+// releases the finalizer.
+func (r *StarburstAddonReconciler) finalize(ctx context.Context, addon *addonv1alpha1.StarburstAddon) error {
+	if !controllerutil.ContainsFinalizer(addon, Finalizer) {
+		return nil
+	}
 
-		// Prometheus created successfully
-		// We will requeue the request to ensure the Prometheus is created
-		return ctrl.Result{Requeue: true}, nil
-	} else if err != nil {
-		logger.Error(err, "could not get Prometheus")
-		// return the error for the next reconcile
-		return ctrl.Result{Requeue: true}, fmt.Errorf("could not get Prometheus: %v", err)
+	log.FromContext(ctx).Info("StarburstAddon is being deleted. Removing generated resources.")
+	cfg := ResolveConfig(addon, RenderInputs{})
+	cfg.Metrics = true
+	generated := append(DeployAll(cfg), internalCommunicationSecret(nil), internalTLSSecret(nil), servingKeystoreSecret(nil))
+	for _, component := range operandEnvComponents {
+		generated = append(generated, operandEnvSecret(component, nil))
+	}
+	if err := r.deleteAll(ctx, addon, generated...); err != nil {
+		return err
+	}
+	if r.Plan {
+		return r.Client.Status().Update(ctx, addon)
 	}
 
-	// Deploy ServiceMonitor
-	serviceMonitor := &promv1.ServiceMonitor{}
-	if err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      Name,
-		Namespace: Namespace,
-	}, serviceMonitor); err != nil && k8serrors.IsNotFound(err) {
-		logger.Info("Service Monitor not found. Creating...")
-		serviceMonitor = r.DeployServiceMonitor()
-		if err := r.Client.Create(ctx, serviceMonitor); err != nil {
-			logger.Error(err, "Could not create Service Monitor")
-			return ctrl.Result{Requeue: true}, fmt.Errorf("could not create service monitor: %v", err)
-		}
+	controllerutil.RemoveFinalizer(addon, Finalizer)
+	if err := r.Client.Update(ctx, addon); err != nil {
+		return fmt.Errorf("could not remove finalizer: %v", err)
 	}
+	return nil
+}
 
-	// Deploy Federation ServiceMonitor
-	fedServiceMonitor := &promv1.ServiceMonitor{}
-	if err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      Name + "-federation",
-		Namespace: Namespace,
-	}, fedServiceMonitor); err != nil && k8serrors.IsNotFound(err) {
-		logger.Info("Federation Service Monitor not found. Creating...")
-		fedServiceMonitor = r.DeployFederationServiceMonitor()
-		if err := r.Client.Create(ctx, fedServiceMonitor); err != nil {
-			logger.Error(err, "Could not create Federation Service Monitor")
-			return ctrl.Result{Requeue: true}, fmt.Errorf("could not create federation service monitor: %v", err)
-		}
+// setConflictCondition records the objects that could not be applied
+// because of field ownership conflicts in the FieldConflict condition.
+func setConflictCondition(addon *addonv1alpha1.StarburstAddon, conflicts []string) {
+	condition := metav1.Condition{
+		Type:               addonv1alpha1.ConditionFieldConflict,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Applied",
+		Message:            "All generated resources were applied",
+		ObservedGeneration: addon.Generation,
+	}
+	if len(conflicts) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "FieldManagerConflict"
+		condition.Message = (&conflictError{objects: conflicts}).Error()
 	}
 
-	// Deploy PrometheusRules
-	prometheusRule := &promv1.PrometheusRule{}
-	if err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      Name,
-		Namespace: Namespace,
-	}, prometheusRule); err != nil && k8serrors.IsNotFound(err) {
-		logger.Info("Prometheus Rules not found. Creating...")
-		prometheusRule = r.DeployPrometheusRules()
-		if err := r.Client.Create(ctx, prometheusRule); err != nil {
-			logger.Error(err, "Could not create Prometheus Rules")
-			return ctrl.Result{Requeue: true}, fmt.Errorf("could not create Prometheus Rules: %v", err)
-		}
+	meta.SetStatusCondition(&addon.Status.Conditions, condition)
+}
+
+// setPausedCondition records whether spec.paused stops reconciliation.
+func setPausedCondition(addon *addonv1alpha1.StarburstAddon) {
+	condition := metav1.Condition{
+		Type:               addonv1alpha1.ConditionPaused,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Reconciling",
+		Message:            "Generated resources are reconciled",
+		ObservedGeneration: addon.Generation,
+	}
+	if addon.Spec.Paused {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "PausedBySpec"
+		condition.Message = "Reconciliation is paused, set spec.paused to false to resume"
 	}
 
-	// Deploy Operand
-	cj := &batchv1.CronJob{}
-	if err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      Name,
-		Namespace: Namespace,
-	}, cj); err != nil && k8serrors.IsNotFound(err) {
-		logger.Info("CronJob not found. Creating...")
-		cj = r.DeployCronJob()
-		if err := r.Client.Create(ctx, cj); err != nil {
-			logger.Error(err, "Could not create CronJob")
-			return ctrl.Result{Requeue: true}, fmt.Errorf("could not create CronJob: %v", err)
-		}
+	meta.SetStatusCondition(&addon.Status.Conditions, condition)
+}
 
-		// CronJob created successfully
-		// We will requeue the request to ensure the CronJob is created
-		// return ctrl.Result{Requeue: true}, nil
+// setComponentCondition records the outcome of a component in its
+// <Name>Ready condition.
+func setComponentCondition(addon *addonv1alpha1.StarburstAddon, c component, err error) {
+	condition := metav1.Condition{
+		Type:               c.Name() + "Ready",
+		Status:             metav1.ConditionTrue,
+		Reason:             componentReason(err),
+		Message:            c.Name() + " is up to date",
+		ObservedGeneration: addon.Generation,
 	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Message = err.Error()
+	}
+
+	meta.SetStatusCondition(&addon.Status.Conditions, condition)
+}
 
-	return ctrl.Result{RequeueAfter: time.Minute}, nil
+// mergeResults combines component results so the earliest requested requeue wins.
+func mergeResults(a, b ctrl.Result) ctrl.Result {
+	merged := ctrl.Result{Requeue: a.Requeue || b.Requeue, RequeueAfter: a.RequeueAfter}
+	if b.RequeueAfter > 0 && (merged.RequeueAfter == 0 || b.RequeueAfter < merged.RequeueAfter) {
+		merged.RequeueAfter = b.RequeueAfter
+	}
+	return merged
 }
 
 // SetupWithManager sets up the controller with the Manager.
-func (r *AddonReconciler) SetupWithManager(mgr ctrl.Manager) error {
-
-	// gv, err := schema.ParseGroupVersion("starburst.group.com/v1")
-	// if err != nil {
-	//     return nil, err
-	// }
-	// newObj := unstructured.Unstructured{}
-	// newObj.SetGroupVersionKind(gv.WithKind("StarburstAddon"))
-	// return ctrl.NewControllerManagedBy(mgr).
-	//     For(&newObj)...
-	//    ... ....
-
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&addonv1alpha1.Addon{}).
-		Owns(&promv1.ServiceMonitor{}).
-		Owns(&promv1.Prometheus{}).
+func (r *StarburstAddonReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// The generated resources carry no owner references, so changes to
+	// anything in the operand namespace are mapped back to every StarburstAddon.
+	operandNamespace := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetNamespace() == Namespace
+	})
+	inOperandNamespace := builder.WithPredicates(operandNamespace)
+	toAddons := handler.EnqueueRequestsFromMapFunc(r.requestsForAddons)
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&addonv1alpha1.StarburstAddon{}).
+		Watches(&source.Kind{Type: &promv1.ServiceMonitor{}}, toAddons, inOperandNamespace).
+		Watches(&source.Kind{Type: &promv1.Prometheus{}}, toAddons, inOperandNamespace).
+		Watches(&source.Kind{Type: &promv1.PrometheusRule{}}, toAddons, inOperandNamespace).
+		Watches(&source.Kind{Type: &promv1.Alertmanager{}}, toAddons, inOperandNamespace).
 
 		// get mounted into the cronjob
 		// Used in Prometheus & ServiceMonitor
-		Owns(&corev1.Secret{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, toAddons, inOperandNamespace).
 
 		// apply bundle & operand
 		// job instead of cronjob
-		Owns(&batchv1.CronJob{}).
-		Complete(r)
-}
-
-func (r *AddonReconciler) DeployCronJob() *batchv1.CronJob {
-	defaultMode := int32(0755)
-	failLimit := int32(3)
-	return &batchv1.CronJob{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      Name,
-			Namespace: Namespace,
-		},
-		Spec: batchv1.CronJobSpec{
-			Schedule:               "*/1 * * * *",
-			FailedJobsHistoryLimit: &failLimit,
-			JobTemplate: batchv1.JobTemplateSpec{
-				Spec: batchv1.JobSpec{
-					Template: corev1.PodTemplateSpec{
-						Spec: corev1.PodSpec{
-							ServiceAccountName: "addon-operator-controller-manager",
-							Volumes: []corev1.Volume{
-								{
-									Name: "user-params",
-									VolumeSource: corev1.VolumeSource{
-										Secret: &corev1.SecretVolumeSource{
-											SecretName:  "addon-managed-starburst-parameters",
-											DefaultMode: &defaultMode,
-										},
-									},
-								},
-							},
-
-							Containers: []corev1.Container{
-								{
-									Name:  "addon",
-									Image: "cmwylie19/kube-argo-base",
-									Command: []string{
-										"sh",
-										"-c",
-										"kubectl apply -f /opt/scripts/starburstenterprise.yaml",
-									},
-									VolumeMounts: []corev1.VolumeMount{
-										{
-											Name:      "user-params",
-											MountPath: "/opt/scripts",
-											ReadOnly:  true,
-										},
-									},
-								},
-							},
-							RestartPolicy: corev1.RestartPolicyNever,
-						},
-					},
-				},
-			},
-		},
-	}
-}
-
-func (r *AddonReconciler) DeployServiceMonitor() *promv1.ServiceMonitor {
-	return &promv1.ServiceMonitor{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      Name,
-			Namespace: Namespace,
-		},
-		Spec: promv1.ServiceMonitorSpec{
-			NamespaceSelector: promv1.NamespaceSelector{
-				MatchNames: []string{Namespace},
-			},
-			Selector: metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app": "starburst-enterprise",
-				},
-			},
-			Endpoints: []promv1.Endpoint{
-				{
-					Port:     "metrics",
-					Interval: "2s",
-				},
-			},
-		},
-	}
-}
-
-func (r *AddonReconciler) DeployPrometheusRules() *promv1.PrometheusRule {
-	return &promv1.PrometheusRule{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      Name,
-			Namespace: Namespace,
-			Labels: map[string]string{
-				"app": "starburst",
-			},
-		},
-		Spec: promv1.PrometheusRuleSpec{
-			Groups: []promv1.RuleGroup{
-				{
-					Name: "starburst_alert_rules",
-					Rules: []promv1.Rule{
-						{
-							Alert: "high_starburst_query_mem",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("starburst_query_mem >= 45158388108"),
-							For:  "5m",
-							Annotations: map[string]string{
-								"summary":     "High Query Memory",
-								"severity":    "page",
-								"description": "High average memory used by all queries over a given time period",
-							},
-						},
-						{
-							Alert: "high_starburst_heap_mem",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("starburst_heap_mem >= 45631505600"),
-							For:  "5m",
-							Annotations: map[string]string{
-								"summary":     "High Max Heap Memory",
-								"severity":    "warn",
-								"description": "The max amount of heap memory configured in the JVM aggregated across the entire cluster",
-							},
-						},
-						{
-							Alert: "high_starburst_max_query_mem",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("starburst_max_query_mem >= 94489280512"),
-							For:  "5m",
-							Annotations: map[string]string{
-								"summary":     "High Heap Memory",
-								"severity":    "warn",
-								"description": "High amount of heap memory used by the JVMs across all cluster nodes",
-							},
-						},
-						{
-							Alert: "trino_node_failure",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("trino_active_nodes <= 1"),
-							For:  "5m",
-							Annotations: map[string]string{
-								"summary":     "Trino node failure",
-								"severity":    "page",
-								"description": "An active trino node went down",
-							},
-						},
-						{
-							Alert: "high_starburst_max_heap_mem",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("starburst_max_heap_mem >= 94489280512"),
-							For:  "5m",
-							Annotations: map[string]string{
-								"summary":     "High Max Heap Memory Alert",
-								"severity":    "acknowledged",
-								"description": "The max amount of heap memory configured in the JVM aggregated across the entire cluster",
-							},
-						},
-						{
-							Alert: "starburst_instance_down",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("count(up{endpoint=\"metrics\"}) != 3"),
-							For:  "5m",
-							Annotations: map[string]string{
-								"summary":     "Starburst instance down",
-								"severity":    "page",
-								"description": "The pods churned",
-							},
-						},
-						{
-							Alert: "high_thread_count",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("sum(thread_count) > 400"),
-							For:  "5m",
-							Annotations: map[string]string{
-								"summary":     "High Thread Count",
-								"severity":    "page",
-								"description": "High Thread Count",
-							},
-						},
-						{
-							Alert: "JvmMemoryFillingUp",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("(sum by (instance)(jvm_memory_bytes_used{area=\"heap\"}) / sum by (instance)(jvm_memory_bytes_max{area=\"heap\"})) * 100 > 80"),
-							For:  "2m",
-							Annotations: map[string]string{
-								"summary":     "JVM memory filling up (instance {{ $labels.instance }})",
-								"severity":    "page",
-								"description": "JVM memory is filling up (> 80%)\n  VALUE = {{ $value }}\n  LABELS = {{ $labels }}",
-							},
-						},
-						{
-							Alert: "starburst_failed_queries",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("failed_queries >= 4"),
-							For:  "5m",
-							Annotations: map[string]string{
-								"summary":     "Queries are failing",
-								"severity":    "page",
-								"description": "In the last 5 mins the failed queries have risen",
-							},
-						},
-					},
-				},
-				{
-					Name: "starburst_custom_rules",
-					Rules: []promv1.Rule{
-						{
-							Record: "starburst_query_mem",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("avg_over_time(jvm_memory_bytes_used{endpoint=\"metrics\"}[5m])"),
-						},
-						{
-							Record: "starburst_max_query_mem",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("jvm_memory_bytes_max{endpoint=\"metrics\", area=\"heap\"}"),
-						},
-						{
-							Record: "starburst_heap_mem",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("jvm_memory_bytes_used{endpoint=\"metrics\",area=\"heap\"}"),
-						},
-						{
-							Record: "starburst_max_heap_mem",
-							//Expr:  intstr.FromString("up{job=\"starburst-enterprise\"} == 0"),
-							Expr: intstr.FromString("jvm_memory_bytes_max{endpoint=\"metrics\",area=\"heap\"}"),
-						},
-					},
-				},
-			},
-		},
+		Watches(&source.Kind{Type: &batchv1.CronJob{}}, toAddons, inOperandNamespace).
+
+		// catalogs are added to the operand; their own status updates are ignored
+		Watches(&source.Kind{Type: &addonv1alpha1.StarburstCatalog{}}, toAddons,
+			builder.WithPredicates(operandNamespace, predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &networkingv1.Ingress{}}, toAddons, inOperandNamespace).
+		Watches(&source.Kind{Type: &networkingv1.NetworkPolicy{}}, toAddons, inOperandNamespace).
+		Watches(&source.Kind{Type: &corev1.Service{}}, toAddons, inOperandNamespace).
+		Watches(&source.Kind{Type: &corev1.ServiceAccount{}}, toAddons, inOperandNamespace).
+		Watches(&source.Kind{Type: &rbacv1.Role{}}, toAddons, inOperandNamespace).
+		Watches(&source.Kind{Type: &rbacv1.RoleBinding{}}, toAddons, inOperandNamespace)
+
+	// Routes are only served on OpenShift
+	routes := routev1.GroupVersion.WithKind("Route")
+	if _, err := mgr.GetRESTMapper().RESTMapping(routes.GroupKind(), routes.Version); err == nil {
+		b = b.Watches(&source.Kind{Type: &routev1.Route{}}, toAddons, inOperandNamespace)
 	}
-}
-
-func (r *AddonReconciler) DeployPrometheus(tokenURL, remoteWriteURL, clusterID string) *promv1.Prometheus {
-	return &promv1.Prometheus{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      Name,
-			Namespace: Namespace,
-		},
-		Spec: promv1.PrometheusSpec{
-			RuleSelector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app": "starburst",
-				},
-			},
-			CommonPrometheusFields: promv1.CommonPrometheusFields{
-				ExternalLabels: map[string]string{
-					"cluster_id": clusterID,
-				},
-				LogLevel: "debug",
-				RemoteWrite: []promv1.RemoteWriteSpec{
-					{
-						WriteRelabelConfigs: []promv1.RelabelConfig{
-							{
-								Action: "keep",
-								Regex:  "csv_succeeded$|csv_abnormal$|cluster_version$|ALERTS$|subscription_sync_total|trino_.*$|jvm_heap_memory_used$|node_.*$|namespace_.*$|kube_.*$|cluster.*$|container_.*$",
-							},
-						},
-						URL: remoteWriteURL,
-						TLSConfig: &promv1.TLSConfig{
-							SafeTLSConfig: promv1.SafeTLSConfig{
-								InsecureSkipVerify: true,
-							},
-						},
-						OAuth2: &promv1.OAuth2{
-							ClientID: promv1.SecretOrConfigMap{
-								Secret: &corev1.SecretKeySelector{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: "addon",
-									},
-									Key: "client-id",
-								},
-							},
-							ClientSecret: corev1.SecretKeySelector{
-								LocalObjectReference: corev1.LocalObjectReference{
-									Name: "addon",
-								},
-								Key: "client-secret",
-							},
-							TokenURL: tokenURL,
-						},
-					},
-				},
-				ServiceMonitorNamespaceSelector: &metav1.LabelSelector{
-					MatchLabels: map[string]string{
-						"kubernetes.io/metadata.name": "redhat-starburst-operator",
-					},
-				},
-
-				ServiceMonitorSelector: &metav1.LabelSelector{},
-				PodMonitorSelector:     &metav1.LabelSelector{},
-				ServiceAccountName:     "starburst-enterprise-helm-operator-controller-manager",
-				Resources: corev1.ResourceRequirements{
-					Requests: corev1.ResourceList{
-						corev1.ResourceMemory: resource.MustParse("400Mi"),
-					},
-				},
-			},
-		},
+	// AlertmanagerConfig is only served by Prometheus operators with v1alpha1
+	alertmanagerConfigs := promv1alpha1.SchemeGroupVersion.WithKind("AlertmanagerConfig")
+	if _, err := mgr.GetRESTMapper().RESTMapping(alertmanagerConfigs.GroupKind(), alertmanagerConfigs.Version); err == nil {
+		b = b.Watches(&source.Kind{Type: &promv1alpha1.AlertmanagerConfig{}}, toAddons, inOperandNamespace)
 	}
+	return b.Complete(r)
 }
 
-// returns the license secret
-func (r *AddonReconciler) DeployLicenseSecret(ctx context.Context, license, namespace string) *corev1.Secret {
-	logger := log.FromContext(ctx)
-	logger.Info("Deploying license secret")
-	return &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "starburst-license",
-			Namespace: namespace,
-		},
-		Data: map[string][]byte{
-			"starburstdata.license": []byte(license),
-		},
+// requestsForAddons enqueues every StarburstAddon in the cluster.
+func (r *StarburstAddonReconciler) requestsForAddons(_ client.Object) []reconcile.Request {
+	addons := &addonv1alpha1.StarburstAddonList{}
+	if err := r.Client.List(context.Background(), addons); err != nil {
+		r.Log.Error(err, "could not list StarburstAddons")
+		return nil
 	}
-}
 
-func (r *AddonReconciler) DeployFederationServiceMonitor() *promv1.ServiceMonitor {
-	metrics := make(map[string][]string)
-	str1 := fmt.Sprintf("container_memory_working_set_bytes{namespace=\"%s\"}", Namespace)
-	str2 := fmt.Sprintf("node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace=\"%s\"}", Namespace)
-	str3 := fmt.Sprintf("namespace_workload_pod:kube_pod_owner:relabel{namespace=\"%s\"}", Namespace)
-	str4 := fmt.Sprintf("kube_pod_container_info{namespace=\"%s\"}", Namespace)
-	str5 := fmt.Sprintf("kube_pod_status_ready{namespace=\"%s\"}", Namespace)
-	str6 := fmt.Sprintf("kube_pod_container_status_last_terminated_reason{namespace=\"%s\"}", Namespace)
-	str7 := fmt.Sprintf("kube_pod_container_status_waiting{namespace=\"%s\"}", Namespace)
-	str8 := fmt.Sprintf("kube_namespace_status_phase{namespace=\"%s\"}", Namespace)
-	str9 := fmt.Sprintf("node_namespace_pod:kube_pod_info:{namespace=\"%s\"}", Namespace)
-	str10 := fmt.Sprintf("kube_service_info{namespace=\"%s\"}", Namespace)
-	str11 := fmt.Sprintf("cluster:namespace:pod_memory:active:kube_pod_container_resource_limits{namespace=\"%s\"}", Namespace)
-	str12 := fmt.Sprintf("container_cpu_cfs_throttled_seconds_total{namespace=\"%s\"}", Namespace)
-	str13 := fmt.Sprintf("container_fs_usage_bytes{namespace=\"%s\"}", Namespace)
-	str14 := fmt.Sprintf("container_network_receive_bytes_total{namespace=\"%s\"}", Namespace)
-	str15 := fmt.Sprintf("container_network_transmit_bytes_total{namespace=\"%s\"}", Namespace)
-	str16 := fmt.Sprintf("kube_deployment_status_replicas_available{namespace=\"%s\"}", Namespace)
-	str17 := "kube_node_status_capacity"
-	str18 := fmt.Sprintf("container_memory_usage_bytes{namespace=\"%s\"}", Namespace)
-	str19 := fmt.Sprintf("kube_pod_container_resource_requests{namespace=\"%s\"}", Namespace)
-	str20 := fmt.Sprintf("kube_deployment_status_replicas_unavailable{namespace=\"%s\"}", Namespace)
-	str21 := fmt.Sprintf("kube_persistentvolumeclaim_status_phase{namespace=\"%s\"}", Namespace)
-	str22 := fmt.Sprintf("container_memory_working_set_bytes{namespace=\"%s\"}", Namespace)
-	str23 := fmt.Sprintf("kube_pod_container_resource_limits{namespace=\"%s\"}", Namespace)
-	str24 := fmt.Sprintf("cluster:namespace:pod_cpu:active:kube_pod_container_resource_limits{namespace=\"%s\"}", Namespace)
-	str25 := fmt.Sprintf("container_network_receive_packets_total{namespace=\"%s\"}", Namespace)
-	str26 := fmt.Sprintf("container_network_transmit_packets_total{namespace=\"%s\"}", Namespace)
-	str27 := fmt.Sprintf("kube_running_pod_ready{namespace=\"%s\"}", Namespace)
-	str28 := fmt.Sprintf("node_namespace_pod:kube_pod_info:{namespace=\"%s\"}", Namespace)
-	str29 := fmt.Sprintf("container_cpu_usage_seconds_total{namespace=\"%s\"}", Namespace)
-	str30 := fmt.Sprintf("kube_pod_container_status_restarts_total{namespace=\"%s\"}", Namespace)
-	str31 := fmt.Sprintf("kube_pod_status_phase{namespace=\"%s\"}", Namespace)
-	str32 := fmt.Sprintf("cluster:namespace:pod_memory:active:kube_pod_container_resource_requests{namespace=\"%s\"}", Namespace)
-
-	metrics["match[]"] = append(metrics["match[]"], str1, str2, str3, str4, str5, str6, str7, str8, str9, str10, str11, str12, str13, str14, str15, str16, str17, str18, str19, str20, str21, str22, str23, str24, str25, str26, str27, str28, str29, str30, str31, str32)
-
-	return &promv1.ServiceMonitor{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      Name + "-federation",
-			Namespace: Namespace,
-		},
-		Spec: promv1.ServiceMonitorSpec{
-			JobLabel: "openshift-monitoring-federation",
-			NamespaceSelector: promv1.NamespaceSelector{
-				MatchNames: []string{
-					"openshift-monitoring",
-				},
-			},
-			Selector: metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app.kubernetes.io/instance": "k8s",
-				},
-			},
-			Endpoints: []promv1.Endpoint{
-				{
-					BearerTokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token",
-					Port:            "web",
-					Path:            "/federate",
-					Interval:        "30s",
-					Scheme:          "https",
-					Params:          metrics,
-					TLSConfig: &promv1.TLSConfig{
-						SafeTLSConfig: promv1.SafeTLSConfig{
-							InsecureSkipVerify: true,
-							ServerName:         "prometheus-k8s.openshift-monitoring.svc.cluster.local",
-						},
-						CAFile: "/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt",
-					},
-				},
-			},
-		},
+	requests := make([]reconcile.Request, 0, len(addons.Items))
+	for _, addon := range addons.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      addon.Name,
+			Namespace: addon.Namespace,
+		}})
 	}
-}
-
-func fetchClusterID() string {
-	clusterID := cv.Spec.ClusterID
-	return string(clusterID)
+	return requests
 }
@@ -0,0 +1,245 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+var _ = Describe("StarburstAddon controller", Ordered, func() {
+	const (
+		timeout  = 30 * time.Second
+		interval = 250 * time.Millisecond
+	)
+
+	addonKey := types.NamespacedName{Name: "starburst-addon", Namespace: Namespace}
+
+	// key returns the name of a generated resource.
+	key := func(name string) types.NamespacedName {
+		return types.NamespacedName{Name: name, Namespace: Namespace}
+	}
+
+	// conditionStatus polls the status of one of the addon conditions.
+	conditionStatus := func(conditionType string) func() metav1.ConditionStatus {
+		return func() metav1.ConditionStatus {
+			addon := &addonv1alpha1.StarburstAddon{}
+			if err := k8sClient.Get(ctx, addonKey, addon); err != nil {
+				return metav1.ConditionUnknown
+			}
+			condition := meta.FindStatusCondition(addon.Status.Conditions, conditionType)
+			if condition == nil {
+				return metav1.ConditionUnknown
+			}
+			return condition.Status
+		}
+	}
+
+	// exists polls whether a generated resource is present.
+	exists := func(obj client.Object, name string) func() bool {
+		return func() bool {
+			return k8sClient.Get(ctx, key(name), obj) == nil
+		}
+	}
+
+	// updateAddon retries mutate against the latest StarburstAddon until the
+	// update does not race with the controller.
+	updateAddon := func(mutate func(*addonv1alpha1.StarburstAddon)) {
+		Eventually(func() error {
+			addon := &addonv1alpha1.StarburstAddon{}
+			if err := k8sClient.Get(ctx, addonKey, addon); err != nil {
+				return err
+			}
+			mutate(addon)
+			return k8sClient.Update(ctx, addon)
+		}, timeout, interval).Should(Succeed())
+	}
+
+	// isGone polls whether a generated resource has been deleted.
+	isGone := func(obj client.Object, name string) func() bool {
+		return func() bool {
+			return k8serrors.IsNotFound(k8sClient.Get(ctx, key(name), obj))
+		}
+	}
+
+	Context("when the parameter and vault secrets are missing", func() {
+		It("reports the missing dependencies without blocking other components", func() {
+			addon := &addonv1alpha1.StarburstAddon{
+				ObjectMeta: metav1.ObjectMeta{Name: addonKey.Name, Namespace: addonKey.Namespace},
+				Spec:       addonv1alpha1.StarburstAddonSpec{Metrics: true},
+			}
+			Expect(k8sClient.Create(ctx, addon)).To(Succeed())
+
+			Eventually(conditionStatus("LicenseReady"), timeout, interval).Should(Equal(metav1.ConditionFalse))
+			Eventually(conditionStatus("PrometheusReady"), timeout, interval).Should(Equal(metav1.ConditionFalse))
+			Eventually(conditionStatus("ServiceMonitorsReady"), timeout, interval).Should(Equal(metav1.ConditionTrue))
+			Eventually(conditionStatus("OperandReady"), timeout, interval).Should(Equal(metav1.ConditionFalse))
+
+			Expect(k8sClient.Get(ctx, key(Name), &promv1.Prometheus{})).NotTo(Succeed())
+			Expect(k8sClient.Get(ctx, key(Name), &batchv1.CronJob{})).NotTo(Succeed())
+		})
+	})
+
+	Context("when the secrets are created", func() {
+		It("installs every generated resource", func() {
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "addon-managed-starburst-parameters", Namespace: Namespace},
+				StringData: map[string]string{
+					"starburst-license":        "test-license",
+					"starburstenterprise.yaml": "{}",
+				},
+			})).To(Succeed())
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "addon", Namespace: Namespace},
+				StringData: map[string]string{
+					"token-url":        "https://sso.example.com/token",
+					"remote-write-url": "https://observatorium.example.com/api/metrics/v1/receive",
+					"client-id":        "client",
+					"client-secret":    "secret",
+				},
+			})).To(Succeed())
+
+			Eventually(exists(&corev1.Secret{}, "starburst-license"), timeout, interval).Should(BeTrue())
+			Eventually(exists(&promv1.Prometheus{}, Name), timeout, interval).Should(BeTrue())
+			Eventually(exists(&promv1.ServiceMonitor{}, Name), timeout, interval).Should(BeTrue())
+			Eventually(exists(&promv1.ServiceMonitor{}, Name+"-federation"), timeout, interval).Should(BeTrue())
+			Eventually(exists(&promv1.PrometheusRule{}, Name), timeout, interval).Should(BeTrue())
+			Eventually(exists(&batchv1.CronJob{}, Name), timeout, interval).Should(BeTrue())
+
+			Eventually(conditionStatus("LicenseReady"), timeout, interval).Should(Equal(metav1.ConditionTrue))
+			Eventually(conditionStatus("PrometheusReady"), timeout, interval).Should(Equal(metav1.ConditionTrue))
+			Eventually(conditionStatus(addonv1alpha1.ConditionFieldConflict), timeout, interval).Should(Equal(metav1.ConditionFalse))
+
+			addon := &addonv1alpha1.StarburstAddon{}
+			Expect(k8sClient.Get(ctx, addonKey, addon)).To(Succeed())
+			Expect(addon.Finalizers).To(ContainElement(Finalizer))
+
+			prometheus := &promv1.Prometheus{}
+			Expect(k8sClient.Get(ctx, key(Name), prometheus)).To(Succeed())
+			Expect(prometheus.Spec.ExternalLabels).To(HaveKeyWithValue("cluster_id", "00000000-0000-0000-0000-000000000000"))
+		})
+	})
+
+	Context("when a generated resource drifts", func() {
+		It("recreates deleted resources", func() {
+			Expect(k8sClient.Delete(ctx, &promv1.ServiceMonitor{
+				ObjectMeta: metav1.ObjectMeta{Name: Name, Namespace: Namespace},
+			})).To(Succeed())
+
+			Eventually(exists(&promv1.ServiceMonitor{}, Name), timeout, interval).Should(BeTrue())
+		})
+
+		It("reports a conflict for modified fields and restores them when forced", func() {
+			sm := &promv1.ServiceMonitor{}
+			Expect(k8sClient.Get(ctx, key(Name), sm)).To(Succeed())
+			sm.Spec.Endpoints[0].Interval = "1m"
+			Expect(k8sClient.Update(ctx, sm, client.FieldOwner("sre-tooling"))).To(Succeed())
+
+			Eventually(conditionStatus(addonv1alpha1.ConditionFieldConflict), timeout, interval).Should(Equal(metav1.ConditionTrue))
+
+			updateAddon(func(addon *addonv1alpha1.StarburstAddon) {
+				addon.Spec.ForceApply = true
+			})
+
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, key(Name), sm); err != nil {
+					return ""
+				}
+				return string(sm.Spec.Endpoints[0].Interval)
+			}, timeout, interval).Should(Equal("2s"))
+			Eventually(conditionStatus(addonv1alpha1.ConditionFieldConflict), timeout, interval).Should(Equal(metav1.ConditionFalse))
+		})
+	})
+
+	Context("when reconciliation is paused", func() {
+		setPaused := func(paused bool) {
+			updateAddon(func(addon *addonv1alpha1.StarburstAddon) {
+				addon.Spec.Paused = paused
+			})
+		}
+
+		It("leaves generated resources alone until resumed", func() {
+			setPaused(true)
+			Eventually(conditionStatus(addonv1alpha1.ConditionPaused), timeout, interval).Should(Equal(metav1.ConditionTrue))
+
+			Expect(k8sClient.Delete(ctx, &promv1.ServiceMonitor{
+				ObjectMeta: metav1.ObjectMeta{Name: Name, Namespace: Namespace},
+			})).To(Succeed())
+			Consistently(isGone(&promv1.ServiceMonitor{}, Name), 2*time.Second, interval).Should(BeTrue())
+
+			setPaused(false)
+			Eventually(conditionStatus(addonv1alpha1.ConditionPaused), timeout, interval).Should(Equal(metav1.ConditionFalse))
+			Eventually(exists(&promv1.ServiceMonitor{}, Name), timeout, interval).Should(BeTrue())
+		})
+	})
+
+	Context("when metrics are toggled", func() {
+		setMetrics := func(enabled bool) {
+			updateAddon(func(addon *addonv1alpha1.StarburstAddon) {
+				addon.Spec.Metrics = enabled
+			})
+		}
+
+		It("removes the monitoring resources when disabled", func() {
+			setMetrics(false)
+
+			Eventually(isGone(&promv1.Prometheus{}, Name), timeout, interval).Should(BeTrue())
+			Eventually(isGone(&promv1.ServiceMonitor{}, Name), timeout, interval).Should(BeTrue())
+			Eventually(isGone(&promv1.ServiceMonitor{}, Name+"-federation"), timeout, interval).Should(BeTrue())
+			Eventually(isGone(&promv1.PrometheusRule{}, Name), timeout, interval).Should(BeTrue())
+			Consistently(exists(&batchv1.CronJob{}, Name), 2*time.Second, interval).Should(BeTrue())
+		})
+
+		It("restores the monitoring resources when enabled again", func() {
+			setMetrics(true)
+
+			Eventually(exists(&promv1.Prometheus{}, Name), timeout, interval).Should(BeTrue())
+			Eventually(exists(&promv1.ServiceMonitor{}, Name), timeout, interval).Should(BeTrue())
+			Eventually(exists(&promv1.PrometheusRule{}, Name), timeout, interval).Should(BeTrue())
+		})
+	})
+
+	Context("when the StarburstAddon is deleted", func() {
+		It("removes the generated resources and the finalizer", func() {
+			Expect(k8sClient.Delete(ctx, &addonv1alpha1.StarburstAddon{
+				ObjectMeta: metav1.ObjectMeta{Name: addonKey.Name, Namespace: addonKey.Namespace},
+			})).To(Succeed())
+
+			Eventually(isGone(&promv1.Prometheus{}, Name), timeout, interval).Should(BeTrue())
+			Eventually(isGone(&promv1.ServiceMonitor{}, Name), timeout, interval).Should(BeTrue())
+			Eventually(isGone(&promv1.PrometheusRule{}, Name), timeout, interval).Should(BeTrue())
+			Eventually(isGone(&batchv1.CronJob{}, Name), timeout, interval).Should(BeTrue())
+			Eventually(isGone(&corev1.Secret{}, "starburst-license"), timeout, interval).Should(BeTrue())
+			Eventually(func() bool {
+				return k8serrors.IsNotFound(k8sClient.Get(ctx, addonKey, &addonv1alpha1.StarburstAddon{}))
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,168 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// coordinatorURL is the address of the coordinator service created by the
+// StarburstEnterprise chart in the operand namespace.
+func coordinatorURL(namespace string) string {
+	return fmt.Sprintf("http://%s.%s.svc:%d", coordinatorService, namespace, coordinatorPort)
+}
+
+// trinoClient talks to the Trino REST API of the operand.
+type trinoClient struct {
+	http *http.Client
+
+	// sharedSecret, when set, authenticates requests as internal to Trino.
+	sharedSecret []byte
+}
+
+func newTrinoClient() *trinoClient {
+	return &trinoClient{http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// trino returns a client for the operand. Once users authenticate, the
+// coordinator rejects anonymous requests, and the operator has no user
+// credentials, so it signs its requests with the internal communication
+// secret like a Trino node would.
+func (r *StarburstAddonReconciler) trino(ctx context.Context) *trinoClient {
+	c := newTrinoClient()
+	secret := internalCommunicationSecret(nil)
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, secret); err == nil {
+		c.sharedSecret = secret.Data[sharedSecretKey]
+	}
+	return c
+}
+
+// internalBearer is the token Trino nodes authenticate to each other with: a
+// short-lived HS256 JWT keyed by the SHA-256 of the shared secret.
+func internalBearer(sharedSecret []byte, now time.Time) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	claims, _ := json.Marshal(map[string]interface{}{
+		"sub": FieldManager,
+		"exp": now.Add(5 * time.Minute).Unix(),
+	})
+	unsigned := encode([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + encode(claims)
+
+	key := sha256.Sum256(sharedSecret)
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + encode(mac.Sum(nil))
+}
+
+// queryStates counts the queries known to the coordinator per state, for
+// example RUNNING or QUEUED.
+func (c *trinoClient) queryStates(ctx context.Context, baseURL string) (map[string]int, error) {
+	var queries []struct {
+		State string `json:"state"`
+	}
+	if err := c.get(ctx, baseURL+"/v1/query", &queries); err != nil {
+		return nil, err
+	}
+
+	states := map[string]int{}
+	for _, q := range queries {
+		states[q.State]++
+	}
+	return states, nil
+}
+
+func (c *trinoClient) get(ctx context.Context, url string, out interface{}) error {
+	return c.do(ctx, http.MethodGet, url, nil, out)
+}
+
+// do sends a request to Trino and decodes the JSON response into out, unless
+// out is nil.
+func (c *trinoClient) do(ctx context.Context, method, url string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Trino-User", FieldManager)
+	if len(c.sharedSecret) > 0 {
+		req.Header.Set("X-Trino-Internal-Bearer", internalBearer(c.sharedSecret, time.Now()))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach Trino: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s returned %s", method, url, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not decode response of %s: %v", url, err)
+	}
+	return nil
+}
+
+// catalogs returns the names of the catalogs the coordinator serves, running
+// SHOW CATALOGS through the statement API.
+func (c *trinoClient) catalogs(ctx context.Context, baseURL string) ([]string, error) {
+	var page struct {
+		NextURI string          `json:"nextUri"`
+		Data    [][]interface{} `json:"data"`
+		Error   *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := c.do(ctx, http.MethodPost, baseURL+"/v1/statement", strings.NewReader("SHOW CATALOGS"), &page); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for {
+		if page.Error != nil {
+			return nil, fmt.Errorf("SHOW CATALOGS failed: %s", page.Error.Message)
+		}
+		for _, row := range page.Data {
+			if len(row) > 0 {
+				if name, ok := row[0].(string); ok {
+					names = append(names, name)
+				}
+			}
+		}
+		if page.NextURI == "" {
+			return names, nil
+		}
+		next := page.NextURI
+		page.NextURI, page.Data, page.Error = "", nil, nil
+		if err := c.get(ctx, next, &page); err != nil {
+			return nil, err
+		}
+	}
+}
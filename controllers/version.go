@@ -0,0 +1,307 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// upgradePaths lists, per Starburst Enterprise LTS release, the releases it
+// can be upgraded to directly. Patch versions within a release are always
+// allowed.
+var upgradePaths = map[string][]string{
+	"380": {"393"},
+	"393": {"402"},
+	"402": {"413"},
+	"413": {"423"},
+	"423": {"429"},
+	"429": {},
+}
+
+const (
+	defaultCoordinatorReadyTimeout = 10 * time.Minute
+	rolloutPollInterval            = 15 * time.Second
+)
+
+// release returns the LTS release of a version, 402 for 402-e.1.
+func release(version string) string {
+	return strings.SplitN(version, "-", 2)[0]
+}
+
+// allowedUpgrade reports whether from can be upgraded to to in one step.
+func allowedUpgrade(from, to string) bool {
+	if release(from) == release(to) {
+		return true
+	}
+	for _, next := range upgradePaths[release(from)] {
+		if next == release(to) {
+			return true
+		}
+	}
+	return false
+}
+
+// operandVersion is the version the StarburstEnterprise currently asks for.
+func operandVersion(se *unstructured.Unstructured) string {
+	if tag, _, _ := unstructured.NestedString(se.Object, "spec", "coordinator", "image", "tag"); tag != "" {
+		return tag
+	}
+	tag, _, _ := unstructured.NestedString(se.Object, "spec", "image", "tag")
+	return tag
+}
+
+// operandImagePatch sets the coordinator and worker image tags of se, along
+// with the graceful shutdown of the workers the rollout replaces.
+func operandImagePatch(se *unstructured.Unstructured, coordinator, worker string, spec addonv1alpha1.StarburstAddonSpec) *unstructured.Unstructured {
+	patch := starburstEnterprisePatch(se)
+	_ = unstructured.SetNestedField(patch.Object, coordinator, "spec", "coordinator", "image", "tag")
+	_ = unstructured.SetNestedField(patch.Object, worker, "spec", "worker", "image", "tag")
+	setWorkerShutdown(patch, spec)
+	return patch
+}
+
+// versionComponent rolls spec.version out to the operand: pre-flight checks,
+// then the coordinator, then the workers, spec.maxDrainingWorkers at a time,
+// each shutting down gracefully as its pod is replaced. The coordinator is
+// rolled back if it does not become ready in time. Progress is kept in
+// status.version, so a rollout survives operator restarts.
+type versionComponent struct {
+	r *StarburstAddonReconciler
+}
+
+func (c *versionComponent) Name() string { return "Version" }
+
+func (c *versionComponent) Reconcile(ctx context.Context, addon *addonv1alpha1.StarburstAddon) (ctrl.Result, error) {
+	if addon.Spec.Version == "" {
+		addon.Status.Version = nil
+		return ctrl.Result{}, nil
+	}
+
+	se, err := c.r.getStarburstEnterprise(ctx, Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Plan mode reports the next step without advancing the rollout.
+	if c.r.Plan {
+		version := addon.Status.Version.DeepCopy()
+		defer func() { addon.Status.Version = version }()
+	}
+
+	if addon.Status.Version == nil {
+		addon.Status.Version = &addonv1alpha1.VersionStatus{Current: operandVersion(se)}
+	}
+
+	switch addon.Status.Version.Phase {
+	case addonv1alpha1.VersionPhaseCoordinator:
+		return c.upgradeCoordinator(ctx, addon, se)
+	case addonv1alpha1.VersionPhaseWorkers:
+		return c.upgradeWorkers(ctx, addon, se)
+	case addonv1alpha1.VersionPhaseRollback:
+		return c.rollback(ctx, addon, se)
+	default:
+		return c.start(ctx, addon, se)
+	}
+}
+
+// start begins a rollout when spec.version differs from the current version
+// and every pre-flight check passes. Until then the current version is held.
+func (c *versionComponent) start(ctx context.Context, addon *addonv1alpha1.StarburstAddon, se *unstructured.Unstructured) (ctrl.Result, error) {
+	status := addon.Status.Version
+	target := addon.Spec.Version
+	if status.Current == "" {
+		// The StarburstEnterprise leaves the tag to the chart, so the
+		// coordinator tells which version is running.
+		current, err := c.r.runningVersion(ctx, Namespace)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if current == "" {
+			return ctrl.Result{RequeueAfter: rolloutPollInterval}, &pendingError{
+				reason:  "OperandNotDeployed",
+				message: fmt.Sprintf("Upgrade to %s is waiting for the coordinator to be deployed", target),
+			}
+		}
+		status.Current = current
+	}
+	if err := c.r.applyOperandPatch(ctx, addon, c.Name(), operandImagePatch(se, status.Current, status.Current, addon.Spec)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	switch {
+	case target == status.Current:
+		return ctrl.Result{}, nil
+	case target == status.FailedVersion:
+		return ctrl.Result{}, &pendingError{
+			reason:  "RolledBack",
+			message: fmt.Sprintf("Upgrade to %s was rolled back, set spec.version to another version to retry", target),
+		}
+	case !allowedUpgrade(status.Current, target):
+		return ctrl.Result{}, fmt.Errorf("upgrading from %s to %s is not a supported upgrade path", status.Current, target)
+	}
+
+	if result, err := deferDuringMaintenance(addon, "Upgrade to "+target); err != nil {
+		return result, err
+	}
+
+	if err := c.preflight(ctx, addon); err != nil {
+		return ctrl.Result{RequeueAfter: time.Minute}, &pendingError{
+			reason:  "PreflightFailed",
+			message: fmt.Sprintf("Upgrade to %s is waiting: %v", target, err),
+		}
+	}
+
+	log.FromContext(ctx).Info("Starting upgrade", "from", status.Current, "to", target)
+	status.Target = target
+	setVersionPhase(status, addonv1alpha1.VersionPhaseCoordinator)
+	return c.upgradeCoordinator(ctx, addon, se)
+}
+
+// preflight checks that the operand is healthy and idle enough to upgrade.
+func (c *versionComponent) preflight(ctx context.Context, addon *addonv1alpha1.StarburstAddon) error {
+	for _, name := range []string{coordinatorDeployment, workerDeployment} {
+		ready, err := c.r.deploymentRolledOut(ctx, Namespace, name, addon.Status.Version.Current)
+		if err != nil {
+			return err
+		}
+		if !ready {
+			return fmt.Errorf("%s is not fully available", name)
+		}
+	}
+
+	maxRunning := int32(0)
+	if addon.Spec.Upgrade != nil && addon.Spec.Upgrade.MaxRunningQueries != nil {
+		maxRunning = *addon.Spec.Upgrade.MaxRunningQueries
+	}
+	states, err := c.r.trino(ctx).queryStates(ctx, coordinatorURL(Namespace))
+	if err != nil {
+		return err
+	}
+	if running := states["RUNNING"]; running > int(maxRunning) {
+		return fmt.Errorf("%d queries are running, at most %d allowed", running, maxRunning)
+	}
+	return nil
+}
+
+func (c *versionComponent) upgradeCoordinator(ctx context.Context, addon *addonv1alpha1.StarburstAddon, se *unstructured.Unstructured) (ctrl.Result, error) {
+	status := addon.Status.Version
+	if err := c.r.applyOperandPatch(ctx, addon, c.Name(), operandImagePatch(se, status.Target, status.Current, addon.Spec)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	ready, err := c.r.deploymentRolledOut(ctx, Namespace, coordinatorDeployment, status.Target)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if ready {
+		// The workers are held on the previous version while a maintenance
+		// window is open; once they roll, the rollout runs to completion.
+		if result, err := deferDuringMaintenance(addon, "Upgrading the workers to "+status.Target); err != nil {
+			return result, err
+		}
+		setVersionPhase(status, addonv1alpha1.VersionPhaseWorkers)
+		return c.upgradeWorkers(ctx, addon, se)
+	}
+
+	timeout := defaultCoordinatorReadyTimeout
+	if addon.Spec.Upgrade != nil && addon.Spec.Upgrade.CoordinatorReadyTimeout != nil {
+		timeout = addon.Spec.Upgrade.CoordinatorReadyTimeout.Duration
+	}
+	if status.PhaseStartTime != nil && time.Since(status.PhaseStartTime.Time) > timeout {
+		log.FromContext(ctx).Info("Coordinator not ready in time, rolling back", "version", status.Target, "timeout", timeout)
+		status.FailedVersion = status.Target
+		setVersionPhase(status, addonv1alpha1.VersionPhaseRollback)
+		return c.rollback(ctx, addon, se)
+	}
+
+	return ctrl.Result{RequeueAfter: rolloutPollInterval}, &pendingError{
+		reason:  addonv1alpha1.VersionPhaseCoordinator,
+		message: fmt.Sprintf("Waiting for the coordinator to become ready on %s", status.Target),
+	}
+}
+
+// upgradeWorkers rolls the workers to the target version. The worker
+// Deployment replaces spec.maxDrainingWorkers pods at a time, and each
+// finishes its tasks while it terminates.
+func (c *versionComponent) upgradeWorkers(ctx context.Context, addon *addonv1alpha1.StarburstAddon, se *unstructured.Unstructured) (ctrl.Result, error) {
+	status := addon.Status.Version
+	if err := c.r.limitWorkerRollout(ctx, addon); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := c.r.applyOperandPatch(ctx, addon, c.Name(), operandImagePatch(se, status.Target, status.Target, addon.Spec)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	ready, err := c.r.deploymentRolledOut(ctx, Namespace, workerDeployment, status.Target)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !ready {
+		return ctrl.Result{RequeueAfter: rolloutPollInterval}, &pendingError{
+			reason:  addonv1alpha1.VersionPhaseWorkers,
+			message: fmt.Sprintf("Waiting for the workers to become ready on %s", status.Target),
+		}
+	}
+
+	log.FromContext(ctx).Info("Upgrade complete", "version", status.Target)
+	status.Current = status.Target
+	status.Target = ""
+	setVersionPhase(status, "")
+	return ctrl.Result{}, nil
+}
+
+func (c *versionComponent) rollback(ctx context.Context, addon *addonv1alpha1.StarburstAddon, se *unstructured.Unstructured) (ctrl.Result, error) {
+	status := addon.Status.Version
+	if err := c.r.applyOperandPatch(ctx, addon, c.Name(), operandImagePatch(se, status.Current, status.Current, addon.Spec)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	ready, err := c.r.deploymentRolledOut(ctx, Namespace, coordinatorDeployment, status.Current)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if ready {
+		log.FromContext(ctx).Info("Rollback complete", "version", status.Current)
+		status.Target = ""
+		setVersionPhase(status, "")
+		return c.start(ctx, addon, se)
+	}
+
+	return ctrl.Result{RequeueAfter: rolloutPollInterval}, &pendingError{
+		reason:  addonv1alpha1.VersionPhaseRollback,
+		message: fmt.Sprintf("Rolling the coordinator back to %s after %s failed", status.Current, status.FailedVersion),
+	}
+}
+
+func setVersionPhase(status *addonv1alpha1.VersionStatus, phase string) {
+	status.Phase = phase
+	status.PhaseStartTime = nil
+	if phase != "" {
+		now := metav1.Now()
+		status.PhaseStartTime = &now
+	}
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	addonv1alpha1 "github.com/RHEcosystemAppEng/starburstaddon-operator/api/v1alpha1"
+)
+
+// applyClient turns server-side apply patches into merge patches, which the
+// fake client supports, or creates the object when it does not exist yet, so
+// that components applying operand fields can run against it.
+type applyClient struct {
+	client.Client
+}
+
+func (c applyClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	err = c.Client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, data))
+	if k8serrors.IsNotFound(err) {
+		return c.Client.Create(ctx, obj)
+	}
+	return err
+}
+
+// testOperand returns a client holding an untagged StarburstEnterprise and
+// the operand Deployments, fully rolled out on the given image tags. An empty
+// tag leaves the Deployment out.
+func testOperand(t *testing.T, coordinatorTag, workerTag string) client.Client {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	scheme.AddKnownTypeWithName(StarburstEnterpriseGVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(StarburstEnterpriseGVK.GroupVersion().WithKind(StarburstEnterpriseGVK.Kind+"List"), &unstructured.UnstructuredList{})
+
+	se := &unstructured.Unstructured{}
+	se.SetGroupVersionKind(StarburstEnterpriseGVK)
+	se.SetName(Name)
+	se.SetNamespace(Namespace)
+	objs := []client.Object{se}
+	for name, tag := range map[string]string{coordinatorDeployment: coordinatorTag, workerDeployment: workerTag} {
+		if tag != "" {
+			objs = append(objs, testDeployment(name, tag))
+		}
+	}
+	return applyClient{fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()}
+}
+
+// testDeployment is an operand Deployment with one available replica on tag.
+func testDeployment(name, tag string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(1),
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": name}},
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  name,
+				Image: "registry.connect.redhat.com/starburst/starburst-enterprise:" + tag,
+			}}}},
+		},
+		Status: appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+	}
+}
+
+// operandTag reads an image tag of the StarburstEnterprise.
+func operandTag(t *testing.T, c client.Client, role string) string {
+	se, err := (&StarburstAddonReconciler{Client: c}).getStarburstEnterprise(context.Background(), Namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, _, _ := unstructured.NestedString(se.Object, "spec", role, "image", "tag")
+	return tag
+}
+
+func pendingReason(err error) string {
+	var pending *pendingError
+	if errors.As(err, &pending) {
+		return pending.reason
+	}
+	return ""
+}
+
+func TestAllowedUpgrade(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     bool
+	}{
+		{"402-e.1", "402-e.6", true},
+		{"402-e.6", "402-e.1", true},
+		{"402-e.6", "413-e.1", true},
+		{"402-e.6", "423-e.1", false},
+		{"413-e.1", "402-e.6", false},
+		{"999-e.1", "1000-e.1", false},
+	}
+
+	for _, tc := range cases {
+		if got := allowedUpgrade(tc.from, tc.to); got != tc.want {
+			t.Errorf("allowedUpgrade(%s, %s) = %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	cases := map[string]string{
+		"registry.connect.redhat.com/starburst/starburst-enterprise:402-e.6":               "402-e.6",
+		"localhost:5000/starburst-enterprise:413-e.1":                                      "413-e.1",
+		"localhost:5000/starburst-enterprise":                                              "",
+		"quay.io/starburst/starburst-enterprise:402-e.6@sha256:0123456789abcdef0123456789": "402-e.6",
+	}
+
+	for image, want := range cases {
+		if got := imageTag(image); got != want {
+			t.Errorf("imageTag(%s) = %q, want %q", image, got, want)
+		}
+	}
+}
+
+func TestVersionUntaggedOperand(t *testing.T) {
+	cases := []struct {
+		name           string
+		coordinatorTag string
+		wantReason     string
+		wantCurrent    string
+	}{
+		// The coordinator tells the running version; the pre-flight checks
+		// then fail as the coordinator API is unreachable from the test.
+		{"running", "402-e.1", "PreflightFailed", "402-e.1"},
+		{"not deployed", "", "OperandNotDeployed", ""},
+	}
+
+	for _, tc := range cases {
+		c := testOperand(t, tc.coordinatorTag, tc.coordinatorTag)
+		component := &versionComponent{&StarburstAddonReconciler{Client: c}}
+		addon := testAddon(addonv1alpha1.StarburstAddonSpec{Version: "402-e.6"})
+
+		_, err := component.Reconcile(context.Background(), addon)
+		if got := pendingReason(err); got != tc.wantReason {
+			t.Errorf("%s: got %q (%v), want %s", tc.name, got, err, tc.wantReason)
+		}
+		if got := addon.Status.Version.Current; got != tc.wantCurrent {
+			t.Errorf("%s: current version %q, want %q", tc.name, got, tc.wantCurrent)
+		}
+		if tc.wantCurrent == "" {
+			continue
+		}
+		if got := operandTag(t, c, "worker"); got != tc.wantCurrent {
+			t.Errorf("%s: worker tag %q, want the running %q", tc.name, got, tc.wantCurrent)
+		}
+		if addon.Status.Version.Phase != "" {
+			t.Errorf("%s: rollout started in phase %s before the pre-flight checks passed", tc.name, addon.Status.Version.Phase)
+		}
+	}
+}
+
+func TestVersionRollsWorkersInBatches(t *testing.T) {
+	c := testOperand(t, "402-e.6", "402-e.1")
+	component := &versionComponent{&StarburstAddonReconciler{Client: c}}
+	addon := testAddon(addonv1alpha1.StarburstAddonSpec{Version: "402-e.6", MaxDrainingWorkers: int32Ptr(2)})
+	addon.Status.Version = &addonv1alpha1.VersionStatus{
+		Current: "402-e.1",
+		Target:  "402-e.6",
+		Phase:   addonv1alpha1.VersionPhaseCoordinator,
+	}
+	ctx := context.Background()
+
+	// The coordinator is ready, so the workers roll with a limited number of
+	// pods replaced, and thus shutting down, at a time.
+	_, err := component.Reconcile(ctx, addon)
+	if got := pendingReason(err); got != addonv1alpha1.VersionPhaseWorkers {
+		t.Fatalf("got %q (%v), want %s", got, err, addonv1alpha1.VersionPhaseWorkers)
+	}
+	if got := operandTag(t, c, "worker"); got != "402-e.6" {
+		t.Errorf("worker tag %q, want 402-e.6", got)
+	}
+	se, err := component.r.getStarburstEnterprise(ctx, Namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The default 5m drain deadline and twice the shutdown grace period.
+	if grace, _, _ := unstructured.NestedInt64(se.Object, "spec", "worker", "deploymentTerminationGracePeriodSeconds"); grace != 360 {
+		t.Errorf("worker termination grace period %ds, want 360s", grace)
+	}
+	workers := &appsv1.Deployment{}
+	if err := c.Get(ctx, client.ObjectKey{Name: workerDeployment, Namespace: Namespace}, workers); err != nil {
+		t.Fatal(err)
+	}
+	if rolling := workers.Spec.Strategy.RollingUpdate; rolling == nil || rolling.MaxUnavailable.IntValue() != 2 || rolling.MaxSurge.IntValue() != 0 {
+		t.Errorf("got worker rollout strategy %+v, want at most 2 unavailable and no surge", workers.Spec.Strategy)
+	}
+
+	// The chart rolled the workers.
+	workers.Spec.Template.Spec.Containers[0].Image = testDeployment(workerDeployment, "402-e.6").Spec.Template.Spec.Containers[0].Image
+	if err := c.Update(ctx, workers); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := component.Reconcile(ctx, addon); err != nil {
+		t.Fatal(err)
+	}
+	if status := addon.Status.Version; status.Current != "402-e.6" || status.Phase != "" {
+		t.Errorf("got version status %+v, want 402-e.6 rolled out", status)
+	}
+}